@@ -0,0 +1,253 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/opencode-ai/opencode/internal/app"
+	"github.com/opencode-ai/opencode/internal/config"
+	"github.com/opencode-ai/opencode/internal/format"
+	"github.com/opencode-ai/opencode/internal/llm/agent"
+	"github.com/opencode-ai/opencode/internal/llm/models"
+	"github.com/opencode-ai/opencode/internal/llm/provider"
+	"github.com/opencode-ai/opencode/internal/message"
+	"github.com/spf13/cobra"
+)
+
+var replayCmd = &cobra.Command{
+	Use:   "replay <dir>",
+	Short: "Rerun a recorded session against the current tool code",
+	Long: `Replay reruns a session recorded in debug mode. The recorded model responses
+are served back to the coder agent in order, and to its sub-agents from the
+cassettes recorded next to it, while their tool calls run against the current
+code and working directory, with a temporary database. The tool results are
+compared with the recorded ones, the command fails when any of them changed.
+
+The argument is the session's debug directory, such as
+.opencode/messages/<session prefix>, or its cassette.json file.`,
+	Example: `
+  # Record a session
+  opencode -d -p "Add a fade-in to the title"
+
+  # Replay it in a clean checkout
+  opencode replay -c /path/to/checkout .opencode/messages/1a2b3c4d
+  `,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		debug, _ := cmd.Flags().GetBool("debug")
+		cwd, _ := cmd.Flags().GetString("cwd")
+		quiet, _ := cmd.Flags().GetBool("quiet")
+
+		// Resolve the cassette before changing to the working directory
+		path, err := filepath.Abs(args[0])
+		if err != nil {
+			return err
+		}
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			path = filepath.Join(path, provider.CassetteFile)
+		}
+		cassette, err := provider.LoadCassette(path)
+		if err != nil {
+			return err
+		}
+		prompts := cassette.Prompts()
+		if len(prompts) == 0 {
+			return fmt.Errorf("cassette %s has no prompts to replay", path)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		// Every agent answers from the cassette instead of a real provider
+		if err := useMockScript(path); err != nil {
+			return err
+		}
+		if err := loadConfig(cwd, debug); err != nil {
+			return err
+		}
+		useMockModel()
+
+		// Sub-agent sessions are named by the tool calls that started them,
+		// which the recorded session holds in the project's database
+		dataDir, err := os.MkdirTemp("", "opencode-replay-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dataDir)
+		config.Get().Data.Directory = dataDir
+
+		app, err := newApp(ctx)
+		if err != nil {
+			return err
+		}
+		defer app.Shutdown()
+
+		var spinner *format.Spinner
+		if !quiet {
+			spinner = format.NewSpinner("Replaying...")
+			spinner.Start()
+		}
+		sessionID, err := replaySession(ctx, app, prompts)
+		if spinner != nil {
+			spinner.Stop()
+		}
+		if err != nil {
+			return err
+		}
+
+		msgs, err := app.Messages.List(ctx, sessionID)
+		if err != nil {
+			return err
+		}
+		recorded := cassette.ToolResults()
+		subMsgs, err := replayedSubSessions(ctx, app, filepath.Dir(path), sessionID, recorded)
+		if err != nil {
+			return err
+		}
+		msgs = append(msgs, subMsgs...)
+		if changed := reportToolResults(recorded, msgs); changed > 0 {
+			return fmt.Errorf("%d tool results changed", changed)
+		}
+		return nil
+	},
+}
+
+// useMockScript makes the mock model available, played by the coder from the
+// script at path and by the other agents from the sub-agent cassettes next to
+// it.
+func useMockScript(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	script, err := provider.LoadMockScript(path)
+	if err != nil {
+		return err
+	}
+	models.EnableMockModel()
+	agent.SetMockOptions(
+		[]provider.MockOption{provider.WithMockScript(script)},
+		[]provider.MockOption{provider.WithMockSubSessions(filepath.Dir(path))},
+	)
+	return nil
+}
+
+// useMockModel switches every agent to the mock model, without fallbacks.
+func useMockModel() {
+	cfg := config.Get()
+	cfg.Providers[models.ProviderMock] = config.Provider{APIKey: "replay"}
+	for name, agentCfg := range cfg.Agents {
+		agentCfg.Model = models.MockModel
+		agentCfg.Fallbacks = nil
+		cfg.Agents[name] = agentCfg
+	}
+}
+
+// replaySession runs the prompts in a new auto-approved session and returns
+// its ID.
+func replaySession(ctx context.Context, app *app.App, prompts []string) (string, error) {
+	sess, err := app.Sessions.Create(ctx, "Replay")
+	if err != nil {
+		return "", fmt.Errorf("failed to create session for replay: %w", err)
+	}
+	app.Permissions.AutoApproveSession(sess.ID)
+
+	for _, prompt := range prompts {
+		done, err := app.CoderAgent.Run(ctx, sess.ID, prompt)
+		if err != nil {
+			return "", fmt.Errorf("failed to start agent processing stream: %w", err)
+		}
+		if result := <-done; result.Error != nil {
+			return "", fmt.Errorf("replay failed: %w", result.Error)
+		}
+	}
+	return sess.ID, nil
+}
+
+// replayedSubSessions returns the messages of the sub-agent sessions that
+// replayed a cassette of dir, and adds the tool results recorded in those
+// cassettes to recorded.
+func replayedSubSessions(ctx context.Context, app *app.App, dir, sessionID string, recorded map[string]message.ToolResult) ([]message.Message, error) {
+	children, err := app.Sessions.ListChildren(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	var msgs []message.Message
+	for _, child := range children {
+		cassette, err := provider.LoadCassette(filepath.Join(dir, provider.SubSessionCassetteFile(child.ID)))
+		if err != nil {
+			// Not recorded, such as the title session
+			continue
+		}
+		maps.Copy(recorded, cassette.ToolResults())
+		childMsgs, err := app.Messages.List(ctx, child.ID)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, childMsgs...)
+	}
+	return msgs, nil
+}
+
+// reportToolResults prints how each recorded tool result compares with the
+// replayed one and returns the number that changed.
+func reportToolResults(recorded map[string]message.ToolResult, msgs []message.Message) int {
+	changed := 0
+	for _, msg := range msgs {
+		for _, call := range msg.ToolCalls() {
+			want, ok := recorded[call.ID]
+			if !ok {
+				continue
+			}
+			got, found := toolResult(msgs, call.ID)
+			switch {
+			case !found:
+				changed++
+				fmt.Printf("missing  %s %s\n", call.Name, call.ID)
+			case got.Content != want.Content || got.IsError != want.IsError:
+				changed++
+				fmt.Printf("changed  %s %s\n", call.Name, call.ID)
+				fmt.Printf("  recorded: %s\n", firstLines(want.Content, 5))
+				fmt.Printf("  replayed: %s\n", firstLines(got.Content, 5))
+			default:
+				fmt.Printf("same     %s %s\n", call.Name, call.ID)
+			}
+		}
+	}
+	return changed
+}
+
+func toolResult(msgs []message.Message, toolCallID string) (message.ToolResult, bool) {
+	for _, msg := range msgs {
+		for _, result := range msg.ToolResults() {
+			if result.ToolCallID == toolCallID {
+				return result, true
+			}
+		}
+	}
+	return message.ToolResult{}, false
+}
+
+// firstLines shortens s to its first n lines for the report.
+func firstLines(s string, n int) string {
+	lines := strings.SplitN(s, "\n", n+1)
+	if len(lines) > n {
+		return strings.Join(lines[:n], "\n") + "\n  ..."
+	}
+	return s
+}
+
+func init() {
+	replayCmd.Flags().BoolP("debug", "d", false, "Debug")
+	replayCmd.Flags().StringP("cwd", "c", "", "Current working directory")
+	replayCmd.Flags().BoolP("quiet", "q", false, "Hide spinner")
+
+	rootCmd.AddCommand(replayCmd)
+}
@@ -2,9 +2,15 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -14,6 +20,7 @@ import (
 	"github.com/opencode-ai/opencode/internal/db"
 	"github.com/opencode-ai/opencode/internal/format"
 	"github.com/opencode-ai/opencode/internal/llm/agent"
+	"github.com/opencode-ai/opencode/internal/llm/models"
 	"github.com/opencode-ai/opencode/internal/logging"
 	"github.com/opencode-ai/opencode/internal/pubsub"
 	"github.com/opencode-ai/opencode/internal/tui"
@@ -45,6 +52,26 @@ to assist developers in writing, debugging, and understanding code directly from
 
   # Run a single non-interactive prompt with JSON output format
   opencode -p "Explain the use of context in Go" -f json
+
+  # Run a single non-interactive prompt on a custom agent
+  opencode -p "Review the intro scene" --agent scene-reviewer
+
+  # Plan a change with read-only tools and execute it once approved
+  opencode -p "Split the intro scene into two scenes" --plan
+
+  # Continue the most recent session, or a given one
+  opencode -p "Now slow down the fade-in" --continue
+  opencode -p "Now slow down the fade-in" --session 1a2b3c4d-...
+
+  # Read the prompt from stdin and attach files to it
+  (echo "Review this diff"; git diff) | opencode -p -
+  opencode -p "Why is the circle cut off?" --attach render.png --attach src/scenes/intro.tsx
+
+  # Print what the run did, the exit code tells how it finished
+  opencode -p "Fix the failing render" -q --summary
+
+  # Run the Motion Canvas WebSocket backend
+  opencode serve
   `,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// If the help flag is set, show the help message
@@ -63,61 +90,71 @@ to assist developers in writing, debugging, and understanding code directly from
 		prompt, _ := cmd.Flags().GetString("prompt")
 		outputFormat, _ := cmd.Flags().GetString("output-format")
 		quiet, _ := cmd.Flags().GetBool("quiet")
+		agentName, _ := cmd.Flags().GetString("agent")
+		plan, _ := cmd.Flags().GetBool("plan")
+		sessionID, _ := cmd.Flags().GetString("session")
+		continueSession, _ := cmd.Flags().GetBool("continue")
+		attach, _ := cmd.Flags().GetStringArray("attach")
+		summary, _ := cmd.Flags().GetBool("summary")
 
 		// Validate format option
 		if !format.IsValid(outputFormat) {
 			return fmt.Errorf("invalid format option: %s\n%s", outputFormat, format.GetHelpText())
 		}
-
-		if cwd != "" {
-			err := os.Chdir(cwd)
-			if err != nil {
-				return fmt.Errorf("failed to change directory: %v", err)
+		if prompt == "" && (sessionID != "" || continueSession) {
+			return fmt.Errorf("--session and --continue need a prompt, pass it with -p")
+		}
+		if prompt == "" && len(attach) > 0 {
+			return fmt.Errorf("--attach needs a prompt, pass it with -p")
+		}
+		if prompt == "-" {
+			var err error
+			if prompt, err = readStdinPrompt(); err != nil {
+				return err
 			}
 		}
-		if cwd == "" {
-			c, err := os.Getwd()
+		// Attached paths are relative to where opencode was started, not to
+		// --cwd
+		for i, path := range attach {
+			absPath, err := filepath.Abs(path)
 			if err != nil {
-				return fmt.Errorf("failed to get current working directory: %v", err)
+				return fmt.Errorf("invalid attachment path %s: %w", path, err)
 			}
-			cwd = c
-		}
-		_, err := config.Load(cwd, debug)
-		if err != nil {
-			return err
+			attach[i] = absPath
 		}
 
-		// Initialize global logging
-		err = logging.InitGlobalLogging("testing_opencode.log")
-		if err != nil {
-			logging.Error("Failed to initialize global logging", "error", err)
-		}
-
-		// Connect DB, this will also run migrations
-		conn, err := db.Connect()
-		if err != nil {
-			return err
+		runOptions := app.RunOptions{
+			Prompt:       prompt,
+			Agent:        config.AgentName(agentName),
+			OutputFormat: outputFormat,
+			Quiet:        quiet,
+			Plan:         plan,
+			SessionID:    sessionID,
+			Continue:     continueSession,
+			Attachments:  attach,
+			Summary:      summary,
 		}
 
 		// Create main context for the application
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
 
-		app, err := app.New(ctx, conn)
+		app, err := setupApp(ctx, cwd, debug)
 		if err != nil {
-			logging.Error("Failed to create app: %v", err)
 			return err
 		}
 		// Defer shutdown here so it runs for both interactive and non-interactive modes
 		defer app.Shutdown()
 
-		// Initialize MCP tools early for both modes
-		initMCPTools(ctx, app)
-
 		// Non-interactive mode
 		if prompt != "" {
+			// The run's outcome is reported by its exit code, not the usage
+			cmd.SilenceUsage = true
+			// Interrupting cancels the run, which ends with the canceled exit code
+			runCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+			defer stop()
 			// Run non-interactive flow using the App method
-			return app.RunNonInteractive(ctx, prompt, outputFormat, quiet)
+			return app.RunNonInteractive(runCtx, runOptions)
 		}
 
 		// Interactive mode
@@ -189,6 +226,82 @@ to assist developers in writing, debugging, and understanding code directly from
 	},
 }
 
+// readStdinPrompt reads the prompt of `-p -` from standard input.
+func readStdinPrompt() (string, error) {
+	content, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the prompt from stdin: %w", err)
+	}
+	prompt := strings.TrimSpace(string(content))
+	if prompt == "" {
+		return "", fmt.Errorf("no prompt on stdin")
+	}
+	return prompt, nil
+}
+
+// setupApp loads the configuration for cwd, connects the database and creates
+// the app with its MCP tools. It is shared by every command that runs agents.
+func setupApp(ctx context.Context, cwd string, debug bool) (*app.App, error) {
+	// The script is resolved before changing to cwd
+	if path := os.Getenv(models.MockScriptEnv); path != "" {
+		if err := useMockScript(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := loadConfig(cwd, debug); err != nil {
+		return nil, err
+	}
+	return newApp(ctx)
+}
+
+// loadConfig changes to cwd and loads its configuration.
+func loadConfig(cwd string, debug bool) error {
+	if cwd != "" {
+		err := os.Chdir(cwd)
+		if err != nil {
+			return fmt.Errorf("failed to change directory: %v", err)
+		}
+	}
+	if cwd == "" {
+		c, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get current working directory: %v", err)
+		}
+		cwd = c
+	}
+	_, err := config.Load(cwd, debug)
+	if err != nil {
+		return err
+	}
+
+	// Initialize global logging
+	err = logging.InitGlobalLogging("testing_opencode.log")
+	if err != nil {
+		logging.Error("Failed to initialize global logging", "error", err)
+	}
+	return nil
+}
+
+// newApp connects the database of the loaded configuration and creates the
+// app with its MCP tools.
+func newApp(ctx context.Context) (*app.App, error) {
+	// Connect DB, this will also run migrations
+	conn, err := db.Connect()
+	if err != nil {
+		return nil, err
+	}
+
+	app, err := app.New(ctx, conn)
+	if err != nil {
+		logging.Error("Failed to create app: %v", err)
+		return nil, err
+	}
+
+	// Initialize MCP tools early for every mode
+	initMCPTools(ctx, app)
+	return app, nil
+}
+
 // attemptTUIRecovery tries to recover the TUI after a panic
 func attemptTUIRecovery(program *tea.Program) {
 	logging.Info("Attempting to recover TUI after panic")
@@ -262,7 +375,9 @@ func setupSubscriptions(app *app.App, parentCtx context.Context) (chan tea.Msg,
 	setupSubscriber(ctx, &wg, "sessions", app.Sessions.Subscribe, ch)
 	setupSubscriber(ctx, &wg, "messages", app.Messages.Subscribe, ch)
 	setupSubscriber(ctx, &wg, "permissions", app.Permissions.Subscribe, ch)
-	setupSubscriber(ctx, &wg, "coderAgent", app.CoderAgent.Subscribe, ch)
+	for name, a := range app.Agents {
+		setupSubscriber(ctx, &wg, string(name)+"Agent", a.Subscribe, ch)
+	}
 
 	cleanupFunc := func() {
 		logging.Info("Cancelling all subscriptions")
@@ -289,6 +404,10 @@ func setupSubscriptions(app *app.App, parentCtx context.Context) (chan tea.Msg,
 
 func Execute() {
 	err := rootCmd.Execute()
+	var exitErr *app.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.Code)
+	}
 	if err != nil {
 		os.Exit(1)
 	}
@@ -299,15 +418,32 @@ func init() {
 	rootCmd.Flags().BoolP("version", "v", false, "Version")
 	rootCmd.Flags().BoolP("debug", "d", false, "Debug")
 	rootCmd.Flags().StringP("cwd", "c", "", "Current working directory")
-	rootCmd.Flags().StringP("prompt", "p", "", "Prompt to run in non-interactive mode")
+	rootCmd.Flags().StringP("prompt", "p", "", "Prompt to run in non-interactive mode, - reads it from stdin")
 
 	// Add format flag with validation logic
 	rootCmd.Flags().StringP("output-format", "f", format.Text.String(),
-		"Output format for non-interactive mode (text, json)")
+		"Output format for non-interactive mode (text, json, stream-json)")
 
 	// Add quiet flag to hide spinner in non-interactive mode
 	rootCmd.Flags().BoolP("quiet", "q", false, "Hide spinner in non-interactive mode")
 
+	// Add agent flag to run the prompt on a custom agent
+	rootCmd.Flags().String("agent", "", "Agent to run the prompt in non-interactive mode, the coder by default")
+
+	// Add plan flag to plan with read-only tools before executing
+	rootCmd.Flags().Bool("plan", false, "Plan with read-only tools first and execute the plan once approved on the terminal")
+
+	// Add session flags to continue earlier sessions in non-interactive mode
+	rootCmd.Flags().String("session", "", "Run the prompt in an existing session in non-interactive mode")
+	rootCmd.Flags().Bool("continue", false, "Run the prompt in the most recent session of the project in non-interactive mode")
+	rootCmd.MarkFlagsMutuallyExclusive("session", "continue")
+
+	// Add attach flag to send files with the prompt in non-interactive mode
+	rootCmd.Flags().StringArray("attach", nil, "Image or text file to send with the prompt in non-interactive mode, repeatable")
+
+	// Add summary flag to report what a non-interactive run did
+	rootCmd.Flags().Bool("summary", false, "Print the finish reason, files changed, tool calls, tokens and cost of a non-interactive run")
+
 	// Register custom validation for the format flag
 	rootCmd.RegisterFlagCompletionFunc("output-format", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 		return format.SupportedFormats, cobra.ShellCompDirectiveNoFileComp
@@ -77,6 +77,13 @@ func generateSchema() map[string]any {
 		"default":     false,
 	}
 
+	schema["properties"].(map[string]any)["parallelTools"] = map[string]any{
+		"type":        "integer",
+		"description": "Maximum number of read-only tool calls (glob, grep, ls, view, sourcegraph, fetch, agent) run concurrently, 1 runs them one by one",
+		"default":     4,
+		"minimum":     1,
+	}
+
 	schema["properties"].(map[string]any)["contextPaths"] = map[string]any{
 		"type":        "array",
 		"description": "Context paths for the application",
@@ -121,6 +128,56 @@ func generateSchema() map[string]any {
 		},
 	}
 
+	// Add server configuration
+	schema["properties"].(map[string]any)["server"] = map[string]any{
+		"type":        "object",
+		"description": "HTTP/WebSocket server configuration",
+		"properties": map[string]any{
+			"address": map[string]any{
+				"type":        "string",
+				"description": "Address the server listens on",
+				"default":     ":3000",
+			},
+			"allowedOrigins": map[string]any{
+				"type":        "array",
+				"description": "Browser origins allowed to connect, \"*\" allows any origin",
+				"items": map[string]any{
+					"type": "string",
+				},
+				"default": []string{"http://localhost:9000", "http://127.0.0.1:9000"},
+			},
+			"authToken": map[string]any{
+				"type":        "string",
+				"description": "Shared secret required as a bearer token or token query parameter on /ws and the REST API",
+			},
+			"tlsCertFile": map[string]any{
+				"type":        "string",
+				"description": "Path to the TLS certificate, enables HTTPS together with tlsKeyFile",
+			},
+			"tlsKeyFile": map[string]any{
+				"type":        "string",
+				"description": "Path to the TLS private key",
+			},
+		},
+	}
+
+	// Add icons configuration
+	schema["properties"].(map[string]any)["icons"] = map[string]any{
+		"type":        "object",
+		"description": "Lucide icon configuration for the lucid_icons tool",
+		"properties": map[string]any{
+			"cacheDir": map[string]any{
+				"type":        "string",
+				"description": "Directory of Lucide SVG icons, defaults to <data.directory>/icons/lucide",
+			},
+			"publicDir": map[string]any{
+				"type":        "string",
+				"description": "Directory resolved icons are copied to",
+				"default":     "frontend/public/icons",
+			},
+		},
+	}
+
 	// Add MCP servers
 	schema["properties"].(map[string]any)["mcpServers"] = map[string]any{
 		"type":        "object",
@@ -232,8 +289,48 @@ func generateSchema() map[string]any {
 					"description": "Reasoning effort for models that support it (OpenAI, Anthropic)",
 					"enum":        []string{"low", "medium", "high"},
 				},
+				"fallbacks": map[string]any{
+					"type":        "array",
+					"description": "Models tried in order when the model fails",
+					"items": map[string]any{
+						"type": "string",
+					},
+				},
+				"maxSteps": map[string]any{
+					"type":        "integer",
+					"description": "Maximum tool-use iterations per user turn, 0 for no limit",
+					"minimum":     0,
+				},
+				"maxCost": map[string]any{
+					"type":        "number",
+					"description": "Maximum cost of a session in USD, 0 for no limit",
+					"minimum":     0,
+				},
+				"maxRepeatedToolCalls": map[string]any{
+					"type":        "integer",
+					"description": "Maximum identical tool calls (same name and input) in a row, 0 for no limit",
+					"minimum":     0,
+				},
+				"description": map[string]any{
+					"type":        "string",
+					"description": "Description of a custom agent, shown when selecting it",
+				},
+				"prompt": map[string]any{
+					"type":        "string",
+					"description": "File with the system prompt of a custom agent, relative to the working directory",
+				},
+				"tools": map[string]any{
+					"type":        "array",
+					"description": "Tools the custom agent may use, all tools when empty",
+					"items": map[string]any{
+						"type": "string",
+					},
+				},
+				"subagent": map[string]any{
+					"type":        "boolean",
+					"description": "Offer the custom agent to the agent tool as a sub-agent",
+				},
 			},
-			"required": []string{"model"},
 		},
 	}
 
@@ -242,7 +339,9 @@ func generateSchema() map[string]any {
 	for modelID := range models.SupportedModels {
 		modelEnum = append(modelEnum, string(modelID))
 	}
-	agentSchema["additionalProperties"].(map[string]any)["properties"].(map[string]any)["model"].(map[string]any)["enum"] = modelEnum
+	agentSchemaProperties := agentSchema["additionalProperties"].(map[string]any)["properties"].(map[string]any)
+	agentSchemaProperties["model"].(map[string]any)["enum"] = modelEnum
+	agentSchemaProperties["fallbacks"].(map[string]any)["items"].(map[string]any)["enum"] = modelEnum
 
 	// Add specific agent properties
 	agentProperties := map[string]any{}
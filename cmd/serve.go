@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/opencode-ai/opencode/internal/config"
+	"github.com/opencode-ai/opencode/internal/logging"
+	"github.com/opencode-ai/opencode/internal/server"
+	"github.com/spf13/cobra"
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run the Motion Canvas WebSocket backend",
+	Long: `Serve runs the HTTP/WebSocket backend used by the Motion Canvas chat overlay.
+It uses the same configuration, database and MCP tools as the interactive mode.
+The listen address, allowed origins, auth token and TLS files are read from the
+"server" section of the configuration.`,
+	Example: `
+  # Serve on the configured address (default :3000)
+  opencode serve
+
+  # Serve a specific project on another port
+  opencode serve -c /path/to/project --port 4000
+
+  # Skip permission prompts in the browser (trusted local use only)
+  opencode serve --auto-approve
+  `,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		debug, _ := cmd.Flags().GetBool("debug")
+		cwd, _ := cmd.Flags().GetString("cwd")
+		port, _ := cmd.Flags().GetInt("port")
+		autoApprove, _ := cmd.Flags().GetBool("auto-approve")
+
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		app, err := setupApp(ctx, cwd, debug)
+		if err != nil {
+			return err
+		}
+		defer app.Shutdown()
+
+		serverCfg := config.Get().Server
+		if cmd.Flags().Changed("port") {
+			serverCfg.Address, err = withPort(serverCfg.Address, port)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = server.New(ctx, app, serverCfg, autoApprove).Serve(ctx)
+		logging.Info("Server stopped", "error", err)
+		return err
+	},
+}
+
+// withPort replaces the port of a listen address, keeping its host.
+func withPort(address string, port int) (string, error) {
+	if port <= 0 || port > 65535 {
+		return "", fmt.Errorf("invalid port: %d", port)
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = ""
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port)), nil
+}
+
+func init() {
+	serveCmd.Flags().BoolP("debug", "d", false, "Debug")
+	serveCmd.Flags().StringP("cwd", "c", "", "Current working directory")
+	serveCmd.Flags().IntP("port", "P", 3000, "Port to listen on, overrides server.address")
+	serveCmd.Flags().Bool("auto-approve", false, "Approve every tool permission request without asking the WebSocket client")
+
+	rootCmd.AddCommand(serveCmd)
+}
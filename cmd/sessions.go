@@ -0,0 +1,267 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/opencode-ai/opencode/internal/db"
+	"github.com/opencode-ai/opencode/internal/history"
+	"github.com/opencode-ai/opencode/internal/message"
+	"github.com/opencode-ai/opencode/internal/session"
+	"github.com/opencode-ai/opencode/internal/transcript"
+	"github.com/spf13/cobra"
+)
+
+// Formats of sessions export.
+const (
+	exportMarkdown = "markdown"
+	exportJSON     = "json"
+)
+
+var sessionsCmd = &cobra.Command{
+	Use:   "sessions",
+	Short: "List, show, export, import and delete the sessions of a project",
+	Long: `Sessions browses the sessions stored in the project's database without
+starting the TUI. Sessions of sub-agents are listed under the session whose
+agent tool call ran them.`,
+	Example: `
+  # List the sessions of the project
+  opencode sessions list
+
+  # Read a transcript with its tool calls
+  opencode sessions show 1a2b3c4d-...
+
+  # Archive a transcript in the repository
+  opencode sessions export 1a2b3c4d-... -o docs/transcripts/intro-scene.md
+  opencode sessions export 1a2b3c4d-... -f json -o intro-scene.json
+
+  # Pick up a session exported on another machine
+  opencode sessions import intro-scene.json
+
+  # Delete a session with its messages and file history
+  opencode sessions delete 1a2b3c4d-...
+  `,
+}
+
+var sessionsListCmd = &cobra.Command{
+	Use:          "list",
+	Short:        "List the sessions with their sub-agent sessions",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		svc, err := openSessions(cmd)
+		if err != nil {
+			return err
+		}
+		ctx := cmd.Context()
+		sessions, err := svc.Sessions.List(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list sessions: %w", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tTITLE\tCREATED\tUPDATED\tMESSAGES\tCOST")
+		for _, sess := range sessions {
+			if err := listSession(ctx, w, svc.Sessions, sess, ""); err != nil {
+				return err
+			}
+		}
+		return w.Flush()
+	},
+}
+
+var sessionsShowCmd = &cobra.Command{
+	Use:          "show <session-id>",
+	Short:        "Print the transcript of a session with its tool calls",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		svc, err := openSessions(cmd)
+		if err != nil {
+			return err
+		}
+		export, err := transcript.Load(cmd.Context(), svc, args[0])
+		if err != nil {
+			return err
+		}
+		return transcript.WriteText(os.Stdout, export)
+	},
+}
+
+var sessionsExportCmd = &cobra.Command{
+	Use:   "export <session-id>",
+	Short: "Export a session as Markdown or JSON",
+	Long: `Export writes a session with its tool inputs and results and its sub-agent
+sessions. The Markdown format is meant to be read, the JSON format keeps every
+message part and file version.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		exportFormat, _ := cmd.Flags().GetString("format")
+		output, _ := cmd.Flags().GetString("output")
+		if exportFormat != exportMarkdown && exportFormat != exportJSON {
+			return fmt.Errorf("invalid export format: %s, use %s or %s", exportFormat, exportMarkdown, exportJSON)
+		}
+		// The output is relative to where opencode was started, not to --cwd
+		if output != "" {
+			var err error
+			if output, err = filepath.Abs(output); err != nil {
+				return err
+			}
+		}
+
+		svc, err := openSessions(cmd)
+		if err != nil {
+			return err
+		}
+		export, err := transcript.Load(cmd.Context(), svc, args[0])
+		if err != nil {
+			return err
+		}
+
+		var w io.Writer = os.Stdout
+		if output != "" {
+			f, err := os.Create(output)
+			if err != nil {
+				return fmt.Errorf("failed to create %s: %w", output, err)
+			}
+			defer f.Close()
+			w = f
+		}
+		if exportFormat == exportJSON {
+			err = transcript.WriteJSON(w, export)
+		} else {
+			err = transcript.WriteMarkdown(w, export)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write the export: %w", err)
+		}
+		if output != "" {
+			fmt.Fprintf(os.Stderr, "Exported session %s to %s\n", export.Session.ID, output)
+		}
+		return nil
+	},
+}
+
+var sessionsImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Import a session exported as JSON",
+	Long: `Import recreates a session from a JSON export, with its messages, file
+history and sub-agent sessions. The imported session gets new IDs, continue it
+with opencode --session <id>. Pass - to read the export from standard input.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var r io.Reader = os.Stdin
+		if args[0] != "-" {
+			// Opened before --cwd changes the working directory
+			f, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			r = f
+		}
+		export, err := transcript.ReadJSON(r)
+		if err != nil {
+			return err
+		}
+
+		svc, err := openSessions(cmd)
+		if err != nil {
+			return err
+		}
+		sess, err := transcript.Import(cmd.Context(), svc, export)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Imported session %s (%s)\n", sess.ID, sess.Title)
+		return nil
+	},
+}
+
+var sessionsDeleteCmd = &cobra.Command{
+	Use:          "delete <session-id>...",
+	Short:        "Delete sessions with their messages, file history and sub-agent sessions",
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		svc, err := openSessions(cmd)
+		if err != nil {
+			return err
+		}
+		ctx := cmd.Context()
+		for _, id := range args {
+			sess, err := svc.Sessions.Get(ctx, id)
+			if err != nil {
+				return fmt.Errorf("session not found: %s", id)
+			}
+			if err := transcript.Delete(ctx, svc, sess.ID); err != nil {
+				return err
+			}
+			fmt.Printf("Deleted session %s (%s)\n", sess.ID, sess.Title)
+		}
+		return nil
+	},
+}
+
+// openSessions loads the configuration and connects the database. Browsing
+// sessions doesn't need the agents, LSP clients and MCP tools of the app.
+func openSessions(cmd *cobra.Command) (transcript.Services, error) {
+	debug, _ := cmd.Flags().GetBool("debug")
+	cwd, _ := cmd.Flags().GetString("cwd")
+	if err := loadConfig(cwd, debug); err != nil {
+		return transcript.Services{}, err
+	}
+	conn, err := db.Connect()
+	if err != nil {
+		return transcript.Services{}, err
+	}
+	q := db.New(conn)
+	return transcript.Services{
+		Sessions: session.NewService(q),
+		Messages: message.NewService(q),
+		History:  history.NewService(q, conn),
+	}, nil
+}
+
+// listSession writes a row for the session, followed by its sub-agent
+// sessions.
+func listSession(ctx context.Context, w io.Writer, sessions session.Service, sess session.Session, prefix string) error {
+	title := []rune(sess.Title)
+	if len(title) > 60 {
+		title = append(title[:57], []rune("...")...)
+	}
+	fmt.Fprintf(w, "%s%s\t%s\t%s\t%s\t%d\t$%.4f\n", prefix, sess.ID, string(title),
+		transcript.FormatTime(sess.CreatedAt), transcript.FormatTime(sess.UpdatedAt), sess.MessageCount, sess.Cost)
+
+	children, err := sessions.ListChildren(ctx, sess.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list the sub-agent sessions of %s: %w", sess.ID, err)
+	}
+	childPrefix := "└ "
+	if prefix != "" {
+		childPrefix = strings.Repeat(" ", len([]rune(prefix))) + "└ "
+	}
+	for _, child := range children {
+		if err := listSession(ctx, w, sessions, child, childPrefix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func init() {
+	sessionsCmd.PersistentFlags().BoolP("debug", "d", false, "Debug")
+	sessionsCmd.PersistentFlags().StringP("cwd", "c", "", "Current working directory")
+	sessionsExportCmd.Flags().StringP("format", "f", exportMarkdown, "Export format (markdown, json)")
+	sessionsExportCmd.Flags().StringP("output", "o", "", "File to write the export to, standard output by default")
+
+	sessionsCmd.AddCommand(sessionsListCmd, sessionsShowCmd, sessionsExportCmd, sessionsImportCmd, sessionsDeleteCmd)
+	rootCmd.AddCommand(sessionsCmd)
+}
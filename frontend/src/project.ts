@@ -1,13 +1,13 @@
 import {makeProject} from '@motion-canvas/core';
 
 // Dynamic import wrapper to catch errors
-async function loadExampleScene() {
-  console.log('Loading example scene...');
+async function loadScene(name: string, load: () => Promise<{default: any}>) {
+  console.log(`Loading ${name} scene...`);
   try {
-    const module = await import('./scenes/example?scene');
+    const module = await load();
     return module.default;
   } catch (error) {
-    console.error('Error importing example scene:', error);
+    console.error(`Error importing ${name} scene:`, error);
     // Return a fallback scene
     return function* (view) {
       view.fill('#ff0000'); // Red background to indicate error
@@ -16,7 +16,13 @@ async function loadExampleScene() {
   }
 }
 
-const example = await loadExampleScene();
+const example = await loadScene('example', () => import('./scenes/example?scene'));
+
+// Scenes generated over the WebSocket are registered by `opencode serve`
+// between the markers below, keep them in place.
+const generatedScenes = [];
+// opencode:scenes:start
+// opencode:scenes:end
 
 // Initialize chat integration
 import { getChatInstance } from './plugins/chat/ChatIntegration';
@@ -37,5 +43,5 @@ if (typeof window !== 'undefined') {
 }
 
 export default makeProject({
-  scenes: [example],
+  scenes: [example, ...generatedScenes],
 });
@@ -33,7 +33,7 @@ require (
 	github.com/stretchr/testify v1.10.0
 )
 
-require github.com/go-chi/chi/v5 v5.2.2 // indirect
+require github.com/go-chi/chi/v5 v5.2.2
 
 require (
 	cloud.google.com/go v0.116.0 // indirect
@@ -77,7 +77,7 @@ require (
 	github.com/googleapis/enterprise-certificate-proxy v0.3.4 // indirect
 	github.com/googleapis/gax-go/v2 v2.14.1 // indirect
 	github.com/gorilla/css v1.0.1 // indirect
-	github.com/gorilla/websocket v1.5.3 // indirect
+	github.com/gorilla/websocket v1.5.3
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/kylelemons/godebug v1.1.0 // indirect
 	github.com/lithammer/fuzzysearch v1.1.8
@@ -0,0 +1,87 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/opencode-ai/opencode/internal/config"
+	"github.com/opencode-ai/opencode/internal/llm/agent"
+)
+
+// newAgent creates an agent that runs user sessions with the coder's tools,
+// narrowed by the agent's allowlist.
+func (app *App) newAgent(name config.AgentName) (agent.Service, error) {
+	return agent.NewAgent(
+		name,
+		app.Sessions,
+		app.Messages,
+		agent.CoderAgentTools(
+			app.Permissions,
+			app.Sessions,
+			app.Messages,
+			app.History,
+			app.LSPClients,
+		),
+	)
+}
+
+// Agent returns the agent of the given name, the coder when the name is
+// empty.
+func (app *App) Agent(name config.AgentName) (agent.Service, error) {
+	if name == "" {
+		return app.CoderAgent, nil
+	}
+	a, ok := app.Agents[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown agent: %s", name)
+	}
+	return a, nil
+}
+
+// AgentNames returns the agents a session can run, the coder first.
+func (app *App) AgentNames() []config.AgentName {
+	return append([]config.AgentName{config.AgentCoder}, config.CustomAgents()...)
+}
+
+// IsBusy reports whether any agent is working.
+func (app *App) IsBusy() bool {
+	for _, a := range app.Agents {
+		if a.IsBusy() {
+			return true
+		}
+	}
+	return false
+}
+
+// IsSessionBusy reports whether any agent is working on the session.
+func (app *App) IsSessionBusy(sessionID string) bool {
+	for _, a := range app.Agents {
+		if a.IsSessionBusy(sessionID) {
+			return true
+		}
+	}
+	return false
+}
+
+// Cancel stops the generation of the session, whichever agent runs it.
+func (app *App) Cancel(sessionID string) {
+	for _, a := range app.Agents {
+		a.Cancel(sessionID)
+	}
+}
+
+// SetPlanMode switches plan mode of the session, for whichever agent runs it.
+func (app *App) SetPlanMode(sessionID string, enabled bool) {
+	for _, a := range app.Agents {
+		a.SetPlanMode(sessionID, enabled)
+	}
+}
+
+// PlanMode reports whether the session is in plan mode.
+func (app *App) PlanMode(sessionID string) bool {
+	for _, a := range app.Agents {
+		if a.PlanMode(sessionID) {
+			return true
+		}
+	}
+	return false
+}
@@ -3,9 +3,9 @@ package app
 import (
 	"context"
 	"database/sql"
-	"errors"
 	"fmt"
 	"maps"
+	"os"
 	"sync"
 	"time"
 
@@ -29,6 +29,9 @@ type App struct {
 	Permissions permission.Service
 
 	CoderAgent agent.Service
+	// Agents are the agents a session can run: the coder and the custom
+	// agents of the configuration
+	Agents map[config.AgentName]agent.Service
 
 	LSPClients map[string]*lsp.Client
 
@@ -60,22 +63,19 @@ func New(ctx context.Context, conn *sql.DB) (*App, error) {
 	go app.initLSPClients(ctx)
 
 	var err error
-	app.CoderAgent, err = agent.NewAgent(
-		config.AgentCoder,
-		app.Sessions,
-		app.Messages,
-		agent.CoderAgentTools(
-			app.Permissions,
-			app.Sessions,
-			app.Messages,
-			app.History,
-			app.LSPClients,
-		),
-	)
+	app.CoderAgent, err = app.newAgent(config.AgentCoder)
 	if err != nil {
 		logging.Error("Failed to create coder agent", err)
 		return nil, err
 	}
+	app.Agents = map[config.AgentName]agent.Service{config.AgentCoder: app.CoderAgent}
+	for _, name := range config.CustomAgents() {
+		app.Agents[name], err = app.newAgent(name)
+		if err != nil {
+			logging.Error("Failed to create agent", "agent", name, "error", err)
+			return nil, fmt.Errorf("failed to create agent %s: %w", name, err)
+		}
+	}
 
 	return app, nil
 }
@@ -96,68 +96,233 @@ func (app *App) initTheme() {
 	}
 }
 
+// RunOptions configures a non-interactive run.
+type RunOptions struct {
+	Prompt string
+	// Agent runs the prompt, the coder when empty
+	Agent        config.AgentName
+	OutputFormat string
+	Quiet        bool
+	// Plan makes the agent plan first, the plan is executed once approved
+	Plan bool
+	// SessionID runs the prompt in an existing session, Continue in the most
+	// recent one. A new session is created otherwise.
+	SessionID string
+	Continue  bool
+	// Attachments are files sent with the prompt: images as attachments,
+	// text files as part of the prompt
+	Attachments []string
+	// Summary prints what the run did once it ends
+	Summary bool
+}
+
 // RunNonInteractive handles the execution flow when a prompt is provided via CLI flag.
-func (a *App) RunNonInteractive(ctx context.Context, prompt string, outputFormat string, quiet bool) error {
-	logging.Info("Running in non-interactive mode")
+func (a *App) RunNonInteractive(ctx context.Context, opts RunOptions) error {
+	logging.Info("Running in non-interactive mode", "agent", opts.Agent)
+	runAgent, err := a.Agent(opts.Agent)
+	if err != nil {
+		return err
+	}
+	prompt, attachments, err := attachFiles(opts.Prompt, opts.Attachments, runAgent.Model())
+	if err != nil {
+		return err
+	}
 
-	// Start spinner if not in quiet mode
-	var spinner *format.Spinner
-	if !quiet {
-		spinner = format.NewSpinner("Thinking...")
-		spinner.Start()
-		defer spinner.Stop()
+	sess, err := a.runSession(ctx, opts)
+	if err != nil {
+		return err
+	}
+	// Scripts continue the session with --session, the JSON formats carry
+	// its ID instead
+	outputFormat, _ := format.Parse(opts.OutputFormat)
+	if outputFormat == format.Text {
+		fmt.Fprintf(os.Stderr, "session_id: %s\n", sess.ID)
+	}
+
+	// Automatically approve all permission requests for this non-interactive session
+	a.Permissions.AutoApproveSession(sess.ID)
+
+	// The stream-json format reports progress as it happens instead of
+	// printing the response at the end
+	var stream *outputStream
+	if outputFormat == format.StreamJSON {
+		agentName := opts.Agent
+		if agentName == "" {
+			agentName = config.AgentCoder
+		}
+		stream = a.newOutputStream(ctx, os.Stdout, runAgent, sess, string(agentName))
+		defer stream.close()
+	}
+
+	spinnerMessage := "Thinking..."
+	if opts.Plan {
+		runAgent.SetPlanMode(sess.ID, true)
+		spinnerMessage = "Planning..."
+	}
+	var start runStart
+	if opts.Summary {
+		if start, err = a.startSummary(ctx, sess); err != nil {
+			return err
+		}
+	}
+	result, err := runTurn(opts.Quiet, spinnerMessage, func() (<-chan agent.AgentEvent, error) {
+		return runAgent.Run(ctx, sess.ID, prompt, attachments...)
+	})
+	if err != nil {
+		return err
+	}
+	if stream != nil {
+		stream.result(result, opts.Plan)
+	}
+
+	// Only a complete plan is offered for execution
+	printResponse := result.Error == nil
+	if opts.Plan && runFinishReason(result) == message.FinishReasonEndTurn {
+		plan := result.Message.Content().String()
+		if stream == nil {
+			fmt.Println(format.FormatOutput(plan, opts.OutputFormat, sess.ID, nil))
+		}
+
+		approved, err := approvePlan(plan)
+		if err != nil {
+			return err
+		}
+		if approved == "" {
+			logging.Info("Plan not approved", "session_id", sess.ID)
+			printResponse = false
+		} else {
+			result, err = runTurn(opts.Quiet, "Executing plan...", func() (<-chan agent.AgentEvent, error) {
+				return runAgent.ExecutePlan(ctx, sess.ID, approved)
+			})
+			if err != nil {
+				return err
+			}
+			if stream != nil {
+				stream.result(result, false)
+			}
+			printResponse = result.Error == nil
+		}
+	}
+
+	exitErr := runExitError(result)
+	var summary *runSummary
+	if opts.Summary {
+		s := a.summarize(start, runFinishReason(result), exitCode(exitErr))
+		summary = &s
+	}
+
+	switch outputFormat {
+	case format.StreamJSON:
+		if summary != nil {
+			// Stop the stream so the summary is its last event
+			stream.close()
+			stream.write(streamEvent{Type: streamEventSummary, Summary: summary})
+		}
+	case format.JSON:
+		// The summary is printed even when there is no response
+		if printResponse || summary != nil {
+			var summaryOutput any
+			if summary != nil {
+				summaryOutput = summary
+			}
+			fmt.Println(format.FormatOutput(responseContent(result), opts.OutputFormat, sess.ID, summaryOutput))
+		}
+	default:
+		if printResponse {
+			fmt.Println(format.FormatOutput(responseContent(result), opts.OutputFormat, sess.ID, nil))
+		}
+		if summary != nil {
+			summary.write(os.Stderr)
+		}
+	}
+
+	if exitErr != nil {
+		logging.Info("Non-interactive run stopped", "session_id", sess.ID, "error", exitErr)
+		return exitErr
+	}
+	logging.Info("Non-interactive run completed", "session_id", sess.ID)
+	return nil
+}
+
+// responseContent returns the text content of the response.
+func responseContent(result agent.AgentEvent) string {
+	if content := result.Message.Content().String(); content != "" {
+		return content
+	}
+	return "No content available"
+}
+
+// runSession returns the session a non-interactive run works in.
+func (a *App) runSession(ctx context.Context, opts RunOptions) (session.Session, error) {
+	switch {
+	case opts.SessionID != "":
+		sess, err := a.Sessions.Get(ctx, opts.SessionID)
+		if err != nil {
+			return session.Session{}, fmt.Errorf("session not found: %s", opts.SessionID)
+		}
+		if sess.ParentSessionID != "" {
+			return session.Session{}, fmt.Errorf("session %s belongs to a sub-agent of session %s", sess.ID, sess.ParentSessionID)
+		}
+		logging.Info("Continuing session in non-interactive mode", "session_id", sess.ID)
+		return sess, nil
+	case opts.Continue:
+		sessions, err := a.Sessions.List(ctx)
+		if err != nil {
+			return session.Session{}, fmt.Errorf("failed to list sessions: %w", err)
+		}
+		if len(sessions) == 0 {
+			return session.Session{}, fmt.Errorf("no session to continue in this project")
+		}
+		latest := latestSession(sessions)
+		logging.Info("Continuing the latest session in non-interactive mode", "session_id", latest.ID)
+		return latest, nil
 	}
 
 	const maxPromptLengthForTitle = 100
 	titlePrefix := "Non-interactive: "
 	var titleSuffix string
 
-	if len(prompt) > maxPromptLengthForTitle {
-		titleSuffix = prompt[:maxPromptLengthForTitle] + "..."
+	if len(opts.Prompt) > maxPromptLengthForTitle {
+		titleSuffix = opts.Prompt[:maxPromptLengthForTitle] + "..."
 	} else {
-		titleSuffix = prompt
+		titleSuffix = opts.Prompt
 	}
 	title := titlePrefix + titleSuffix
 
 	sess, err := a.Sessions.Create(ctx, title)
 	if err != nil {
-		return fmt.Errorf("failed to create session for non-interactive mode: %w", err)
+		return session.Session{}, fmt.Errorf("failed to create session for non-interactive mode: %w", err)
 	}
 	logging.Info("Created session for non-interactive run", "session_id", sess.ID)
+	return sess, nil
+}
 
-	// Automatically approve all permission requests for this non-interactive session
-	a.Permissions.AutoApproveSession(sess.ID)
-
-	done, err := a.CoderAgent.Run(ctx, sess.ID, prompt)
-	if err != nil {
-		return fmt.Errorf("failed to start agent processing stream: %w", err)
-	}
-
-	result := <-done
-	if result.Error != nil {
-		if errors.Is(result.Error, context.Canceled) || errors.Is(result.Error, agent.ErrRequestCancelled) {
-			logging.Info("Agent processing cancelled", "session_id", sess.ID)
-			return nil
+// latestSession returns the session last worked on. Sessions are listed
+// newest first, so the newest one wins a tie.
+func latestSession(sessions []session.Session) session.Session {
+	latest := sessions[0]
+	for _, sess := range sessions[1:] {
+		if sess.UpdatedAt > latest.UpdatedAt {
+			latest = sess
 		}
-		return fmt.Errorf("agent processing failed: %w", result.Error)
 	}
+	return latest
+}
 
-	// Stop spinner before printing output
-	if !quiet && spinner != nil {
-		spinner.Stop()
+// runTurn runs one turn of a non-interactive run and waits for its result,
+// showing a spinner unless quiet.
+func runTurn(quiet bool, spinnerMessage string, run func() (<-chan agent.AgentEvent, error)) (agent.AgentEvent, error) {
+	if !quiet {
+		spinner := format.NewSpinner(spinnerMessage)
+		spinner.Start()
+		defer spinner.Stop()
 	}
 
-	// Get the text content from the response
-	content := "No content available"
-	if result.Message.Content().String() != "" {
-		content = result.Message.Content().String()
+	done, err := run()
+	if err != nil {
+		return agent.AgentEvent{}, fmt.Errorf("failed to start agent processing stream: %w", err)
 	}
-
-	fmt.Println(format.FormatOutput(content, outputFormat))
-
-	logging.Info("Non-interactive run completed", "session_id", sess.ID)
-
-	return nil
+	return <-done, nil
 }
 
 // Shutdown performs a clean shutdown of the application
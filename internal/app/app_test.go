@@ -0,0 +1,117 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencode-ai/opencode/internal/config"
+	"github.com/opencode-ai/opencode/internal/db"
+	"github.com/opencode-ai/opencode/internal/llm/agent"
+	"github.com/opencode-ai/opencode/internal/llm/models"
+	"github.com/opencode-ai/opencode/internal/message"
+	"github.com/opencode-ai/opencode/internal/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunSession(t *testing.T) {
+	workDir := t.TempDir()
+	_, err := config.Load(workDir, false)
+	require.NoError(t, err)
+	// The config is loaded once per process, point it at this test's dirs
+	config.Get().WorkingDir = workDir
+	config.Get().Data.Directory = t.TempDir()
+	conn, err := db.Connect()
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	a := &App{Sessions: session.NewService(db.New(conn))}
+	ctx := context.Background()
+
+	_, err = a.runSession(ctx, RunOptions{Continue: true})
+	assert.EqualError(t, err, "no session to continue in this project")
+
+	first, err := a.runSession(ctx, RunOptions{Prompt: "Draw a circle"})
+	require.NoError(t, err)
+	assert.Equal(t, "Non-interactive: Draw a circle", first.Title)
+	second, err := a.Sessions.Create(ctx, "second")
+	require.NoError(t, err)
+	_, err = a.Sessions.CreateTaskSession(ctx, "call-1", first.ID, "task")
+	require.NoError(t, err)
+
+	latest, err := a.runSession(ctx, RunOptions{Continue: true})
+	require.NoError(t, err)
+	assert.Contains(t, []string{first.ID, second.ID}, latest.ID, "sub-agent sessions are not continued")
+
+	sess, err := a.runSession(ctx, RunOptions{SessionID: second.ID})
+	require.NoError(t, err)
+	assert.Equal(t, second.ID, sess.ID)
+	_, err = a.runSession(ctx, RunOptions{SessionID: "call-1"})
+	assert.ErrorContains(t, err, "belongs to a sub-agent")
+	_, err = a.runSession(ctx, RunOptions{SessionID: "missing"})
+	assert.EqualError(t, err, "session not found: missing")
+}
+
+func TestLatestSession(t *testing.T) {
+	sessions := []session.Session{
+		{ID: "newest", CreatedAt: 30, UpdatedAt: 40},
+		{ID: "worked on", CreatedAt: 20, UpdatedAt: 50},
+		{ID: "oldest", CreatedAt: 10, UpdatedAt: 50},
+	}
+	assert.Equal(t, "worked on", latestSession(sessions).ID)
+	assert.Equal(t, "newest", latestSession(sessions[:1]).ID)
+}
+
+func TestAttachFiles(t *testing.T) {
+	dir := t.TempDir()
+	png := filepath.Join(dir, "render.png")
+	require.NoError(t, os.WriteFile(png, []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), 0o644))
+	diff := filepath.Join(dir, "change.diff")
+	require.NoError(t, os.WriteFile(diff, []byte("-old\n+new\n"), 0o644))
+	pdf := filepath.Join(dir, "doc.pdf")
+	require.NoError(t, os.WriteFile(pdf, []byte("%PDF-1.7"), 0o644))
+
+	prompt, attachments, err := attachFiles("Why?", []string{png, diff}, models.Model{SupportsAttachments: true})
+	require.NoError(t, err)
+	assert.Equal(t, "Why?\n\n<attachment path=\""+diff+"\">\n-old\n+new\n</attachment>", prompt)
+	require.Len(t, attachments, 1)
+	assert.Equal(t, "image/png", attachments[0].MimeType)
+	assert.Equal(t, "render.png", attachments[0].FileName)
+
+	_, _, err = attachFiles("Why?", []string{png}, models.Model{Name: "text-only"})
+	assert.ErrorContains(t, err, "doesn't support attachments")
+	_, _, err = attachFiles("Why?", []string{pdf}, models.Model{SupportsAttachments: true})
+	assert.ErrorContains(t, err, "unsupported attachment")
+	_, _, err = attachFiles("Why?", []string{filepath.Join(dir, "missing.txt")}, models.Model{})
+	assert.Error(t, err)
+}
+
+func TestRunExitError(t *testing.T) {
+	finished := func(reason message.FinishReason) agent.AgentEvent {
+		msg := message.Message{Role: message.Assistant}
+		msg.AddFinish(reason)
+		return agent.AgentEvent{Type: agent.AgentEventTypeResponse, Message: msg}
+	}
+	tests := []struct {
+		name   string
+		result agent.AgentEvent
+		reason message.FinishReason
+		code   int
+	}{
+		{"end turn", finished(message.FinishReasonEndTurn), message.FinishReasonEndTurn, ExitCodeOK},
+		{"max tokens", finished(message.FinishReasonMaxTokens), message.FinishReasonMaxTokens, ExitCodeMaxTokens},
+		{"permission denied", finished(message.FinishReasonPermissionDenied), message.FinishReasonPermissionDenied, ExitCodePermissionDenied},
+		{"limit reached", agent.AgentEvent{Error: fmt.Errorf("%w: 3 steps", agent.ErrLimitReached)}, message.FinishReasonLimitReached, ExitCodeLimitReached},
+		{"canceled", agent.AgentEvent{Error: agent.ErrRequestCancelled}, message.FinishReasonCanceled, ExitCodeCanceled},
+		{"error", agent.AgentEvent{Error: errors.New("boom")}, message.FinishReasonError, ExitCodeError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.reason, runFinishReason(tt.result))
+			assert.Equal(t, tt.code, exitCode(runExitError(tt.result)))
+		})
+	}
+}
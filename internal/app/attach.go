@@ -0,0 +1,41 @@
+package app
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/opencode-ai/opencode/internal/llm/models"
+	"github.com/opencode-ai/opencode/internal/message"
+)
+
+// attachableImages are the image types the TUI file picker attaches.
+var attachableImages = []string{"image/jpeg", "image/png", "image/webp"}
+
+// attachFiles reads the files attached to a non-interactive prompt. Images
+// are sent as attachments, text files are added to the prompt since
+// providers only accept images as binary content.
+func attachFiles(prompt string, paths []string, model models.Model) (string, []message.Attachment, error) {
+	var attachments []message.Attachment
+	var text strings.Builder
+	text.WriteString(prompt)
+	for _, path := range paths {
+		attachment, err := message.ReadAttachment(path)
+		if err != nil {
+			return "", nil, err
+		}
+		mimeType, _, _ := strings.Cut(attachment.MimeType, ";")
+		switch {
+		case slices.Contains(attachableImages, mimeType):
+			if !model.SupportsAttachments {
+				return "", nil, fmt.Errorf("model %s doesn't support attachments, can't attach %s", model.Name, path)
+			}
+			attachments = append(attachments, attachment)
+		case strings.HasPrefix(mimeType, "text/"):
+			fmt.Fprintf(&text, "\n\n<attachment path=%q>\n%s\n</attachment>", path, strings.TrimRight(string(attachment.Content), "\n"))
+		default:
+			return "", nil, fmt.Errorf("unsupported attachment %s (%s), attach jpeg, png or webp images and text files", path, mimeType)
+		}
+	}
+	return text.String(), attachments, nil
+}
@@ -0,0 +1,89 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/opencode-ai/opencode/internal/llm/agent"
+	"github.com/opencode-ai/opencode/internal/message"
+)
+
+// Exit codes of a non-interactive run, by how its last turn finished.
+const (
+	ExitCodeOK               = 0
+	ExitCodeError            = 1
+	ExitCodeMaxTokens        = 2
+	ExitCodePermissionDenied = 3
+	ExitCodeLimitReached     = 4
+	ExitCodeCanceled         = 130
+)
+
+// ExitError ends a non-interactive run that didn't finish its turn, the
+// process exits with Code.
+type ExitError struct {
+	Code   int
+	Reason message.FinishReason
+	Err    error
+}
+
+func (e *ExitError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// runFinishReason returns how a turn finished, failed turns carry no
+// finished message.
+func runFinishReason(result agent.AgentEvent) message.FinishReason {
+	switch {
+	case errors.Is(result.Error, context.Canceled) || errors.Is(result.Error, agent.ErrRequestCancelled):
+		return message.FinishReasonCanceled
+	case errors.Is(result.Error, agent.ErrLimitReached):
+		return message.FinishReasonLimitReached
+	case result.Error != nil:
+		return message.FinishReasonError
+	}
+	return result.Message.FinishReason()
+}
+
+// runExitError maps how the last turn of a run finished to its exit code, it
+// is nil for a finished turn.
+func runExitError(result agent.AgentEvent) error {
+	reason := runFinishReason(result)
+	switch reason {
+	case message.FinishReasonMaxTokens:
+		return &ExitError{Code: ExitCodeMaxTokens, Reason: reason, Err: errors.New("the response was cut off at the model's output token limit")}
+	case message.FinishReasonPermissionDenied:
+		return &ExitError{Code: ExitCodePermissionDenied, Reason: reason, Err: errors.New("a permission was denied")}
+	case message.FinishReasonLimitReached:
+		err := result.Error
+		if err == nil {
+			err = agent.ErrLimitReached
+		}
+		return &ExitError{Code: ExitCodeLimitReached, Reason: reason, Err: err}
+	case message.FinishReasonCanceled:
+		return &ExitError{Code: ExitCodeCanceled, Reason: reason, Err: errors.New("agent processing canceled")}
+	case message.FinishReasonError:
+		err := result.Error
+		if err == nil {
+			err = errors.New("the model returned an error")
+		}
+		return &ExitError{Code: ExitCodeError, Reason: reason, Err: fmt.Errorf("agent processing failed: %w", err)}
+	}
+	return nil
+}
+
+// exitCode returns the exit code of a run that ended with err.
+func exitCode(err error) int {
+	if err == nil {
+		return ExitCodeOK
+	}
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+	return ExitCodeError
+}
@@ -0,0 +1,76 @@
+package app
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// approvePlan asks on the terminal whether to execute the plan and returns
+// the plan to execute, edited if the user chose to, or an empty string when
+// it is rejected. Plans are never executed without a terminal to ask on.
+func approvePlan(plan string) (string, error) {
+	if stat, err := os.Stdin.Stat(); err != nil || stat.Mode()&os.ModeCharDevice == 0 {
+		fmt.Fprintln(os.Stderr, "Not executing the plan: approving it needs a terminal")
+		return "", nil
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Fprint(os.Stderr, "Execute this plan? [y]es, [e]dit, [N]o: ")
+		answer, err := reader.ReadString('\n')
+		if err != nil && answer == "" {
+			return "", nil
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			return plan, nil
+		case "e", "edit":
+			edited, err := editPlan(plan)
+			if err != nil {
+				return "", err
+			}
+			if strings.TrimSpace(edited) == "" {
+				fmt.Fprintln(os.Stderr, "The plan is empty")
+				continue
+			}
+			plan = edited
+		case "", "n", "no":
+			return "", nil
+		}
+	}
+}
+
+// editPlan opens the plan in $EDITOR and returns the saved text.
+func editPlan(plan string) (string, error) {
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "nvim"
+	}
+
+	tmpfile, err := os.CreateTemp("", "plan_*.md")
+	if err != nil {
+		return "", fmt.Errorf("failed to create plan file: %w", err)
+	}
+	defer os.Remove(tmpfile.Name())
+	if _, err := tmpfile.WriteString(plan); err != nil {
+		tmpfile.Close()
+		return "", fmt.Errorf("failed to write plan file: %w", err)
+	}
+	tmpfile.Close()
+
+	c := exec.Command(editor, tmpfile.Name()) //nolint:gosec
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		return "", fmt.Errorf("failed to run editor: %w", err)
+	}
+	content, err := os.ReadFile(tmpfile.Name())
+	if err != nil {
+		return "", fmt.Errorf("failed to read plan file: %w", err)
+	}
+	return string(content), nil
+}
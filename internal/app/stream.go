@@ -0,0 +1,361 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/opencode-ai/opencode/internal/llm/agent"
+	"github.com/opencode-ai/opencode/internal/logging"
+	"github.com/opencode-ai/opencode/internal/message"
+	"github.com/opencode-ai/opencode/internal/pubsub"
+	"github.com/opencode-ai/opencode/internal/session"
+)
+
+// Event types of the stream-json output format.
+const (
+	streamEventSession    = "session"
+	streamEventText       = "text"
+	streamEventThinking   = "thinking"
+	streamEventToolCall   = "tool_call"
+	streamEventToolResult = "tool_result"
+	streamEventUsage      = "usage"
+	streamEventCompaction = "compaction"
+	streamEventFallback   = "fallback"
+	streamEventResult     = "result"
+	streamEventSummary    = "summary"
+)
+
+// streamEvent is one line of the stream-json output format.
+type streamEvent struct {
+	Type      string `json:"type"`
+	SessionID string `json:"session_id"`
+	MessageID string `json:"message_id,omitempty"`
+	// Set on the progress of a sub-agent, the agent tool call it runs under
+	ParentToolCallID string `json:"parent_tool_call_id,omitempty"`
+
+	Agent        string            `json:"agent,omitempty"`
+	Text         string            `json:"text,omitempty"`
+	ToolCall     *streamToolCall   `json:"tool_call,omitempty"`
+	ToolResult   *streamToolResult `json:"tool_result,omitempty"`
+	Usage        *streamUsage      `json:"usage,omitempty"`
+	Cost         *float64          `json:"cost,omitempty"`
+	FinishReason string            `json:"finish_reason,omitempty"`
+	PlanMode     bool              `json:"plan_mode,omitempty"`
+	Error        string            `json:"error,omitempty"`
+	Summary      *runSummary       `json:"summary,omitempty"`
+}
+
+type streamToolCall struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Input string `json:"input"`
+}
+
+type streamToolResult struct {
+	ToolCallID string `json:"tool_call_id"`
+	Name       string `json:"name"`
+	Content    string `json:"content"`
+	Metadata   string `json:"metadata,omitempty"`
+	IsError    bool   `json:"is_error"`
+}
+
+// streamUsage holds the tokens of the last request and of the whole session.
+type streamUsage struct {
+	PromptTokens          int64 `json:"prompt_tokens"`
+	CompletionTokens      int64 `json:"completion_tokens"`
+	TotalPromptTokens     int64 `json:"total_prompt_tokens"`
+	TotalCompletionTokens int64 `json:"total_completion_tokens"`
+}
+
+// streamResult asks the stream to report the result of a turn.
+type streamResult struct {
+	result   agent.AgentEvent
+	planMode bool
+	done     chan struct{}
+}
+
+// outputStream writes the progress of a non-interactive session as one JSON
+// event per line. Events are handled by a single goroutine so that lines
+// keep their order.
+type outputStream struct {
+	app       *App
+	sessionID string
+	encoder   *json.Encoder
+
+	messages  <-chan pubsub.Event[message.Message]
+	agent     <-chan pubsub.Event[agent.AgentEvent]
+	sessions  <-chan pubsub.Event[session.Session]
+	results   chan streamResult
+	cancel    context.CancelFunc
+	done      chan struct{}
+	progress  *messageProgress
+	subAgents *messageProgress
+	usage     streamUsage
+	cost      float64
+}
+
+// newOutputStream starts streaming the session's progress to w, beginning
+// with a session event.
+func (a *App) newOutputStream(ctx context.Context, w io.Writer, runAgent agent.Service, sess session.Session, agentName string) *outputStream {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &outputStream{
+		app:       a,
+		sessionID: sess.ID,
+		encoder:   json.NewEncoder(w),
+		messages:  a.Messages.Subscribe(ctx),
+		agent:     runAgent.Subscribe(ctx),
+		sessions:  a.Sessions.Subscribe(ctx),
+		results:   make(chan streamResult),
+		cancel:    cancel,
+		done:      make(chan struct{}),
+		progress:  newMessageProgress(),
+		subAgents: newMessageProgress(),
+	}
+	s.write(streamEvent{Type: streamEventSession, Agent: agentName})
+	go s.run()
+	return s
+}
+
+// result writes the result of a turn, after the events that preceded it.
+func (s *outputStream) result(result agent.AgentEvent, planMode bool) {
+	req := streamResult{result: result, planMode: planMode, done: make(chan struct{})}
+	select {
+	case s.results <- req:
+		<-req.done
+	case <-s.done:
+	}
+}
+
+// close stops the stream.
+func (s *outputStream) close() {
+	s.cancel()
+	<-s.done
+}
+
+func (s *outputStream) run() {
+	defer close(s.done)
+	defer logging.RecoverPanic("stream-json", nil)
+
+	for {
+		select {
+		case event, ok := <-s.messages:
+			if !ok {
+				return
+			}
+			s.handleMessage(event)
+		case event, ok := <-s.agent:
+			if !ok {
+				return
+			}
+			s.handleAgentEvent(event)
+		case event, ok := <-s.sessions:
+			if !ok {
+				return
+			}
+			s.handleSession(event.Payload)
+		case req := <-s.results:
+			s.drain()
+			s.writeResult(req)
+			close(req.done)
+		}
+	}
+}
+
+// drain handles the events published before the turn finished.
+func (s *outputStream) drain() {
+	for {
+		select {
+		case event, ok := <-s.messages:
+			if !ok {
+				return
+			}
+			s.handleMessage(event)
+		case event, ok := <-s.agent:
+			if !ok {
+				return
+			}
+			s.handleAgentEvent(event)
+		case event, ok := <-s.sessions:
+			if !ok {
+				return
+			}
+			s.handleSession(event.Payload)
+		default:
+			return
+		}
+	}
+}
+
+func (s *outputStream) handleMessage(event pubsub.Event[message.Message]) {
+	if event.Payload.SessionID != s.sessionID {
+		return
+	}
+	for _, e := range s.progress.diff(event) {
+		s.write(e)
+	}
+}
+
+func (s *outputStream) handleAgentEvent(agentEvent pubsub.Event[agent.AgentEvent]) {
+	event := agentEvent.Payload
+	if event.SessionID != s.sessionID {
+		return
+	}
+	switch event.Type {
+	case agent.AgentEventTypeSubAgent:
+		msgEvent := pubsub.Event[message.Message]{Type: agentEvent.Type, Payload: event.Message}
+		for _, e := range s.subAgents.diff(msgEvent) {
+			e.ParentToolCallID = event.ToolCallID
+			s.write(e)
+		}
+	case agent.AgentEventTypeSummarize:
+		s.write(streamEvent{Type: streamEventCompaction, Text: event.Progress})
+	case agent.AgentEventTypeFallback:
+		e := streamEvent{Type: streamEventFallback, Text: event.Progress}
+		if event.Error != nil {
+			e.Error = event.Error.Error()
+		}
+		s.write(e)
+	}
+}
+
+func (s *outputStream) handleSession(sess session.Session) {
+	if sess.ID != s.sessionID {
+		return
+	}
+	usage := sessionUsage(sess)
+	if usage == s.usage && sess.Cost == s.cost {
+		return
+	}
+	s.usage, s.cost = usage, sess.Cost
+	s.write(streamEvent{Type: streamEventUsage, Usage: &usage, Cost: &sess.Cost})
+}
+
+func (s *outputStream) writeResult(req streamResult) {
+	result := req.result
+	// Report what a dropped event may have left out
+	if result.Message.ID != "" {
+		s.handleMessage(pubsub.Event[message.Message]{Type: pubsub.UpdatedEvent, Payload: result.Message})
+	}
+
+	e := streamEvent{
+		Type:         streamEventResult,
+		MessageID:    result.Message.ID,
+		Text:         result.Message.Content().String(),
+		FinishReason: string(result.Message.FinishReason()),
+		PlanMode:     req.planMode,
+	}
+	if result.Error != nil {
+		e.Error = result.Error.Error()
+	}
+	if sess, err := s.app.Sessions.Get(context.Background(), s.sessionID); err == nil {
+		usage := sessionUsage(sess)
+		e.Usage, e.Cost = &usage, &sess.Cost
+	}
+	s.write(e)
+}
+
+func (s *outputStream) write(e streamEvent) {
+	e.SessionID = s.sessionID
+	if err := s.encoder.Encode(e); err != nil {
+		logging.Error("Failed to write stream event", "error", err)
+	}
+}
+
+func sessionUsage(sess session.Session) streamUsage {
+	return streamUsage{
+		PromptTokens:          sess.PromptTokens,
+		CompletionTokens:      sess.CompletionTokens,
+		TotalPromptTokens:     sess.TotalPromptTokens,
+		TotalCompletionTokens: sess.TotalCompletionTokens,
+	}
+}
+
+// messageProgress turns message snapshots into stream events, remembering
+// how much of each assistant message was already written.
+type messageProgress struct {
+	text      map[string]int
+	thinking  map[string]int
+	toolCalls map[string]bool
+	toolNames map[string]string
+}
+
+func newMessageProgress() *messageProgress {
+	return &messageProgress{
+		text:      make(map[string]int),
+		thinking:  make(map[string]int),
+		toolCalls: make(map[string]bool),
+		toolNames: make(map[string]string),
+	}
+}
+
+// diff returns the stream events produced by a message event.
+func (p *messageProgress) diff(event pubsub.Event[message.Message]) []streamEvent {
+	msg := event.Payload
+	switch {
+	case event.Type == pubsub.DeletedEvent:
+		return nil
+	case msg.Role == message.Assistant:
+		return p.diffAssistant(msg)
+	case msg.Role == message.Tool && event.Type == pubsub.CreatedEvent:
+		return p.toolResults(msg)
+	}
+	return nil
+}
+
+func (p *messageProgress) diffAssistant(msg message.Message) []streamEvent {
+	var events []streamEvent
+	if thinking := msg.ReasoningContent().Thinking; len(thinking) > p.thinking[msg.ID] {
+		events = append(events, streamEvent{Type: streamEventThinking, MessageID: msg.ID, Text: thinking[p.thinking[msg.ID]:]})
+		p.thinking[msg.ID] = len(thinking)
+	}
+	if text := msg.Content().Text; len(text) > p.text[msg.ID] {
+		events = append(events, streamEvent{Type: streamEventText, MessageID: msg.ID, Text: text[p.text[msg.ID]:]})
+		p.text[msg.ID] = len(text)
+	}
+	// The input of tool calls is complete once the message is finished,
+	// before the tools run
+	if !msg.IsFinished() {
+		return events
+	}
+	for _, toolCall := range msg.ToolCalls() {
+		if p.toolCalls[toolCall.ID] {
+			continue
+		}
+		p.toolCalls[toolCall.ID] = true
+		p.toolNames[toolCall.ID] = toolCall.Name
+		events = append(events, streamEvent{
+			Type:      streamEventToolCall,
+			MessageID: msg.ID,
+			ToolCall: &streamToolCall{
+				ID:    toolCall.ID,
+				Name:  toolCall.Name,
+				Input: toolCall.Input,
+			},
+		})
+	}
+	return events
+}
+
+func (p *messageProgress) toolResults(msg message.Message) []streamEvent {
+	var events []streamEvent
+	for _, result := range msg.ToolResults() {
+		name := result.Name
+		if name == "" {
+			name = p.toolNames[result.ToolCallID]
+		}
+		delete(p.toolNames, result.ToolCallID)
+		events = append(events, streamEvent{
+			Type:      streamEventToolResult,
+			MessageID: msg.ID,
+			ToolResult: &streamToolResult{
+				ToolCallID: result.ToolCallID,
+				Name:       name,
+				Content:    result.Content,
+				Metadata:   result.Metadata,
+				IsError:    result.IsError,
+			},
+		})
+	}
+	return events
+}
@@ -0,0 +1,49 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/opencode-ai/opencode/internal/message"
+	"github.com/opencode-ai/opencode/internal/pubsub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageProgressDiff(t *testing.T) {
+	progress := newMessageProgress()
+	updated := func(msg message.Message) []streamEvent {
+		return progress.diff(pubsub.Event[message.Message]{Type: pubsub.UpdatedEvent, Payload: msg})
+	}
+	msg := message.Message{ID: "m1", SessionID: "s1", Role: message.Assistant}
+
+	msg.AppendReasoningContent("Planning")
+	msg.AppendContent("Hello")
+	events := updated(msg)
+	require.Len(t, events, 2)
+	assert.Equal(t, streamEvent{Type: streamEventThinking, MessageID: "m1", Text: "Planning"}, events[0])
+	assert.Equal(t, streamEvent{Type: streamEventText, MessageID: "m1", Text: "Hello"}, events[1])
+
+	// Tool calls wait for the message to finish, their input is set last
+	msg.AppendContent(" world")
+	msg.AddToolCall(message.ToolCall{ID: "t1", Name: "view", Finished: true})
+	events = updated(msg)
+	require.Len(t, events, 1)
+	assert.Equal(t, " world", events[0].Text)
+
+	msg.SetToolCalls([]message.ToolCall{{ID: "t1", Name: "view", Input: `{"file_path":"a.tsx"}`, Finished: true}})
+	msg.AddFinish(message.FinishReasonToolUse)
+	events = updated(msg)
+	require.Len(t, events, 1)
+	assert.Equal(t, &streamToolCall{ID: "t1", Name: "view", Input: `{"file_path":"a.tsx"}`}, events[0].ToolCall)
+	assert.Empty(t, updated(msg), "nothing is written twice")
+
+	toolMsg := message.Message{
+		ID:        "m2",
+		SessionID: "s1",
+		Role:      message.Tool,
+		Parts:     []message.ContentPart{message.ToolResult{ToolCallID: "t1", Content: "ok"}},
+	}
+	events = progress.diff(pubsub.Event[message.Message]{Type: pubsub.CreatedEvent, Payload: toolMsg})
+	require.Len(t, events, 1)
+	assert.Equal(t, &streamToolResult{ToolCallID: "t1", Name: "view", Content: "ok"}, events[0].ToolResult)
+}
@@ -0,0 +1,130 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/opencode-ai/opencode/internal/config"
+	"github.com/opencode-ai/opencode/internal/logging"
+	"github.com/opencode-ai/opencode/internal/message"
+	"github.com/opencode-ai/opencode/internal/session"
+)
+
+// runSummary describes what a non-interactive run did, it is printed with
+// --summary.
+type runSummary struct {
+	FinishReason string `json:"finish_reason"`
+	ExitCode     int    `json:"exit_code"`
+	// Files the run changed, relative to the working directory
+	FilesChanged []string `json:"files_changed"`
+	// Tool calls of the run by tool name
+	ToolCalls        map[string]int `json:"tool_calls"`
+	PromptTokens     int64          `json:"prompt_tokens"`
+	CompletionTokens int64          `json:"completion_tokens"`
+	// Cost of the run in USD
+	Cost float64 `json:"cost"`
+}
+
+// runStart records the session before a run, so that the summary only
+// counts what the run added to a continued session.
+type runStart struct {
+	session  session.Session
+	messages int
+	// IDs of the latest file versions of the session
+	files map[string]bool
+}
+
+func (a *App) startSummary(ctx context.Context, sess session.Session) (runStart, error) {
+	msgs, err := a.Messages.List(ctx, sess.ID)
+	if err != nil {
+		return runStart{}, fmt.Errorf("failed to list messages: %w", err)
+	}
+	files, err := a.History.ListLatestSessionFiles(ctx, sess.ID)
+	if err != nil {
+		return runStart{}, fmt.Errorf("failed to list session files: %w", err)
+	}
+	start := runStart{session: sess, messages: len(msgs), files: make(map[string]bool, len(files))}
+	for _, file := range files {
+		start.files[file.ID] = true
+	}
+	return start, nil
+}
+
+// summarize sums up the run since start. The run may have been canceled, so
+// it doesn't take the run's context.
+func (a *App) summarize(start runStart, reason message.FinishReason, code int) runSummary {
+	ctx := context.Background()
+	summary := runSummary{
+		FinishReason: string(reason),
+		ExitCode:     code,
+		FilesChanged: []string{},
+		ToolCalls:    map[string]int{},
+	}
+
+	if files, err := a.History.ListLatestSessionFiles(ctx, start.session.ID); err != nil {
+		logging.Error("Failed to list session files for the summary", "error", err)
+	} else {
+		// Versions created in the same second are all listed as the latest
+		for _, file := range files {
+			path := relativePath(file.Path)
+			if !start.files[file.ID] && !slices.Contains(summary.FilesChanged, path) {
+				summary.FilesChanged = append(summary.FilesChanged, path)
+			}
+		}
+		slices.Sort(summary.FilesChanged)
+	}
+
+	if msgs, err := a.Messages.List(ctx, start.session.ID); err != nil {
+		logging.Error("Failed to list messages for the summary", "error", err)
+	} else if start.messages <= len(msgs) {
+		for _, msg := range msgs[start.messages:] {
+			for _, toolCall := range msg.ToolCalls() {
+				summary.ToolCalls[toolCall.Name]++
+			}
+		}
+	}
+
+	if sess, err := a.Sessions.Get(ctx, start.session.ID); err != nil {
+		logging.Error("Failed to get the session for the summary", "error", err)
+	} else {
+		summary.PromptTokens = sess.TotalPromptTokens - start.session.TotalPromptTokens
+		summary.CompletionTokens = sess.TotalCompletionTokens - start.session.TotalCompletionTokens
+		summary.Cost = sess.Cost - start.session.Cost
+	}
+	return summary
+}
+
+// write prints the summary as text.
+func (s runSummary) write(w io.Writer) {
+	fmt.Fprintf(w, "\nfinish reason: %s (exit code %d)\n", s.FinishReason, s.ExitCode)
+	fmt.Fprintf(w, "files changed: %d\n", len(s.FilesChanged))
+	for _, path := range s.FilesChanged {
+		fmt.Fprintf(w, "  %s\n", path)
+	}
+
+	total := 0
+	var counts []string
+	for _, name := range slices.Sorted(maps.Keys(s.ToolCalls)) {
+		total += s.ToolCalls[name]
+		counts = append(counts, fmt.Sprintf("%s %d", name, s.ToolCalls[name]))
+	}
+	if total > 0 {
+		fmt.Fprintf(w, "tool calls: %d (%s)\n", total, strings.Join(counts, ", "))
+	} else {
+		fmt.Fprintln(w, "tool calls: 0")
+	}
+	fmt.Fprintf(w, "tokens: %d prompt, %d completion\n", s.PromptTokens, s.CompletionTokens)
+	fmt.Fprintf(w, "cost: $%.4f\n", s.Cost)
+}
+
+func relativePath(path string) string {
+	if rel, err := filepath.Rel(config.WorkingDirectory(), path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
 
 	"github.com/opencode-ai/opencode/internal/llm/models"
@@ -45,9 +46,30 @@ const (
 
 // Agent defines configuration for different LLM models and their token limits.
 type Agent struct {
-	Model           models.ModelID `json:"model"`
-	MaxTokens       int64          `json:"maxTokens"`
-	ReasoningEffort string         `json:"reasoningEffort"` // For openai models low,medium,heigh
+	Model           models.ModelID   `json:"model"`
+	MaxTokens       int64            `json:"maxTokens"`
+	ReasoningEffort string           `json:"reasoningEffort"`     // For openai models low,medium,heigh
+	Fallbacks       []models.ModelID `json:"fallbacks,omitempty"` // Models tried in order when the model fails
+
+	// Limits that stop a turn, 0 means no limit
+	MaxSteps             int     `json:"maxSteps,omitempty"`             // Tool-use iterations per user turn
+	MaxCost              float64 `json:"maxCost,omitempty"`              // USD per session
+	MaxRepeatedToolCalls int     `json:"maxRepeatedToolCalls,omitempty"` // Identical tool calls in a row
+
+	// Agents other than the built-in ones are defined with these
+	Description string   `json:"description,omitempty"` // Shown when picking the agent
+	Prompt      string   `json:"prompt,omitempty"`      // System prompt file, relative to the working directory
+	Tools       []string `json:"tools,omitempty"`       // Tools the agent may use, all of the coder's when empty
+	SubAgent    bool     `json:"subagent,omitempty"`    // Offered to the agent tool as a sub-agent
+}
+
+// builtinAgents are the agents opencode runs itself, every other name in the
+// agents configuration defines a custom agent.
+var builtinAgents = []AgentName{AgentCoder, AgentSummarizer, AgentTask, AgentTitle}
+
+// IsBuiltinAgent reports whether the agent is one of opencode's own.
+func IsBuiltinAgent(name AgentName) bool {
+	return slices.Contains(builtinAgents, name)
 }
 
 // Provider defines configuration for an LLM provider.
@@ -80,20 +102,38 @@ type ShellConfig struct {
 	Args []string `json:"args,omitempty"`
 }
 
+// ServerConfig defines the configuration for the HTTP/WebSocket server.
+type ServerConfig struct {
+	Address        string   `json:"address,omitempty"`
+	AllowedOrigins []string `json:"allowedOrigins,omitempty"` // "*" allows any origin
+	AuthToken      string   `json:"authToken,omitempty"`      // Shared secret required on /ws and the REST API when set
+	TLSCertFile    string   `json:"tlsCertFile,omitempty"`
+	TLSKeyFile     string   `json:"tlsKeyFile,omitempty"`
+}
+
+// IconsConfig defines where the lucid_icons tool looks up and writes icons.
+type IconsConfig struct {
+	CacheDir  string `json:"cacheDir,omitempty"`  // Directory of Lucide SVGs, optionally with the tags.json shipped by lucide-static
+	PublicDir string `json:"publicDir,omitempty"` // Directory the resolved icons are copied to
+}
+
 // Config is the main configuration structure for the application.
 type Config struct {
-	Data         Data                              `json:"data"`
-	WorkingDir   string                            `json:"wd,omitempty"`
-	MCPServers   map[string]MCPServer              `json:"mcpServers,omitempty"`
-	Providers    map[models.ModelProvider]Provider `json:"providers,omitempty"`
-	LSP          map[string]LSPConfig              `json:"lsp,omitempty"`
-	Agents       map[AgentName]Agent               `json:"agents,omitempty"`
-	Debug        bool                              `json:"debug,omitempty"`
-	DebugLSP     bool                              `json:"debugLSP,omitempty"`
-	ContextPaths []string                          `json:"contextPaths,omitempty"`
-	TUI          TUIConfig                         `json:"tui"`
-	Shell        ShellConfig                       `json:"shell,omitempty"`
-	AutoCompact  bool                              `json:"autoCompact,omitempty"`
+	Data          Data                              `json:"data"`
+	WorkingDir    string                            `json:"wd,omitempty"`
+	MCPServers    map[string]MCPServer              `json:"mcpServers,omitempty"`
+	Providers     map[models.ModelProvider]Provider `json:"providers,omitempty"`
+	LSP           map[string]LSPConfig              `json:"lsp,omitempty"`
+	Agents        map[AgentName]Agent               `json:"agents,omitempty"`
+	Debug         bool                              `json:"debug,omitempty"`
+	DebugLSP      bool                              `json:"debugLSP,omitempty"`
+	ContextPaths  []string                          `json:"contextPaths,omitempty"`
+	TUI           TUIConfig                         `json:"tui"`
+	Shell         ShellConfig                       `json:"shell,omitempty"`
+	AutoCompact   bool                              `json:"autoCompact,omitempty"`
+	Server        ServerConfig                      `json:"server,omitempty"`
+	Icons         IconsConfig                       `json:"icons,omitempty"`
+	ParallelTools int                               `json:"parallelTools,omitempty"` // Read-only tool calls run concurrently, 1 runs them one by one
 }
 
 // Application constants
@@ -101,10 +141,19 @@ const (
 	defaultDataDirectory = ".opencode"
 	defaultLogLevel      = "info"
 	appName              = "opencode"
+	defaultServerAddress = ":3000"
+	defaultIconsDir      = "frontend/public/icons"
+	defaultParallelTools = 4
 
 	MaxTokensFallbackDefault = 4096
 )
 
+// defaultAllowedOrigins are the origins of the Motion Canvas dev server.
+var defaultAllowedOrigins = []string{
+	"http://localhost:9000",
+	"http://127.0.0.1:9000",
+}
+
 var defaultContextPaths = []string{
 	// ".github/copilot-instructions.md",
 	// ".cursorrules",
@@ -233,6 +282,10 @@ func setDefaults(debug bool) {
 	viper.SetDefault("contextPaths", defaultContextPaths)
 	viper.SetDefault("tui.theme", "opencode")
 	viper.SetDefault("autoCompact", true)
+	viper.SetDefault("parallelTools", defaultParallelTools)
+	viper.SetDefault("server.address", defaultServerAddress)
+	viper.SetDefault("server.allowedOrigins", defaultAllowedOrigins)
+	viper.SetDefault("icons.publicDir", defaultIconsDir)
 
 	// Set default shell from environment or fallback to /bin/bash
 	shellPath := os.Getenv("SHELL")
@@ -523,7 +576,7 @@ func validateAgent(cfg *Config, name AgentName, agent Agent) error {
 			"configured_model", agent.Model)
 
 		// Set default model based on available providers
-		if setDefaultModelForAgent(name) {
+		if resetAgentModel(name, agent) {
 			logging.Info("set default model for agent", "agent", name, "model", cfg.Agents[name].Model)
 		} else {
 			return fmt.Errorf("no valid provider available for agent %s", name)
@@ -545,7 +598,7 @@ func validateAgent(cfg *Config, name AgentName, agent Agent) error {
 				"provider", provider)
 
 			// Set default model based on available providers
-			if setDefaultModelForAgent(name) {
+			if resetAgentModel(name, agent) {
 				logging.Info("set default model for agent", "agent", name, "model", cfg.Agents[name].Model)
 			} else {
 				return fmt.Errorf("no valid provider available for agent %s", name)
@@ -565,7 +618,7 @@ func validateAgent(cfg *Config, name AgentName, agent Agent) error {
 			"provider", provider)
 
 		// Set default model based on available providers
-		if setDefaultModelForAgent(name) {
+		if resetAgentModel(name, agent) {
 			logging.Info("set default model for agent", "agent", name, "model", cfg.Agents[name].Model)
 		} else {
 			return fmt.Errorf("no valid provider available for agent %s", name)
@@ -652,6 +705,25 @@ func Validate() error {
 
 	// Validate agent models
 	for name, agent := range cfg.Agents {
+		if !IsBuiltinAgent(name) {
+			continue
+		}
+		if err := validateAgent(cfg, name, agent); err != nil {
+			return err
+		}
+	}
+	// Custom agents default to the coder's model once it's valid
+	for _, name := range CustomAgents() {
+		agent := cfg.Agents[name]
+		if agent.Model == "" {
+			agent.Model = cfg.Agents[AgentCoder].Model
+			cfg.Agents[name] = agent
+		}
+		if agent.Prompt != "" {
+			if _, err := os.Stat(agent.PromptPath()); err != nil {
+				return fmt.Errorf("prompt of agent %s: %w", name, err)
+			}
+		}
 		if err := validateAgent(cfg, name, agent); err != nil {
 			return err
 		}
@@ -667,6 +739,11 @@ func Validate() error {
 		}
 	}
 
+	// Validate server TLS configuration
+	if (cfg.Server.TLSCertFile == "") != (cfg.Server.TLSKeyFile == "") {
+		return fmt.Errorf("server.tlsCertFile and server.tlsKeyFile must be set together")
+	}
+
 	// Validate LSP configurations
 	for language, lspConfig := range cfg.LSP {
 		if lspConfig.Command == "" && !lspConfig.Disabled {
@@ -702,10 +779,27 @@ func getProviderAPIKey(provider models.ModelProvider) string {
 		if hasVertexAICredentials() {
 			return "vertex-ai-credentials-available"
 		}
+	case models.ProviderMock:
+		// Only available once enabled, it needs no credentials
+		return "mock"
 	}
 	return ""
 }
 
+// resetAgentModel sets the default model of the available providers, keeping
+// the other settings of the agent.
+func resetAgentModel(name AgentName, agent Agent) bool {
+	if !setDefaultModelForAgent(name) {
+		return false
+	}
+	defaults := cfg.Agents[name]
+	agent.Model = defaults.Model
+	agent.MaxTokens = defaults.MaxTokens
+	agent.ReasoningEffort = defaults.ReasoningEffort
+	cfg.Agents[name] = agent
+	return true
+}
+
 // setDefaultModelForAgent sets a default model for an agent based on available providers
 func setDefaultModelForAgent(agent AgentName) bool {
 	if hasCopilotCredentials() {
@@ -910,6 +1004,45 @@ func Get() *Config {
 	return cfg
 }
 
+// CustomAgents returns the names of the agents defined in the configuration,
+// sorted.
+func CustomAgents() []AgentName {
+	if cfg == nil {
+		panic("config not loaded")
+	}
+	var names []AgentName
+	for name := range cfg.Agents {
+		if !IsBuiltinAgent(name) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// PromptPath returns the path of the agent's system prompt file.
+func (a Agent) PromptPath() string {
+	if a.Prompt == "" || filepath.IsAbs(a.Prompt) {
+		return a.Prompt
+	}
+	return filepath.Join(WorkingDirectory(), a.Prompt)
+}
+
+// SubAgents returns the agents the agent tool can run: the task agent followed
+// by the custom agents marked as sub-agents.
+func SubAgents() []AgentName {
+	if cfg == nil {
+		panic("config not loaded")
+	}
+	names := []AgentName{AgentTask}
+	for _, name := range CustomAgents() {
+		if cfg.Agents[name].SubAgent {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
 // WorkingDirectory returns the current working directory from the configuration.
 func WorkingDirectory() string {
 	if cfg == nil {
@@ -935,11 +1068,9 @@ func UpdateAgentModel(agentName AgentName, modelID models.ModelID) error {
 		maxTokens = model.DefaultMaxTokens
 	}
 
-	newAgentCfg := Agent{
-		Model:           modelID,
-		MaxTokens:       maxTokens,
-		ReasoningEffort: existingAgentCfg.ReasoningEffort,
-	}
+	newAgentCfg := existingAgentCfg
+	newAgentCfg.Model = modelID
+	newAgentCfg.MaxTokens = maxTokens
 	cfg.Agents[agentName] = newAgentCfg
 
 	if err := validateAgent(cfg, agentName, newAgentCfg); err != nil {
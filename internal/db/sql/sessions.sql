@@ -28,6 +28,12 @@ SELECT *
 FROM sessions
 WHERE id = ? LIMIT 1;
 
+-- name: ListChildSessions :many
+SELECT *
+FROM sessions
+WHERE parent_session_id = ?
+ORDER BY created_at ASC;
+
 -- name: ListSessions :many
 SELECT *
 FROM sessions
@@ -41,7 +47,9 @@ SET
     prompt_tokens = ?,
     completion_tokens = ?,
     summary_message_id = ?,
-    cost = ?
+    cost = ?,
+    total_prompt_tokens = ?,
+    total_completion_tokens = ?
 WHERE id = ?
 RETURNING *;
 
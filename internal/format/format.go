@@ -15,6 +15,9 @@ const (
 
 	// JSON format outputs the AI response wrapped in a JSON object.
 	JSON OutputFormat = "json"
+
+	// StreamJSON format writes one JSON event per line while the agent runs.
+	StreamJSON OutputFormat = "stream-json"
 )
 
 // String returns the string representation of the OutputFormat
@@ -26,6 +29,7 @@ func (f OutputFormat) String() string {
 var SupportedFormats = []string{
 	string(Text),
 	string(JSON),
+	string(StreamJSON),
 }
 
 // Parse converts a string to an OutputFormat
@@ -37,6 +41,8 @@ func Parse(s string) (OutputFormat, error) {
 		return Text, nil
 	case string(JSON):
 		return JSON, nil
+	case string(StreamJSON):
+		return StreamJSON, nil
 	default:
 		return "", fmt.Errorf("invalid format: %s", s)
 	}
@@ -52,12 +58,15 @@ func IsValid(s string) bool {
 func GetHelpText() string {
 	return fmt.Sprintf(`Supported output formats:
 - %s: Plain text output (default)
-- %s: Output wrapped in a JSON object`,
-		Text, JSON)
+- %s: Output wrapped in a JSON object
+- %s: One JSON event per line while the agent runs`,
+		Text, JSON, StreamJSON)
 }
 
-// FormatOutput formats the AI response according to the specified format
-func FormatOutput(content string, formatStr string) string {
+// FormatOutput formats the AI response of the session according to the
+// specified format. The JSON format adds the summary of the run when it isn't
+// nil.
+func FormatOutput(content string, formatStr string, sessionID string, summary any) string {
 	format, err := Parse(formatStr)
 	if err != nil {
 		// Default to text format on error
@@ -66,7 +75,7 @@ func FormatOutput(content string, formatStr string) string {
 
 	switch format {
 	case JSON:
-		return formatAsJSON(content)
+		return formatAsJSON(content, sessionID, summary)
 	case Text:
 		fallthrough
 	default:
@@ -75,12 +84,16 @@ func FormatOutput(content string, formatStr string) string {
 }
 
 // formatAsJSON wraps the content in a simple JSON object
-func formatAsJSON(content string) string {
+func formatAsJSON(content string, sessionID string, summary any) string {
 	// Use the JSON package to properly escape the content
 	response := struct {
-		Response string `json:"response"`
+		Response  string `json:"response"`
+		SessionID string `json:"session_id"`
+		Summary   any    `json:"summary,omitempty"`
 	}{
-		Response: content,
+		Response:  content,
+		SessionID: sessionID,
+		Summary:   summary,
 	}
 
 	jsonBytes, err := json.MarshalIndent(response, "", "  ")
@@ -92,7 +105,7 @@ func formatAsJSON(content string) string {
 		jsonEscaped = strings.Replace(jsonEscaped, "\r", "\\r", -1)
 		jsonEscaped = strings.Replace(jsonEscaped, "\t", "\\t", -1)
 
-		return fmt.Sprintf("{\n  \"response\": \"%s\"\n}", jsonEscaped)
+		return fmt.Sprintf("{\n  \"response\": \"%s\",\n  \"session_id\": \"%s\"\n}", jsonEscaped, sessionID)
 	}
 
 	return string(jsonBytes)
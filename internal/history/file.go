@@ -31,6 +31,7 @@ type Service interface {
 	pubsub.Suscriber[File]
 	Create(ctx context.Context, sessionID, path, content string) (File, error)
 	CreateVersion(ctx context.Context, sessionID, path, content string) (File, error)
+	Import(ctx context.Context, sessionID string, file File) (File, error)
 	Get(ctx context.Context, id string) (File, error)
 	GetByPathAndSession(ctx context.Context, path, sessionID string) (File, error)
 	ListBySession(ctx context.Context, sessionID string) ([]File, error)
@@ -94,6 +95,27 @@ func (s *service) CreateVersion(ctx context.Context, sessionID, path, content st
 	return s.createWithVersion(ctx, sessionID, path, content, nextVersion)
 }
 
+// Import creates a copy of a file version, from another session or database,
+// in the session. The copy gets a new ID and keeps the version and times of
+// the file.
+func (s *service) Import(ctx context.Context, sessionID string, file File) (File, error) {
+	dbFile, err := s.q.ImportFile(ctx, db.ImportFileParams{
+		ID:        uuid.New().String(),
+		SessionID: sessionID,
+		Path:      file.Path,
+		Content:   file.Content,
+		Version:   file.Version,
+		CreatedAt: file.CreatedAt,
+		UpdatedAt: file.UpdatedAt,
+	})
+	if err != nil {
+		return File{}, err
+	}
+	imported := s.fromDBItem(dbFile)
+	s.Publish(pubsub.CreatedEvent, imported)
+	return imported, nil
+}
+
 func (s *service) createWithVersion(ctx context.Context, sessionID, path, content, version string) (File, error) {
 	// Maximum number of retries for transaction conflicts
 	const maxRetries = 3
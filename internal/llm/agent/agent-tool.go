@@ -4,18 +4,37 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"slices"
+	"strings"
+	"sync"
 
 	"github.com/opencode-ai/opencode/internal/config"
+	"github.com/opencode-ai/opencode/internal/history"
+	"github.com/opencode-ai/opencode/internal/llm/provider"
 	"github.com/opencode-ai/opencode/internal/llm/tools"
+	"github.com/opencode-ai/opencode/internal/logging"
 	"github.com/opencode-ai/opencode/internal/lsp"
 	"github.com/opencode-ai/opencode/internal/message"
+	"github.com/opencode-ai/opencode/internal/permission"
+	"github.com/opencode-ai/opencode/internal/pubsub"
 	"github.com/opencode-ai/opencode/internal/session"
 )
 
 type agentTool struct {
-	sessions   session.Service
-	messages   message.Service
-	lspClients map[string]*lsp.Client
+	sessions    session.Service
+	messages    message.Service
+	permissions permission.Service
+	history     history.Service
+	lspClients  map[string]*lsp.Client
+
+	// costMu serializes updates of the parent session cost, sub-agents of
+	// one message run concurrently.
+	costMu sync.Mutex
+
+	// running holds the sub-agent sessions being run, a session continues
+	// one call at a time.
+	runningMu sync.Mutex
+	running   map[string]bool
 }
 
 const (
@@ -23,23 +42,75 @@ const (
 )
 
 type AgentParams struct {
-	Prompt string `json:"prompt"`
+	Prompt    string `json:"prompt"`
+	SubAgent  string `json:"subagent"`
+	SessionID string `json:"session_id"`
 }
 
+type AgentResponseMetadata struct {
+	SubAgent  string `json:"subagent"`
+	SessionID string `json:"session_id"`
+}
+
+const agentDescription = `Launch a sub-agent that performs a task autonomously with its own tools. When you are searching for a keyword or file and are not confident that you will find the right match on the first try, use the Agent tool with the task sub-agent to perform the search for you. For example:
+
+- If you are searching for a keyword like "config" or "logger", or for questions like "which file does X?", the Agent tool is strongly recommended
+- If you want to read a specific file path, use the View or GlobTool tool instead of the Agent tool, to find the match more quickly
+- If you are searching for a specific class definition like "class Foo", use the GlobTool tool instead, to find the match more quickly
+
+Usage notes:
+1. Launch multiple agents concurrently whenever possible, to maximize performance; to do that, use a single message with multiple tool uses
+2. When the agent is done, it will return a single message back to you. The result returned by the agent is not visible to the user. To show the user the result, you should send a text message back to the user with a concise summary of the result.
+3. Each agent invocation starts a new session, ending with the line "session_id: <id>". Pass that ID as session_id, with the same subagent, to send a follow-up task to the agent; it remembers the earlier tasks of the session. Otherwise your prompt should contain a highly detailed task description for the agent to perform autonomously and you should specify exactly what information the agent should return back to you.
+4. The agent's outputs should generally be trusted
+5. IMPORTANT: The task sub-agent can not use Bash, Replace, Edit, so can not modify files. If you want to use these tools, use them directly instead of going through the agent.
+
+Available sub-agents:`
+
 func (b *agentTool) Info() tools.ToolInfo {
+	subAgents := config.SubAgents()
+	names := make([]string, len(subAgents))
+	var description strings.Builder
+	description.WriteString(agentDescription)
+	for i, name := range subAgents {
+		names[i] = string(name)
+		description.WriteString("\n- " + string(name) + ": " + subAgentDescription(name))
+	}
 	return tools.ToolInfo{
 		Name:        AgentToolName,
-		Description: "Launch a new agent that has access to the following tools: GlobTool, GrepTool, LS, View. When you are searching for a keyword or file and are not confident that you will find the right match on the first try, use the Agent tool to perform the search for you. For example:\n\n- If you are searching for a keyword like \"config\" or \"logger\", or for questions like \"which file does X?\", the Agent tool is strongly recommended\n- If you want to read a specific file path, use the View or GlobTool tool instead of the Agent tool, to find the match more quickly\n- If you are searching for a specific class definition like \"class Foo\", use the GlobTool tool instead, to find the match more quickly\n\nUsage notes:\n1. Launch multiple agents concurrently whenever possible, to maximize performance; to do that, use a single message with multiple tool uses\n2. When the agent is done, it will return a single message back to you. The result returned by the agent is not visible to the user. To show the user the result, you should send a text message back to the user with a concise summary of the result.\n3. Each agent invocation is stateless. You will not be able to send additional messages to the agent, nor will the agent be able to communicate with you outside of its final report. Therefore, your prompt should contain a highly detailed task description for the agent to perform autonomously and you should specify exactly what information the agent should return back to you in its final and only message to you.\n4. The agent's outputs should generally be trusted\n5. IMPORTANT: The agent can not use Bash, Replace, Edit, so can not modify files. If you want to use these tools, use them directly instead of going through the agent.",
+		Description: description.String(),
 		Parameters: map[string]any{
 			"prompt": map[string]any{
 				"type":        "string",
 				"description": "The task for the agent to perform",
 			},
+			"subagent": map[string]any{
+				"type":        "string",
+				"description": "The sub-agent to run, task by default",
+				"enum":        names,
+			},
+			"session_id": map[string]any{
+				"type":        "string",
+				"description": "The session of an earlier invocation to continue",
+			},
 		},
 		Required: []string{"prompt"},
 	}
 }
 
+// subAgentDescription describes the sub-agent in the tool description.
+func subAgentDescription(name config.AgentName) string {
+	if name == config.AgentTask {
+		return "Searches the code with the GlobTool, GrepTool, LS, Sourcegraph and View tools (default)"
+	}
+	agentCfg := config.Get().Agents[name]
+	description := agentCfg.Description
+	if len(agentCfg.Tools) > 0 {
+		description += fmt.Sprintf(" (tools: %s)", strings.Join(agentCfg.Tools, ", "))
+	}
+	return description
+}
+
 func (b *agentTool) Run(ctx context.Context, call tools.ToolCall) (tools.ToolResponse, error) {
 	var params AgentParams
 	if err := json.Unmarshal([]byte(call.Input), &params); err != nil {
@@ -48,23 +119,56 @@ func (b *agentTool) Run(ctx context.Context, call tools.ToolCall) (tools.ToolRes
 	if params.Prompt == "" {
 		return tools.NewTextErrorResponse("prompt is required"), nil
 	}
+	subAgent := config.AgentName(params.SubAgent)
+	if subAgent == "" {
+		subAgent = config.AgentTask
+	}
+	if !slices.Contains(config.SubAgents(), subAgent) {
+		return tools.NewTextErrorResponse(fmt.Sprintf("unknown sub-agent: %s", subAgent)), nil
+	}
 
 	sessionID, messageID := tools.GetContextValues(ctx)
 	if sessionID == "" || messageID == "" {
 		return tools.ToolResponse{}, fmt.Errorf("session_id and message_id are required")
 	}
 
-	agent, err := NewAgent(config.AgentTask, b.sessions, b.messages, TaskAgentTools(b.lspClients))
+	var subSession session.Session
+	if params.SessionID != "" {
+		var err error
+		subSession, err = b.sessions.Get(ctx, params.SessionID)
+		if err != nil || subSession.ParentSessionID != sessionID {
+			return tools.NewTextErrorResponse(fmt.Sprintf("no sub-agent session %s in this session", params.SessionID)), nil
+		}
+	} else {
+		var err error
+		subSession, err = b.sessions.CreateTaskSession(ctx, call.ID, sessionID, "New Agent Session")
+		if err != nil {
+			return tools.ToolResponse{}, fmt.Errorf("error creating session: %s", err)
+		}
+	}
+	if !b.startRunning(subSession.ID) {
+		return tools.NewTextErrorResponse(fmt.Sprintf("sub-agent session %s is already running", subSession.ID)), nil
+	}
+	defer b.stopRunning(subSession.ID)
+	// Sub-agents of an auto-approved session don't ask for permissions either
+	if b.permissions.IsAutoApproved(sessionID) && !b.permissions.IsAutoApproved(subSession.ID) {
+		b.permissions.AutoApproveSession(subSession.ID)
+	}
+
+	a, err := NewAgent(subAgent, b.sessions, b.messages, subAgentTools(subAgent, b.permissions, b.sessions, b.messages, b.history, b.lspClients))
 	if err != nil {
 		return tools.ToolResponse{}, fmt.Errorf("error creating agent: %s", err)
 	}
 
-	session, err := b.sessions.CreateTaskSession(ctx, call.ID, sessionID, "New Agent Session")
-	if err != nil {
-		return tools.ToolResponse{}, fmt.Errorf("error creating session: %s", err)
+	if parent, ok := ctx.Value(parentAgentContextKey{}).(*agent); ok {
+		progressCtx, stopProgress := context.WithCancel(ctx)
+		defer stopProgress()
+		go forwardProgress(b.messages.Subscribe(progressCtx), parent, sessionID, call.ID, subSession.ID)
 	}
 
-	done, err := agent.Run(ctx, session.ID, params.Prompt)
+	// The instructions for the parent's request, such as the scene to write,
+	// are not the sub-agent's
+	done, err := a.Run(provider.WithoutSystemContext(ctx), subSession.ID, params.Prompt)
 	if err != nil {
 		return tools.ToolResponse{}, fmt.Errorf("error generating agent: %s", err)
 	}
@@ -78,32 +182,93 @@ func (b *agentTool) Run(ctx context.Context, call tools.ToolCall) (tools.ToolRes
 		return tools.NewTextErrorResponse("no response"), nil
 	}
 
-	updatedSession, err := b.sessions.Get(ctx, session.ID)
+	updatedSession, err := b.sessions.Get(ctx, subSession.ID)
 	if err != nil {
 		return tools.ToolResponse{}, fmt.Errorf("error getting session: %s", err)
 	}
+
+	b.costMu.Lock()
+	defer b.costMu.Unlock()
 	parentSession, err := b.sessions.Get(ctx, sessionID)
 	if err != nil {
 		return tools.ToolResponse{}, fmt.Errorf("error getting parent session: %s", err)
 	}
 
-	parentSession.Cost += updatedSession.Cost
+	// Credit what this run used, a continued session was credited before
+	parentSession.Cost += updatedSession.Cost - subSession.Cost
+	parentSession.TotalPromptTokens += updatedSession.TotalPromptTokens - subSession.TotalPromptTokens
+	parentSession.TotalCompletionTokens += updatedSession.TotalCompletionTokens - subSession.TotalCompletionTokens
 
 	_, err = b.sessions.Save(ctx, parentSession)
 	if err != nil {
 		return tools.ToolResponse{}, fmt.Errorf("error saving parent session: %s", err)
 	}
-	return tools.NewTextResponse(response.Content().String()), nil
+	return tools.WithResponseMetadata(
+		tools.NewTextResponse(fmt.Sprintf("%s\n\nsession_id: %s", response.Content().String(), subSession.ID)),
+		AgentResponseMetadata{
+			SubAgent:  string(subAgent),
+			SessionID: subSession.ID,
+		},
+	), nil
+}
+
+func (b *agentTool) startRunning(sessionID string) bool {
+	b.runningMu.Lock()
+	defer b.runningMu.Unlock()
+	if b.running[sessionID] {
+		return false
+	}
+	b.running[sessionID] = true
+	return true
+}
+
+func (b *agentTool) stopRunning(sessionID string) {
+	b.runningMu.Lock()
+	defer b.runningMu.Unlock()
+	delete(b.running, sessionID)
+}
+
+// forwardProgress publishes the messages of the sub-agent's session as events
+// of the parent agent, under the tool call running the sub-agent.
+func forwardProgress(events <-chan pubsub.Event[message.Message], parent *agent, sessionID, toolCallID, subSessionID string) {
+	defer logging.RecoverPanic("agent-tool-progress", nil)
+
+	for event := range events {
+		if event.Payload.SessionID != subSessionID {
+			continue
+		}
+		parent.Publish(event.Type, AgentEvent{
+			Type:       AgentEventTypeSubAgent,
+			Message:    event.Payload,
+			SessionID:  sessionID,
+			ToolCallID: toolCallID,
+		})
+	}
+}
+
+// SubAgentSessionID returns the session an agent tool call runs in: the one it
+// continues, or the new one named after the call.
+func SubAgentSessionID(call message.ToolCall) string {
+	var params AgentParams
+	if err := json.Unmarshal([]byte(call.Input), &params); err == nil && params.SessionID != "" {
+		return params.SessionID
+	}
+	return call.ID
 }
 
 func NewAgentTool(
 	Sessions session.Service,
 	Messages message.Service,
+	Permissions permission.Service,
+	History history.Service,
 	LspClients map[string]*lsp.Client,
 ) tools.BaseTool {
 	return &agentTool{
-		sessions:   Sessions,
-		messages:   Messages,
-		lspClients: LspClients,
+		sessions:    Sessions,
+		messages:    Messages,
+		permissions: Permissions,
+		history:     History,
+		lspClients:  LspClients,
+		running:     make(map[string]bool),
 	}
 }
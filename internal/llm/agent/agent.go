@@ -2,11 +2,11 @@ package agent
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
 	"sync"
-	"time"
 
 	"github.com/opencode-ai/opencode/internal/config"
 	"github.com/opencode-ai/opencode/internal/llm/models"
@@ -24,6 +24,7 @@ import (
 var (
 	ErrRequestCancelled = errors.New("request cancelled by user")
 	ErrSessionBusy      = errors.New("session is currently processing another request")
+	ErrLimitReached     = errors.New("agent limit reached")
 )
 
 type AgentEventType string
@@ -32,6 +33,14 @@ const (
 	AgentEventTypeError     AgentEventType = "error"
 	AgentEventTypeResponse  AgentEventType = "response"
 	AgentEventTypeSummarize AgentEventType = "summarize"
+	// The turn was stopped by one of the agent's limits, Error tells which
+	AgentEventTypeLimitReached AgentEventType = "limit_reached"
+	// The model failed and the next fallback model takes over, Error holds
+	// the failure
+	AgentEventTypeFallback AgentEventType = "fallback"
+	// A sub-agent run by the agent tool updated a message of its session,
+	// ToolCallID is the agent tool call it runs under
+	AgentEventTypeSubAgent AgentEventType = "subagent"
 )
 
 type AgentEvent struct {
@@ -43,8 +52,15 @@ type AgentEvent struct {
 	SessionID string
 	Progress  string
 	Done      bool
+
+	// For sub-agent events
+	ToolCallID string
 }
 
+// parentAgentContextKey carries the agent running a tool call, so that the
+// agent tool can report the progress of its sub-agent through it.
+type parentAgentContextKey struct{}
+
 type Service interface {
 	pubsub.Suscriber[AgentEvent]
 	Model() models.Model
@@ -54,20 +70,31 @@ type Service interface {
 	IsBusy() bool
 	Update(agentName config.AgentName, modelID models.ModelID) (models.Model, error)
 	Summarize(ctx context.Context, sessionID string) error
+
+	// A session in plan mode only gets read-only tools and answers with a
+	// plan, ExecutePlan leaves plan mode and runs the approved plan.
+	SetPlanMode(sessionID string, enabled bool)
+	PlanMode(sessionID string) bool
+	ExecutePlan(ctx context.Context, sessionID string, plan string) (<-chan AgentEvent, error)
 }
 
 type agent struct {
 	*pubsub.Broker[AgentEvent]
+	name     config.AgentName
 	sessions session.Service
 	messages message.Service
 
-	tools    []tools.BaseTool
-	provider provider.Provider
+	tools     []tools.BaseTool
+	provider  provider.Provider
+	fallbacks []provider.Provider
+	// recorder records the responses of provider and fallbacks in debug mode
+	recorder *provider.CassetteRecorder
 
 	titleProvider     provider.Provider
 	summarizeProvider provider.Provider
 
 	activeRequests sync.Map
+	planSessions   sync.Map
 }
 
 func NewAgent(
@@ -77,20 +104,26 @@ func NewAgent(
 	agentTools []tools.BaseTool,
 ) (Service, error) {
 	logging.Info("Creating agent with args ", "agentName", agentName, "sessionService", sessions, "messageService", messages, "agentTools", agentTools)
-	agentProvider, err := createAgentProvider(agentName)
+	// Record the session as a cassette next to the debug message logs
+	var recorder *provider.CassetteRecorder
+	if config.Get().Debug {
+		recorder = provider.NewCassetteRecorder()
+	}
+	agentProvider, fallbacks, err := createProviders(agentName, recorder)
 	if err != nil {
 		return nil, err
 	}
+	// Only generate titles and summaries for the agents of user sessions
+	userAgent := runsUserSessions(agentName)
 	var titleProvider provider.Provider
-	// Only generate titles for the coder agent
-	if agentName == config.AgentCoder {
+	if userAgent {
 		titleProvider, err = createAgentProvider(config.AgentTitle)
 		if err != nil {
 			return nil, err
 		}
 	}
 	var summarizeProvider provider.Provider
-	if agentName == config.AgentCoder {
+	if userAgent {
 		summarizeProvider, err = createAgentProvider(config.AgentSummarizer)
 		if err != nil {
 			return nil, err
@@ -99,10 +132,13 @@ func NewAgent(
 
 	agent := &agent{
 		Broker:            pubsub.NewBroker[AgentEvent](),
+		name:              agentName,
 		provider:          agentProvider,
+		fallbacks:         fallbacks,
+		recorder:          recorder,
 		messages:          messages,
 		sessions:          sessions,
-		tools:             agentTools,
+		tools:             allowedTools(agentName, agentTools),
 		titleProvider:     titleProvider,
 		summarizeProvider: summarizeProvider,
 		activeRequests:    sync.Map{},
@@ -111,6 +147,29 @@ func NewAgent(
 	return agent, nil
 }
 
+// createProviders creates the provider of the agent's model and the providers
+// of its fallback models, wrapped by recorder when it is set.
+func createProviders(agentName config.AgentName, recorder *provider.CassetteRecorder) (provider.Provider, []provider.Provider, error) {
+	agentProvider, err := createAgentProvider(agentName)
+	if err != nil {
+		return nil, nil, err
+	}
+	fallbacks := createFallbackProviders(agentName)
+	if recorder != nil {
+		agentProvider = recorder.Record(agentProvider)
+		for i, fallback := range fallbacks {
+			fallbacks[i] = recorder.Record(fallback)
+		}
+	}
+	return agentProvider, fallbacks, nil
+}
+
+// runsUserSessions reports whether the agent answers the user directly: the
+// coder and the custom agents.
+func runsUserSessions(agentName config.AgentName) bool {
+	return agentName == config.AgentCoder || !config.IsBuiltinAgent(agentName)
+}
+
 func (a *agent) Model() models.Model {
 	return a.provider.Model()
 }
@@ -196,6 +255,15 @@ func (a *agent) err(err error) AgentEvent {
 	}
 }
 
+func (a *agent) limitReached(msg message.Message, err error) AgentEvent {
+	return AgentEvent{
+		Type:    AgentEventTypeLimitReached,
+		Message: msg,
+		Error:   err,
+		Done:    true,
+	}
+}
+
 func (a *agent) Run(ctx context.Context, sessionID string, content string, attachments ...message.Attachment) (<-chan AgentEvent, error) {
 	if !a.provider.Model().SupportsAttachments && attachments != nil {
 		attachments = nil
@@ -218,7 +286,9 @@ func (a *agent) Run(ctx context.Context, sessionID string, content string, attac
 			attachmentParts = append(attachmentParts, message.BinaryContent{Path: attachment.FilePath, MIMEType: attachment.MimeType, Data: attachment.Content})
 		}
 		result := a.processGeneration(genCtx, sessionID, content, attachmentParts)
-		if result.Error != nil && !errors.Is(result.Error, ErrRequestCancelled) && !errors.Is(result.Error, context.Canceled) {
+		if errors.Is(result.Error, ErrLimitReached) {
+			logging.WarnPersist(result.Error.Error())
+		} else if result.Error != nil && !errors.Is(result.Error, ErrRequestCancelled) && !errors.Is(result.Error, context.Canceled) {
 			logging.ErrorPersist(result.Error.Error())
 		}
 		logging.Debug("Request completed", "sessionID", sessionID)
@@ -238,7 +308,12 @@ func (a *agent) processGeneration(ctx context.Context, sessionID, content string
 	if err != nil {
 		return a.err(fmt.Errorf("failed to list messages: %w", err))
 	}
-	if len(msgs) == 0 {
+	session, err := a.sessions.Get(ctx, sessionID)
+	if err != nil {
+		return a.err(fmt.Errorf("failed to get session: %w", err))
+	}
+	// Sessions of sub-agents are never listed, they don't need a title
+	if len(msgs) == 0 && session.ParentSessionID == "" {
 		go func() {
 			defer logging.RecoverPanic("agent.Run", func() {
 				logging.ErrorPersist("panic while generating title")
@@ -249,10 +324,6 @@ func (a *agent) processGeneration(ctx context.Context, sessionID, content string
 			}
 		}()
 	}
-	session, err := a.sessions.Get(ctx, sessionID)
-	if err != nil {
-		return a.err(fmt.Errorf("failed to get session: %w", err))
-	}
 	if session.SummaryMessageID != "" {
 		summaryMsgInex := -1
 		for i, msg := range msgs {
@@ -266,6 +337,14 @@ func (a *agent) processGeneration(ctx context.Context, sessionID, content string
 			msgs[0].Role = message.User
 		}
 	}
+	if a.PlanMode(sessionID) {
+		ctx = context.WithValue(ctx, planModeContextKey{}, sessionID)
+	}
+	chain := a.newProviderChain()
+	budget := newTurnBudget(cfg.Agents[a.name])
+	if err := budget.checkCost(session); err != nil {
+		return a.limitReached(message.Message{}, err)
+	}
 
 	userMsg, err := a.createUserMessage(ctx, sessionID, content, attachmentParts)
 	if err != nil {
@@ -282,7 +361,14 @@ func (a *agent) processGeneration(ctx context.Context, sessionID, content string
 		default:
 			// Continue processing
 		}
-		agentMessage, toolResults, err := a.streamAndHandleEvents(ctx, sessionID, msgHistory)
+		msgHistory, err = a.autoCompact(ctx, sessionID, msgHistory)
+		if err != nil {
+			if ctx.Err() != nil {
+				return a.err(ctx.Err())
+			}
+			return a.err(fmt.Errorf("failed to compact the conversation: %w", err))
+		}
+		agentMessage, toolResults, err := a.streamAndHandleEvents(ctx, sessionID, chain, msgHistory)
 		if err != nil {
 			if errors.Is(err, context.Canceled) {
 				agentMessage.AddFinish(message.FinishReasonCanceled)
@@ -301,6 +387,14 @@ func (a *agent) processGeneration(ctx context.Context, sessionID, content string
 		if (agentMessage.FinishReason() == message.FinishReasonToolUse) && toolResults != nil {
 			// We are not done, we need to respond with the tool response
 			msgHistory = append(msgHistory, agentMessage, *toolResults)
+			if err := a.checkLimits(ctx, sessionID, budget, agentMessage); err != nil {
+				if !errors.Is(err, ErrLimitReached) {
+					return a.err(err)
+				}
+				agentMessage.AddFinish(message.FinishReasonLimitReached)
+				a.messages.Update(context.Background(), agentMessage)
+				return a.limitReached(agentMessage, err)
+			}
 			continue
 		}
 		return AgentEvent{
@@ -311,6 +405,22 @@ func (a *agent) processGeneration(ctx context.Context, sessionID, content string
 	}
 }
 
+// checkLimits records a tool-use step of the turn and checks it, and the cost
+// of the session so far, against the limits of the agent.
+func (a *agent) checkLimits(ctx context.Context, sessionID string, budget *turnBudget, agentMessage message.Message) error {
+	if err := budget.step(agentMessage.ToolCalls()); err != nil {
+		return err
+	}
+	if budget.limits.MaxCost <= 0 {
+		return nil
+	}
+	sess, err := a.sessions.Get(ctx, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to get session: %w", err)
+	}
+	return budget.checkCost(sess)
+}
+
 func (a *agent) createUserMessage(ctx context.Context, sessionID, content string, attachmentParts []message.ContentPart) (message.Message, error) {
 	parts := []message.ContentPart{message.TextContent{Text: content}}
 	parts = append(parts, attachmentParts...)
@@ -320,106 +430,25 @@ func (a *agent) createUserMessage(ctx context.Context, sessionID, content string
 	})
 }
 
-func (a *agent) streamAndHandleEvents(ctx context.Context, sessionID string, msgHistory []message.Message) (message.Message, *message.Message, error) {
+func (a *agent) streamAndHandleEvents(ctx context.Context, sessionID string, chain *providerChain, msgHistory []message.Message) (message.Message, *message.Message, error) {
 	ctx = context.WithValue(ctx, tools.SessionIDContextKey, sessionID)
-	eventChan := a.provider.StreamResponse(ctx, msgHistory, a.tools)
-
-	assistantMsg, err := a.messages.Create(ctx, sessionID, message.CreateMessageParams{
-		Role:  message.Assistant,
-		Parts: []message.ContentPart{},
-		Model: a.provider.Model().ID,
-	})
+	ctx = provider.WithCassetteSession(ctx, sessionID)
+	assistantMsg, err := a.streamWithFallback(ctx, sessionID, chain, msgHistory)
 	if err != nil {
-		return assistantMsg, nil, fmt.Errorf("failed to create assistant message: %w", err)
+		return assistantMsg, nil, err
 	}
 
-	// Add the session and message ID into the context if needed by tools.
+	// Add the message ID into the context if needed by tools.
 	ctx = context.WithValue(ctx, tools.MessageIDContextKey, assistantMsg.ID)
+	ctx = context.WithValue(ctx, parentAgentContextKey{}, a)
 
-	// Process each event in the stream.
-	for event := range eventChan {
-		if processErr := a.processEvent(ctx, sessionID, &assistantMsg, event); processErr != nil {
-			a.finishMessage(ctx, &assistantMsg, message.FinishReasonCanceled)
-			return assistantMsg, nil, processErr
-		}
-		if ctx.Err() != nil {
-			a.finishMessage(context.Background(), &assistantMsg, message.FinishReasonCanceled)
-			return assistantMsg, nil, ctx.Err()
-		}
-	}
-
-	toolResults := make([]message.ToolResult, len(assistantMsg.ToolCalls()))
-	toolCalls := assistantMsg.ToolCalls()
-	for i, toolCall := range toolCalls {
-		select {
-		case <-ctx.Done():
-			a.finishMessage(context.Background(), &assistantMsg, message.FinishReasonCanceled)
-			// Make all future tool calls cancelled
-			for j := i; j < len(toolCalls); j++ {
-				toolResults[j] = message.ToolResult{
-					ToolCallID: toolCalls[j].ID,
-					Content:    "Tool execution canceled by user",
-					IsError:    true,
-				}
-			}
-			goto out
-		default:
-			// Continue processing
-			var tool tools.BaseTool
-			for _, availableTool := range a.tools {
-				if availableTool.Info().Name == toolCall.Name {
-					tool = availableTool
-					break
-				}
-				// Monkey patch for Copilot Sonnet-4 tool repetition obfuscation
-				// if strings.HasPrefix(toolCall.Name, availableTool.Info().Name) &&
-				// 	strings.HasPrefix(toolCall.Name, availableTool.Info().Name+availableTool.Info().Name) {
-				// 	tool = availableTool
-				// 	break
-				// }
-			}
-
-			// Tool not found
-			if tool == nil {
-				toolResults[i] = message.ToolResult{
-					ToolCallID: toolCall.ID,
-					Content:    fmt.Sprintf("Tool not found: %s", toolCall.Name),
-					IsError:    true,
-				}
-				continue
-			}
-			toolResult, toolErr := tool.Run(ctx, tools.ToolCall{
-				ID:    toolCall.ID,
-				Name:  toolCall.Name,
-				Input: toolCall.Input,
-			})
-			if toolErr != nil {
-				if errors.Is(toolErr, permission.ErrorPermissionDenied) {
-					toolResults[i] = message.ToolResult{
-						ToolCallID: toolCall.ID,
-						Content:    "Permission denied",
-						IsError:    true,
-					}
-					for j := i + 1; j < len(toolCalls); j++ {
-						toolResults[j] = message.ToolResult{
-							ToolCallID: toolCalls[j].ID,
-							Content:    "Tool execution canceled by user",
-							IsError:    true,
-						}
-					}
-					a.finishMessage(ctx, &assistantMsg, message.FinishReasonPermissionDenied)
-					break
-				}
-			}
-			toolResults[i] = message.ToolResult{
-				ToolCallID: toolCall.ID,
-				Content:    toolResult.Content,
-				Metadata:   toolResult.Metadata,
-				IsError:    toolResult.IsError,
-			}
-		}
+	toolResults, stopReason := a.runToolCalls(ctx, assistantMsg.ToolCalls())
+	switch stopReason {
+	case message.FinishReasonCanceled:
+		a.finishMessage(context.Background(), &assistantMsg, message.FinishReasonCanceled)
+	case message.FinishReasonPermissionDenied:
+		a.finishMessage(ctx, &assistantMsg, message.FinishReasonPermissionDenied)
 	}
-out:
 	if len(toolResults) == 0 {
 		return assistantMsg, nil, nil
 	}
@@ -438,12 +467,222 @@ out:
 	return assistantMsg, &msg, err
 }
 
+// readOnlyTools do not change the working directory, calls to them may run
+// concurrently. Fetch still asks for permission, its prompts wait for each
+// other since a session shows one permission dialog at a time. Whether an
+// agent call may run concurrently depends on its sub-agent, see
+// concurrentCall.
+var readOnlyTools = map[string]bool{
+	tools.GlobToolName:        true,
+	tools.GrepToolName:        true,
+	tools.LSToolName:          true,
+	tools.ViewToolName:        true,
+	tools.SourcegraphToolName: true,
+	tools.FetchToolName:       true,
+	AgentToolName:             true,
+}
+
+// concurrentCall tells whether a tool call may run concurrently with others:
+// calls to read-only tools, and agent calls whose sub-agent only has read-only
+// tools, the task agent or a custom sub-agent with such an allowlist.
+func concurrentCall(call message.ToolCall) bool {
+	if call.Name != AgentToolName {
+		return readOnlyTools[call.Name]
+	}
+	var params AgentParams
+	if err := json.Unmarshal([]byte(call.Input), &params); err != nil {
+		return false
+	}
+	subAgent := config.AgentName(params.SubAgent)
+	if subAgent == "" || subAgent == config.AgentTask {
+		return true
+	}
+	allowlist := config.Get().Agents[subAgent].Tools
+	if len(allowlist) == 0 {
+		return false
+	}
+	for _, name := range allowlist {
+		if name == AgentToolName || !readOnlyTools[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// runToolCalls runs the tool calls of an assistant message. Consecutive
+// read-only calls run concurrently, up to the configured limit, the others one
+// at a time. Results keep the order of the calls. Once the context is
+// cancelled or a permission is denied, calls that have not started yet are
+// reported as cancelled and the reason is returned.
+func (a *agent) runToolCalls(ctx context.Context, toolCalls []message.ToolCall) ([]message.ToolResult, message.FinishReason) {
+	toolResults := make([]message.ToolResult, len(toolCalls))
+
+	var (
+		mu         sync.Mutex
+		stopReason message.FinishReason
+	)
+	stop := func(reason message.FinishReason) message.FinishReason {
+		mu.Lock()
+		defer mu.Unlock()
+		if stopReason == "" {
+			stopReason = reason
+		}
+		return stopReason
+	}
+
+	run := func(i int) {
+		toolCall := toolCalls[i]
+		reason := stop("")
+		if reason == "" && ctx.Err() != nil {
+			reason = stop(message.FinishReasonCanceled)
+		}
+		if reason != "" {
+			toolResults[i] = message.ToolResult{
+				ToolCallID: toolCall.ID,
+				Content:    "Tool execution canceled by user",
+				IsError:    true,
+			}
+			return
+		}
+
+		result, err := a.runTool(ctx, toolCall)
+		if errors.Is(err, permission.ErrorPermissionDenied) {
+			stop(message.FinishReasonPermissionDenied)
+		}
+		toolResults[i] = result
+	}
+
+	limit := max(config.Get().ParallelTools, 1)
+	for i := 0; i < len(toolCalls); {
+		end := i + 1
+		if limit > 1 && concurrentCall(toolCalls[i]) {
+			for end < len(toolCalls) && concurrentCall(toolCalls[end]) {
+				end++
+			}
+		}
+		if end-i == 1 {
+			run(i)
+			i = end
+			continue
+		}
+
+		logging.Debug("Running tool calls concurrently", "count", end-i, "limit", limit)
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, limit)
+		for j := i; j < end; j++ {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(j int) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				defer logging.RecoverPanic("agent.runToolCalls", func() {
+					toolResults[j] = message.ToolResult{
+						ToolCallID: toolCalls[j].ID,
+						Content:    "Tool execution failed",
+						IsError:    true,
+					}
+				})
+				run(j)
+			}(j)
+		}
+		wg.Wait()
+		i = end
+	}
+	return toolResults, stop("")
+}
+
+// runTool runs a single tool call. A permission denial is returned as the
+// error next to its result.
+func (a *agent) runTool(ctx context.Context, toolCall message.ToolCall) (message.ToolResult, error) {
+	var tool tools.BaseTool
+	for _, availableTool := range a.toolsFor(ctx) {
+		if availableTool.Info().Name == toolCall.Name {
+			tool = availableTool
+			break
+		}
+		// Monkey patch for Copilot Sonnet-4 tool repetition obfuscation
+		// if strings.HasPrefix(toolCall.Name, availableTool.Info().Name) &&
+		// 	strings.HasPrefix(toolCall.Name, availableTool.Info().Name+availableTool.Info().Name) {
+		// 	tool = availableTool
+		// 	break
+		// }
+	}
+
+	// Tool not found
+	if tool == nil {
+		return message.ToolResult{
+			ToolCallID: toolCall.ID,
+			Content:    fmt.Sprintf("Tool not found: %s", toolCall.Name),
+			IsError:    true,
+		}, nil
+	}
+	toolResult, toolErr := tool.Run(ctx, tools.ToolCall{
+		ID:    toolCall.ID,
+		Name:  toolCall.Name,
+		Input: toolCall.Input,
+	})
+	if errors.Is(toolErr, permission.ErrorPermissionDenied) {
+		return message.ToolResult{
+			ToolCallID: toolCall.ID,
+			Content:    "Permission denied",
+			IsError:    true,
+		}, toolErr
+	}
+	return message.ToolResult{
+		ToolCallID: toolCall.ID,
+		Content:    toolResult.Content,
+		Metadata:   toolResult.Metadata,
+		IsError:    toolResult.IsError,
+	}, nil
+}
+
+// streamResponse streams one response of the provider into a new assistant
+// message.
+func (a *agent) streamResponse(ctx context.Context, sessionID string, agentProvider provider.Provider, msgHistory []message.Message) (message.Message, error) {
+	model := agentProvider.Model()
+	if planSessionID, _ := ctx.Value(planModeContextKey{}).(string); planSessionID == sessionID {
+		// Only for this request, sub-agents don't answer with a plan
+		ctx = provider.WithSystemContext(ctx, prompt.PlanModePrompt)
+	}
+	eventChan := agentProvider.StreamResponse(ctx, historyFor(model, msgHistory), a.toolsFor(ctx))
+
+	assistantMsg, err := a.messages.Create(ctx, sessionID, message.CreateMessageParams{
+		Role:  message.Assistant,
+		Parts: []message.ContentPart{},
+		Model: model.ID,
+	})
+	if err != nil {
+		return assistantMsg, fmt.Errorf("failed to create assistant message: %w", err)
+	}
+
+	// Add the message ID into the context if needed by tools.
+	ctx = context.WithValue(ctx, tools.MessageIDContextKey, assistantMsg.ID)
+
+	// Process each event in the stream.
+	for event := range eventChan {
+		if processErr := a.processEvent(ctx, sessionID, model, &assistantMsg, event); processErr != nil {
+			a.finishMessage(ctx, &assistantMsg, message.FinishReasonCanceled)
+			return assistantMsg, processErr
+		}
+		if ctx.Err() != nil {
+			a.finishMessage(context.Background(), &assistantMsg, message.FinishReasonCanceled)
+			return assistantMsg, ctx.Err()
+		}
+	}
+	if ctx.Err() != nil {
+		// The stream was closed without an event after the cancellation
+		a.finishMessage(context.Background(), &assistantMsg, message.FinishReasonCanceled)
+		return assistantMsg, ctx.Err()
+	}
+	return assistantMsg, nil
+}
+
 func (a *agent) finishMessage(ctx context.Context, msg *message.Message, finishReson message.FinishReason) {
 	msg.AddFinish(finishReson)
 	_ = a.messages.Update(ctx, *msg)
 }
 
-func (a *agent) processEvent(ctx context.Context, sessionID string, assistantMsg *message.Message, event provider.ProviderEvent) error {
+func (a *agent) processEvent(ctx context.Context, sessionID string, model models.Model, assistantMsg *message.Message, event provider.ProviderEvent) error {
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
@@ -453,7 +692,7 @@ func (a *agent) processEvent(ctx context.Context, sessionID string, assistantMsg
 
 	switch event.Type {
 	case provider.EventThinkingDelta:
-		assistantMsg.AppendReasoningContent(event.Content)
+		assistantMsg.AppendReasoningContent(event.Thinking)
 		return a.messages.Update(ctx, *assistantMsg)
 	case provider.EventContentDelta:
 		assistantMsg.AppendContent(event.Content)
@@ -478,15 +717,15 @@ func (a *agent) processEvent(ctx context.Context, sessionID string, assistantMsg
 			logging.InfoPersist(fmt.Sprintf("Event processing canceled for session: %s", sessionID))
 			return context.Canceled
 		}
-		logging.ErrorPersist(event.Error.Error())
-		return event.Error
+		logging.Error("Provider error", "model", model.ID, "error", event.Error)
+		return &providerError{model: model.ID, err: event.Error}
 	case provider.EventComplete:
 		assistantMsg.SetToolCalls(event.Response.ToolCalls)
 		assistantMsg.AddFinish(event.Response.FinishReason)
 		if err := a.messages.Update(ctx, *assistantMsg); err != nil {
 			return fmt.Errorf("failed to update message: %w", err)
 		}
-		return a.TrackUsage(ctx, sessionID, a.provider.Model(), event.Response.Usage)
+		return a.TrackUsage(ctx, sessionID, model, event.Response.Usage)
 	}
 
 	return nil
@@ -506,6 +745,7 @@ func (a *agent) TrackUsage(ctx context.Context, sessionID string, model models.M
 	sess.Cost += cost
 	sess.CompletionTokens = usage.OutputTokens + usage.CacheReadTokens
 	sess.PromptTokens = usage.InputTokens + usage.CacheCreationTokens
+	addTotalUsage(&sess, usage)
 
 	_, err = a.sessions.Save(ctx, sess)
 	if err != nil {
@@ -514,6 +754,12 @@ func (a *agent) TrackUsage(ctx context.Context, sessionID string, model models.M
 	return nil
 }
 
+// addTotalUsage adds the tokens of a request to the session's totals.
+func addTotalUsage(sess *session.Session, usage provider.TokenUsage) {
+	sess.TotalPromptTokens += usage.InputTokens + usage.CacheCreationTokens
+	sess.TotalCompletionTokens += usage.OutputTokens + usage.CacheReadTokens
+}
+
 func (a *agent) Update(agentName config.AgentName, modelID models.ModelID) (models.Model, error) {
 	if a.IsBusy() {
 		return models.Model{}, fmt.Errorf("cannot change model while processing requests")
@@ -523,12 +769,13 @@ func (a *agent) Update(agentName config.AgentName, modelID models.ModelID) (mode
 		return models.Model{}, fmt.Errorf("failed to update config: %w", err)
 	}
 
-	provider, err := createAgentProvider(agentName)
+	agentProvider, fallbacks, err := createProviders(agentName, a.recorder)
 	if err != nil {
 		return models.Model{}, fmt.Errorf("failed to create provider for model %s: %w", modelID, err)
 	}
 
-	a.provider = provider
+	a.provider = agentProvider
+	a.fallbacks = fallbacks
 
 	return a.provider.Model(), nil
 }
@@ -569,8 +816,6 @@ func (a *agent) Summarize(ctx context.Context, sessionID string) error {
 			a.Publish(pubsub.CreatedEvent, event)
 			return
 		}
-		summarizeCtx = context.WithValue(summarizeCtx, tools.SessionIDContextKey, sessionID)
-
 		if len(msgs) == 0 {
 			event = AgentEvent{
 				Type:  AgentEventTypeError,
@@ -581,138 +826,71 @@ func (a *agent) Summarize(ctx context.Context, sessionID string) error {
 			return
 		}
 
-		event = AgentEvent{
-			Type:     AgentEventTypeSummarize,
-			Progress: "Analyzing conversation...",
-		}
-		a.Publish(pubsub.CreatedEvent, event)
-
-		// Add a system message to guide the summarization
-		summarizePrompt := "Provide a detailed but concise summary of our conversation above. Focus on information that would be helpful for continuing the conversation, including what we did, what we're doing, which files we're working on, and what we're going to do next."
-
-		// Create a new message with the summarize prompt
-		promptMsg := message.Message{
-			Role:  message.User,
-			Parts: []message.ContentPart{message.TextContent{Text: summarizePrompt}},
-		}
-
-		// Append the prompt to the messages
-		msgsWithPrompt := append(msgs, promptMsg)
-
 		event = AgentEvent{
 			Type:     AgentEventTypeSummarize,
 			Progress: "Generating summary...",
 		}
 
 		a.Publish(pubsub.CreatedEvent, event)
-
-		// Send the messages to the summarize provider
-		response, err := a.summarizeProvider.SendMessages(
-			summarizeCtx,
-			msgsWithPrompt,
-			make([]tools.BaseTool, 0),
-		)
+		summary, usage, err := a.generateSummary(summarizeCtx, sessionID, msgs)
 		if err != nil {
 			event = AgentEvent{
 				Type:  AgentEventTypeError,
-				Error: fmt.Errorf("failed to summarize: %w", err),
-				Done:  true,
-			}
-			a.Publish(pubsub.CreatedEvent, event)
-			return
-		}
-
-		summary := strings.TrimSpace(response.Content)
-		if summary == "" {
-			event = AgentEvent{
-				Type:  AgentEventTypeError,
-				Error: fmt.Errorf("empty summary returned"),
+				Error: err,
 				Done:  true,
 			}
 			a.Publish(pubsub.CreatedEvent, event)
 			return
 		}
-		event = AgentEvent{
-			Type:     AgentEventTypeSummarize,
-			Progress: "Creating new session...",
-		}
-
-		a.Publish(pubsub.CreatedEvent, event)
-		oldSession, err := a.sessions.Get(summarizeCtx, sessionID)
-		if err != nil {
-			event = AgentEvent{
-				Type:  AgentEventTypeError,
-				Error: fmt.Errorf("failed to get session: %w", err),
-				Done:  true,
-			}
 
-			a.Publish(pubsub.CreatedEvent, event)
-			return
-		}
-		// Create a message in the new session with the summary
-		msg, err := a.messages.Create(summarizeCtx, oldSession.ID, message.CreateMessageParams{
-			Role: message.Assistant,
-			Parts: []message.ContentPart{
-				message.TextContent{Text: summary},
-				message.Finish{
-					Reason: message.FinishReasonEndTurn,
-					Time:   time.Now().Unix(),
-				},
-			},
-			Model: a.summarizeProvider.Model().ID,
-		})
-		if err != nil {
+		if _, err := a.saveSummary(summarizeCtx, sessionID, message.Assistant, summary, usage); err != nil {
 			event = AgentEvent{
 				Type:  AgentEventTypeError,
-				Error: fmt.Errorf("failed to create summary message: %w", err),
+				Error: err,
 				Done:  true,
 			}
-
 			a.Publish(pubsub.CreatedEvent, event)
 			return
 		}
-		oldSession.SummaryMessageID = msg.ID
-		oldSession.CompletionTokens = response.Usage.OutputTokens
-		oldSession.PromptTokens = 0
-		model := a.summarizeProvider.Model()
-		usage := response.Usage
-		cost := model.CostPer1MInCached/1e6*float64(usage.CacheCreationTokens) +
-			model.CostPer1MOutCached/1e6*float64(usage.CacheReadTokens) +
-			model.CostPer1MIn/1e6*float64(usage.InputTokens) +
-			model.CostPer1MOut/1e6*float64(usage.OutputTokens)
-		oldSession.Cost += cost
-		_, err = a.sessions.Save(summarizeCtx, oldSession)
-		if err != nil {
-			event = AgentEvent{
-				Type:  AgentEventTypeError,
-				Error: fmt.Errorf("failed to save session: %w", err),
-				Done:  true,
-			}
-			a.Publish(pubsub.CreatedEvent, event)
-		}
 
 		event = AgentEvent{
 			Type:      AgentEventTypeSummarize,
-			SessionID: oldSession.ID,
+			SessionID: sessionID,
 			Progress:  "Summary complete",
 			Done:      true,
 		}
 		a.Publish(pubsub.CreatedEvent, event)
-		// Send final success event with the new session ID
 	}()
 
 	return nil
 }
 
+// mockCoderOptions and mockAgentOptions configure the mock providers of the
+// coder and of the other agents, see SetMockOptions.
+var mockCoderOptions, mockAgentOptions []provider.MockOption
+
+// SetMockOptions sets the options of the mock providers created afterwards:
+// coder for the coder agent, others for every other agent. Without options
+// the mock provider answers every request with a fixed text.
+func SetMockOptions(coder, others []provider.MockOption) {
+	mockCoderOptions, mockAgentOptions = coder, others
+}
+
 func createAgentProvider(agentName config.AgentName) (provider.Provider, error) {
-	cfg := config.Get()
-	agentConfig, ok := cfg.Agents[agentName]
+	agentConfig, ok := config.Get().Agents[agentName]
 	if !ok {
 		return nil, fmt.Errorf("agent %s not found", agentName)
 	}
-	model, ok := models.SupportedModels[agentConfig.Model]
+	return createModelProvider(agentName, agentConfig, agentConfig.Model)
+}
+
+// createModelProvider creates a provider for the model with the settings of
+// the agent.
+func createModelProvider(agentName config.AgentName, agentConfig config.Agent, modelID models.ModelID) (provider.Provider, error) {
+	cfg := config.Get()
+	model, ok := models.SupportedModels[modelID]
 	if !ok {
-		return nil, fmt.Errorf("model %s not supported", agentConfig.Model)
+		return nil, fmt.Errorf("model %s not supported", modelID)
 	}
 
 	providerCfg, ok := cfg.Providers[model.Provider]
@@ -739,13 +917,19 @@ func createAgentProvider(agentName config.AgentName) (provider.Provider, error)
 				provider.WithReasoningEffort(agentConfig.ReasoningEffort),
 			),
 		)
-	} else if model.Provider == models.ProviderAnthropic && model.CanReason && agentName == config.AgentCoder {
+	} else if model.Provider == models.ProviderAnthropic && model.CanReason && runsUserSessions(agentName) {
 		opts = append(
 			opts,
 			provider.WithAnthropicOptions(
 				provider.WithAnthropicShouldThinkFn(provider.DefaultShouldThinkFn),
 			),
 		)
+	} else if model.Provider == models.ProviderMock {
+		mockOpts := mockAgentOptions
+		if agentName == config.AgentCoder {
+			mockOpts = mockCoderOptions
+		}
+		opts = append(opts, provider.WithMockOptions(mockOpts...))
 	}
 	agentProvider, err := provider.NewProvider(
 		model.Provider,
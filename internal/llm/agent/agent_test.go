@@ -0,0 +1,268 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/opencode-ai/opencode/internal/config"
+	"github.com/opencode-ai/opencode/internal/llm/models"
+	"github.com/opencode-ai/opencode/internal/llm/tools"
+	"github.com/opencode-ai/opencode/internal/message"
+	"github.com/opencode-ai/opencode/internal/permission"
+	"github.com/opencode-ai/opencode/internal/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTool records how many of its calls run at the same time.
+type fakeTool struct {
+	name    string
+	delay   time.Duration
+	err     error
+	running *atomic.Int32
+	peak    *atomic.Int32
+}
+
+func (f *fakeTool) Info() tools.ToolInfo {
+	return tools.ToolInfo{Name: f.name}
+}
+
+func (f *fakeTool) Run(ctx context.Context, call tools.ToolCall) (tools.ToolResponse, error) {
+	n := f.running.Add(1)
+	defer f.running.Add(-1)
+	for {
+		peak := f.peak.Load()
+		if n <= peak || f.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	time.Sleep(f.delay)
+	if f.err != nil {
+		return tools.ToolResponse{}, f.err
+	}
+	return tools.NewTextResponse(f.name + ":" + call.Input), nil
+}
+
+func newFakeAgent(t *testing.T, parallelTools int, fakeTools ...*fakeTool) (*agent, *atomic.Int32) {
+	t.Helper()
+	_, err := config.Load(t.TempDir(), false)
+	require.NoError(t, err)
+	config.Get().ParallelTools = parallelTools
+
+	var running, peak atomic.Int32
+	a := &agent{}
+	for _, tool := range fakeTools {
+		tool.running, tool.peak = &running, &peak
+		a.tools = append(a.tools, tool)
+	}
+	return a, &peak
+}
+
+func TestRunToolCalls_ReadOnlyConcurrently(t *testing.T) {
+	a, peak := newFakeAgent(t, 3,
+		&fakeTool{name: tools.ViewToolName, delay: 50 * time.Millisecond},
+		&fakeTool{name: tools.BashToolName, delay: 10 * time.Millisecond},
+	)
+
+	calls := []message.ToolCall{
+		{ID: "1", Name: tools.ViewToolName, Input: "a"},
+		{ID: "2", Name: tools.ViewToolName, Input: "b"},
+		{ID: "3", Name: tools.ViewToolName, Input: "c"},
+		{ID: "4", Name: tools.ViewToolName, Input: "d"},
+		{ID: "5", Name: tools.BashToolName, Input: "e"},
+		{ID: "6", Name: "missing"},
+	}
+	results, stopReason := a.runToolCalls(context.Background(), calls)
+
+	assert.Empty(t, stopReason)
+	assert.Equal(t, int32(3), peak.Load(), "read-only calls should run up to the limit at once")
+	want := []string{"view:a", "view:b", "view:c", "view:d", "bash:e", "Tool not found: missing"}
+	for i, result := range results {
+		assert.Equal(t, calls[i].ID, result.ToolCallID)
+		assert.Equal(t, want[i], result.Content)
+	}
+}
+
+func TestRunToolCalls_Sequential(t *testing.T) {
+	a, peak := newFakeAgent(t, 1, &fakeTool{name: tools.GrepToolName, delay: 5 * time.Millisecond})
+
+	calls := []message.ToolCall{
+		{ID: "1", Name: tools.GrepToolName},
+		{ID: "2", Name: tools.GrepToolName},
+	}
+	_, stopReason := a.runToolCalls(context.Background(), calls)
+
+	assert.Empty(t, stopReason)
+	assert.Equal(t, int32(1), peak.Load())
+}
+
+func TestRunToolCalls_PermissionDenied(t *testing.T) {
+	a, _ := newFakeAgent(t, 4,
+		&fakeTool{name: tools.BashToolName, err: permission.ErrorPermissionDenied},
+		&fakeTool{name: tools.ViewToolName},
+	)
+
+	calls := []message.ToolCall{
+		{ID: "1", Name: tools.ViewToolName},
+		{ID: "2", Name: tools.BashToolName},
+		{ID: "3", Name: tools.ViewToolName},
+	}
+	results, stopReason := a.runToolCalls(context.Background(), calls)
+
+	assert.Equal(t, message.FinishReasonPermissionDenied, stopReason)
+	assert.False(t, results[0].IsError)
+	assert.Equal(t, "Permission denied", results[1].Content)
+	assert.Equal(t, "Tool execution canceled by user", results[2].Content)
+}
+
+func TestRunToolCalls_Cancelled(t *testing.T) {
+	a, _ := newFakeAgent(t, 4, &fakeTool{name: tools.ViewToolName})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, stopReason := a.runToolCalls(ctx, []message.ToolCall{
+		{ID: "1", Name: tools.ViewToolName},
+		{ID: "2", Name: tools.ViewToolName},
+	})
+
+	assert.Equal(t, message.FinishReasonCanceled, stopReason)
+	for _, result := range results {
+		assert.True(t, result.IsError)
+		assert.Equal(t, "Tool execution canceled by user", result.Content)
+	}
+}
+
+func TestConcurrentCall(t *testing.T) {
+	_, err := config.Load(t.TempDir(), false)
+	require.NoError(t, err)
+	config.Get().Agents["reviewer"] = config.Agent{Tools: []string{tools.ViewToolName, tools.GrepToolName}}
+	config.Get().Agents["fixer"] = config.Agent{Tools: []string{tools.ViewToolName, tools.EditToolName}}
+	config.Get().Agents["builder"] = config.Agent{}
+	t.Cleanup(func() {
+		for _, name := range []config.AgentName{"reviewer", "fixer", "builder"} {
+			delete(config.Get().Agents, name)
+		}
+	})
+
+	agentCall := func(input string) message.ToolCall {
+		return message.ToolCall{Name: AgentToolName, Input: input}
+	}
+	assert.True(t, concurrentCall(message.ToolCall{Name: tools.ViewToolName}))
+	assert.False(t, concurrentCall(message.ToolCall{Name: tools.BashToolName}))
+	assert.True(t, concurrentCall(agentCall(`{"prompt":"find"}`)), "the task agent is read-only")
+	assert.True(t, concurrentCall(agentCall(`{"prompt":"review","subagent":"reviewer"}`)))
+	assert.False(t, concurrentCall(agentCall(`{"prompt":"fix","subagent":"fixer"}`)), "the fixer can edit")
+	assert.False(t, concurrentCall(agentCall(`{"prompt":"build","subagent":"builder"}`)), "no allowlist means the coder's tools")
+}
+
+func textMessage(role message.MessageRole, text string) message.Message {
+	return message.Message{Role: role, Parts: []message.ContentPart{message.TextContent{Text: text}}}
+}
+
+func TestNeedsCompaction(t *testing.T) {
+	model := models.Model{ContextWindow: 1000}
+	short := []message.Message{textMessage(message.User, strings.Repeat("a", 400))}
+	long := []message.Message{
+		textMessage(message.User, strings.Repeat("a", 2000)),
+		{Role: message.Assistant, Parts: []message.ContentPart{message.ToolCall{Name: "view", Input: strings.Repeat("b", 1600)}}},
+	}
+
+	assert.Equal(t, int64(100), estimateTokens(short))
+	assert.False(t, needsCompaction(model, short))
+	assert.True(t, needsCompaction(model, long))
+	assert.False(t, needsCompaction(models.Model{}, long), "unknown context windows are never compacted")
+}
+
+func TestRecentTurnsStart(t *testing.T) {
+	toolCall := message.Message{Role: message.Assistant, Parts: []message.ContentPart{message.ToolCall{Name: "view", Input: "1234"}}}
+	toolResult := message.Message{Role: message.Tool, Parts: []message.ContentPart{message.ToolResult{Name: "view", Content: strings.Repeat("x", 400)}}}
+	msgs := []message.Message{
+		textMessage(message.User, "first"),
+		textMessage(message.Assistant, "answer"),
+		textMessage(message.User, "second"),
+		toolCall,
+		toolResult,
+		toolCall,
+		toolResult,
+	}
+
+	assert.Equal(t, 2, recentTurnsStart(msgs, 1000))
+	// Only the last tool exchange fits, it starts after the first tool result
+	assert.Equal(t, 5, recentTurnsStart(msgs, 150))
+	// The last tool exchange is kept even when it doesn't fit
+	assert.Equal(t, 5, recentTurnsStart(msgs, 50))
+	assert.Equal(t, 0, recentTurnsStart(msgs[2:5], 50), "a single turn can't be compacted")
+}
+
+func TestTurnBudget(t *testing.T) {
+	view := message.ToolCall{Name: tools.ViewToolName, Input: `{"file_path":"a.go"}`}
+	other := message.ToolCall{Name: tools.ViewToolName, Input: `{"file_path":"b.go"}`}
+
+	t.Run("repeated tool calls", func(t *testing.T) {
+		budget := newTurnBudget(config.Agent{MaxRepeatedToolCalls: 3})
+		require.NoError(t, budget.step([]message.ToolCall{view, view}))
+		require.NoError(t, budget.step([]message.ToolCall{other}))
+		require.NoError(t, budget.step([]message.ToolCall{view, view}))
+		err := budget.step([]message.ToolCall{view})
+		assert.ErrorIs(t, err, ErrLimitReached)
+		assert.Contains(t, err.Error(), "3 times in a row")
+	})
+
+	t.Run("no repeat limit", func(t *testing.T) {
+		budget := newTurnBudget(config.Agent{})
+		for range 10 {
+			require.NoError(t, budget.step([]message.ToolCall{view}))
+		}
+	})
+
+	t.Run("max steps", func(t *testing.T) {
+		budget := newTurnBudget(config.Agent{MaxSteps: 2})
+		require.NoError(t, budget.step([]message.ToolCall{view}))
+		assert.ErrorIs(t, budget.step([]message.ToolCall{other}), ErrLimitReached)
+	})
+
+	t.Run("max cost", func(t *testing.T) {
+		budget := newTurnBudget(config.Agent{MaxCost: 1.5})
+		assert.NoError(t, budget.checkCost(session.Session{Cost: 1.49}))
+		assert.ErrorIs(t, budget.checkCost(session.Session{Cost: 1.5}), ErrLimitReached)
+		assert.NoError(t, newTurnBudget(config.Agent{}).checkCost(session.Session{Cost: 100}))
+	})
+}
+
+func TestHistoryFor(t *testing.T) {
+	msgs := []message.Message{{
+		Role: message.User,
+		Parts: []message.ContentPart{
+			message.TextContent{Text: "what is this?"},
+			message.BinaryContent{Path: "a.png", MIMEType: "image/png", Data: []byte{1}},
+		},
+	}}
+
+	assert.Equal(t, msgs, historyFor(models.Model{SupportsAttachments: true}, msgs))
+	adapted := historyFor(models.Model{}, msgs)
+	assert.Equal(t, []message.ContentPart{message.TextContent{Text: "what is this?"}}, adapted[0].Parts)
+	assert.Len(t, msgs[0].Parts, 2, "the history itself is not modified")
+}
+
+func TestAllowedTools(t *testing.T) {
+	_, err := config.Load(t.TempDir(), false)
+	require.NoError(t, err)
+	const reviewer config.AgentName = "reviewer"
+	config.Get().Agents[reviewer] = config.Agent{Tools: []string{"view", "missing", "grep"}}
+	t.Cleanup(func() { delete(config.Get().Agents, reviewer) })
+
+	all := []tools.BaseTool{&fakeTool{name: "bash"}, &fakeTool{name: "grep"}, &fakeTool{name: "view"}}
+	names := func(agentTools []tools.BaseTool) []string {
+		var names []string
+		for _, tool := range agentTools {
+			names = append(names, tool.Info().Name)
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"view", "grep"}, names(allowedTools(reviewer, all)), "unknown tools are skipped")
+	assert.Equal(t, all, allowedTools(config.AgentCoder, all), "no allowlist keeps every tool")
+}
@@ -0,0 +1,208 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/opencode-ai/opencode/internal/config"
+	"github.com/opencode-ai/opencode/internal/llm/models"
+	"github.com/opencode-ai/opencode/internal/llm/provider"
+	"github.com/opencode-ai/opencode/internal/llm/tools"
+	"github.com/opencode-ai/opencode/internal/logging"
+	"github.com/opencode-ai/opencode/internal/message"
+	"github.com/opencode-ai/opencode/internal/pubsub"
+)
+
+const (
+	// autoCompactThreshold is the share of the context window the history may
+	// fill before it is compacted. The rest is left for the system prompt, the
+	// tool definitions and the response.
+	autoCompactThreshold = 0.9
+	// compactKeepRatio is the share of the context window kept verbatim as
+	// recent turns after compaction.
+	compactKeepRatio = 0.2
+	// charsPerToken is a rough average that holds well enough for English
+	// text and code.
+	charsPerToken = 4
+	// binaryTokens is charged for every image or other attachment.
+	binaryTokens = 1500
+
+	summarizePrompt = "Provide a detailed but concise summary of our conversation above. Focus on information that would be helpful for continuing the conversation, including what we did, what we're doing, which files we're working on, and what we're going to do next."
+)
+
+// estimateTokens approximates the number of tokens the messages take up in
+// the prompt.
+func estimateTokens(msgs []message.Message) int64 {
+	var chars, tokens int64
+	for _, msg := range msgs {
+		for _, part := range msg.Parts {
+			switch p := part.(type) {
+			case message.TextContent:
+				chars += int64(len(p.Text))
+			case message.ToolCall:
+				chars += int64(len(p.Name) + len(p.Input))
+			case message.ToolResult:
+				chars += int64(len(p.Name) + len(p.Content))
+			case message.ImageURLContent:
+				chars += int64(len(p.URL))
+			case message.BinaryContent:
+				tokens += binaryTokens
+			}
+		}
+	}
+	return tokens + chars/charsPerToken
+}
+
+// needsCompaction reports whether the history has grown past the auto compact
+// threshold of the model's context window.
+func needsCompaction(model models.Model, msgs []message.Message) bool {
+	if model.ContextWindow <= 0 {
+		return false
+	}
+	return estimateTokens(msgs) >= int64(float64(model.ContextWindow)*autoCompactThreshold)
+}
+
+// recentTurnsStart returns the index of the oldest message that can be kept
+// verbatim within budget tokens. The last turn is kept even when it doesn't
+// fit, so the model continues where it stopped. Turns start at a user message
+// or right after tool results, so that tool calls are never separated from
+// their results. 0 means the history is a single turn and can't be compacted.
+func recentTurnsStart(msgs []message.Message, budget int64) int {
+	start := len(msgs)
+	var tokens int64
+	for i := len(msgs) - 1; i > 0; i-- {
+		tokens += estimateTokens(msgs[i : i+1])
+		if tokens > budget && start < len(msgs) {
+			break
+		}
+		if msgs[i].Role == message.User || (msgs[i].Role == message.Assistant && msgs[i-1].Role == message.Tool) {
+			start = i
+		}
+	}
+	if start == len(msgs) {
+		return 0
+	}
+	return start
+}
+
+// compactHistory summarizes the history through the summarizer and returns
+// the summary followed by the most recent turns. The summary covers the whole
+// history and becomes the session's summary message, so later runs that start
+// from it lose nothing. It is stored as a hidden summary message, the user
+// keeps seeing the conversation. Progress is reported as summarize events.
+func (a *agent) compactHistory(ctx context.Context, sessionID string, msgHistory []message.Message) ([]message.Message, error) {
+	budget := int64(float64(a.provider.Model().ContextWindow) * compactKeepRatio)
+	start := recentTurnsStart(msgHistory, budget)
+	if start == 0 {
+		logging.Debug("Nothing to compact before the last turn", "session_id", sessionID)
+		return msgHistory, nil
+	}
+
+	a.Publish(pubsub.CreatedEvent, AgentEvent{
+		Type:      AgentEventTypeSummarize,
+		SessionID: sessionID,
+		Progress:  "Compacting conversation...",
+	})
+
+	summary, usage, err := a.generateSummary(ctx, sessionID, msgHistory)
+	if err != nil {
+		return nil, err
+	}
+	summaryMsg, err := a.saveSummary(ctx, sessionID, message.Summary, summary, usage)
+	if err != nil {
+		return nil, err
+	}
+
+	recent := msgHistory[start:]
+	summaryMsg.Role = message.User
+	compacted := append([]message.Message{summaryMsg}, recent...)
+	logging.Info("Compacted conversation", "session_id", sessionID, "messages", len(msgHistory), "kept", len(recent))
+
+	a.Publish(pubsub.CreatedEvent, AgentEvent{
+		Type:      AgentEventTypeSummarize,
+		SessionID: sessionID,
+		Progress:  "Conversation compacted",
+		Done:      true,
+	})
+	return compacted, nil
+}
+
+// autoCompact compacts the history when auto compact is enabled and the
+// history is about to overflow the context window. Failures are logged and
+// the history is returned unchanged, only cancellation is reported.
+func (a *agent) autoCompact(ctx context.Context, sessionID string, msgHistory []message.Message) ([]message.Message, error) {
+	if !config.Get().AutoCompact || a.summarizeProvider == nil || !needsCompaction(a.provider.Model(), msgHistory) {
+		return msgHistory, nil
+	}
+	compacted, err := a.compactHistory(ctx, sessionID, msgHistory)
+	if err != nil {
+		if ctx.Err() != nil {
+			return msgHistory, ctx.Err()
+		}
+		logging.ErrorPersist(fmt.Sprintf("failed to compact conversation: %v", err))
+		return msgHistory, nil
+	}
+	return compacted, nil
+}
+
+// generateSummary asks the summarizer for a summary of the messages.
+func (a *agent) generateSummary(ctx context.Context, sessionID string, msgs []message.Message) (string, provider.TokenUsage, error) {
+	ctx = context.WithValue(ctx, tools.SessionIDContextKey, sessionID)
+	promptMsg := message.Message{
+		Role:  message.User,
+		Parts: []message.ContentPart{message.TextContent{Text: summarizePrompt}},
+	}
+	msgsWithPrompt := append(msgs[:len(msgs):len(msgs)], promptMsg)
+
+	response, err := a.summarizeProvider.SendMessages(ctx, msgsWithPrompt, make([]tools.BaseTool, 0))
+	if err != nil {
+		return "", provider.TokenUsage{}, fmt.Errorf("failed to summarize: %w", err)
+	}
+	summary := strings.TrimSpace(response.Content)
+	if summary == "" {
+		return "", provider.TokenUsage{}, fmt.Errorf("empty summary returned")
+	}
+	return summary, response.Usage, nil
+}
+
+// saveSummary stores the summary as a message of the role, an assistant
+// message the user sees or a hidden summary message, and makes it the
+// session's summary message, which later runs start from.
+func (a *agent) saveSummary(ctx context.Context, sessionID string, role message.MessageRole, summary string, usage provider.TokenUsage) (message.Message, error) {
+	sess, err := a.sessions.Get(ctx, sessionID)
+	if err != nil {
+		return message.Message{}, fmt.Errorf("failed to get session: %w", err)
+	}
+	model := a.summarizeProvider.Model()
+	parts := []message.ContentPart{message.TextContent{Text: summary}}
+	if role == message.Assistant {
+		// Other messages are finished when they are created
+		parts = append(parts, message.Finish{
+			Reason: message.FinishReasonEndTurn,
+			Time:   time.Now().Unix(),
+		})
+	}
+	msg, err := a.messages.Create(ctx, sessionID, message.CreateMessageParams{
+		Role:  role,
+		Parts: parts,
+		Model: model.ID,
+	})
+	if err != nil {
+		return message.Message{}, fmt.Errorf("failed to create summary message: %w", err)
+	}
+
+	sess.SummaryMessageID = msg.ID
+	sess.CompletionTokens = usage.OutputTokens
+	sess.PromptTokens = 0
+	sess.Cost += model.CostPer1MInCached/1e6*float64(usage.CacheCreationTokens) +
+		model.CostPer1MOutCached/1e6*float64(usage.CacheReadTokens) +
+		model.CostPer1MIn/1e6*float64(usage.InputTokens) +
+		model.CostPer1MOut/1e6*float64(usage.OutputTokens)
+	addTotalUsage(&sess, usage)
+	if _, err := a.sessions.Save(ctx, sess); err != nil {
+		return msg, fmt.Errorf("failed to save session: %w", err)
+	}
+	return msg, nil
+}
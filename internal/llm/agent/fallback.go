@@ -0,0 +1,121 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/opencode-ai/opencode/internal/config"
+	"github.com/opencode-ai/opencode/internal/llm/models"
+	"github.com/opencode-ai/opencode/internal/llm/provider"
+	"github.com/opencode-ai/opencode/internal/logging"
+	"github.com/opencode-ai/opencode/internal/message"
+	"github.com/opencode-ai/opencode/internal/pubsub"
+)
+
+// providerError is a failure reported by the provider after its own retries,
+// as opposed to a failure of the agent.
+type providerError struct {
+	model models.ModelID
+	err   error
+}
+
+func (e *providerError) Error() string {
+	return e.err.Error()
+}
+
+func (e *providerError) Unwrap() error {
+	return e.err
+}
+
+// createFallbackProviders creates the providers of the agent's fallback
+// models. Models that can't be used are skipped with a warning.
+func createFallbackProviders(agentName config.AgentName) []provider.Provider {
+	agentConfig := config.Get().Agents[agentName]
+	var fallbacks []provider.Provider
+	for _, modelID := range agentConfig.Fallbacks {
+		fallbackConfig := agentConfig
+		if model, ok := models.SupportedModels[modelID]; ok && model.ContextWindow > 0 && fallbackConfig.MaxTokens > model.ContextWindow/2 {
+			fallbackConfig.MaxTokens = model.ContextWindow / 2
+		}
+		fallback, err := createModelProvider(agentName, fallbackConfig, modelID)
+		if err != nil {
+			logging.Warn("Skipping fallback model", "agent", agentName, "model", modelID, "error", err)
+			continue
+		}
+		fallbacks = append(fallbacks, fallback)
+	}
+	return fallbacks
+}
+
+// providerChain is the primary provider of a turn followed by its fallbacks.
+// A turn stays on the provider it fell back to, the next turn starts with the
+// primary provider again.
+type providerChain struct {
+	providers []provider.Provider
+	current   int
+}
+
+func (a *agent) newProviderChain() *providerChain {
+	return &providerChain{providers: append([]provider.Provider{a.provider}, a.fallbacks...)}
+}
+
+func (c *providerChain) provider() provider.Provider {
+	return c.providers[c.current]
+}
+
+// next moves to the next fallback, it reports false when there is none.
+func (c *providerChain) next() bool {
+	if c.current+1 >= len(c.providers) {
+		return false
+	}
+	c.current++
+	return true
+}
+
+// streamWithFallback streams the response of the current provider of the
+// chain. When the provider fails, the failed message is removed and the next
+// fallback answers instead.
+func (a *agent) streamWithFallback(ctx context.Context, sessionID string, chain *providerChain, msgHistory []message.Message) (message.Message, error) {
+	for {
+		assistantMsg, err := a.streamResponse(ctx, sessionID, chain.provider(), msgHistory)
+		var provErr *providerError
+		if err == nil || ctx.Err() != nil || !errors.As(err, &provErr) || !chain.next() {
+			return assistantMsg, err
+		}
+
+		if delErr := a.messages.Delete(context.Background(), assistantMsg.ID); delErr != nil {
+			logging.Error("Failed to delete the failed assistant message", "error", delErr, "message_id", assistantMsg.ID)
+		}
+		fallbackModel := chain.provider().Model()
+		logging.Warn("Falling back to the next model", "session_id", sessionID, "failed_model", provErr.model, "model", fallbackModel.ID, "error", provErr.err)
+		a.Publish(pubsub.CreatedEvent, AgentEvent{
+			Type:      AgentEventTypeFallback,
+			SessionID: sessionID,
+			Error:     err,
+			Progress:  fmt.Sprintf("%s failed, falling back to %s", provErr.model, fallbackModel.ID),
+		})
+	}
+}
+
+// historyFor adapts the history to the model answering it. Attachments are
+// dropped for models that can't read them.
+func historyFor(model models.Model, msgs []message.Message) []message.Message {
+	if model.SupportsAttachments {
+		return msgs
+	}
+	adapted := make([]message.Message, len(msgs))
+	for i, msg := range msgs {
+		adapted[i] = msg
+		parts := make([]message.ContentPart, 0, len(msg.Parts))
+		for _, part := range msg.Parts {
+			switch part.(type) {
+			case message.BinaryContent, message.ImageURLContent:
+				continue
+			}
+			parts = append(parts, part)
+		}
+		adapted[i].Parts = parts
+	}
+	return adapted
+}
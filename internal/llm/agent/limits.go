@@ -0,0 +1,56 @@
+package agent
+
+import (
+	"fmt"
+
+	"github.com/opencode-ai/opencode/internal/config"
+	"github.com/opencode-ai/opencode/internal/message"
+	"github.com/opencode-ai/opencode/internal/session"
+)
+
+// turnBudget tracks one user turn against the limits of the agent.
+type turnBudget struct {
+	limits config.Agent
+
+	steps    int
+	lastCall message.ToolCall
+	repeats  int
+}
+
+func newTurnBudget(limits config.Agent) *turnBudget {
+	return &turnBudget{limits: limits}
+}
+
+// limitError wraps ErrLimitReached with the reason the turn was stopped.
+func limitError(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrLimitReached, fmt.Sprintf(format, args...))
+}
+
+// checkCost fails once the session has cost as much as the agent may spend.
+func (b *turnBudget) checkCost(sess session.Session) error {
+	if b.limits.MaxCost > 0 && sess.Cost >= b.limits.MaxCost {
+		return limitError("session cost $%.2f reached the limit of $%.2f", sess.Cost, b.limits.MaxCost)
+	}
+	return nil
+}
+
+// step records a tool-use iteration and its tool calls. It fails when the
+// turn has taken the maximum number of steps or the model keeps repeating the
+// same tool call.
+func (b *turnBudget) step(toolCalls []message.ToolCall) error {
+	b.steps++
+	for _, call := range toolCalls {
+		if b.repeats > 0 && call.Name == b.lastCall.Name && call.Input == b.lastCall.Input {
+			b.repeats++
+		} else {
+			b.lastCall, b.repeats = call, 1
+		}
+		if b.limits.MaxRepeatedToolCalls > 0 && b.repeats >= b.limits.MaxRepeatedToolCalls {
+			return limitError("the %s tool was called %d times in a row with the same input", call.Name, b.repeats)
+		}
+	}
+	if b.limits.MaxSteps > 0 && b.steps >= b.limits.MaxSteps {
+		return limitError("the turn took %d tool-use steps, the limit is %d", b.steps, b.limits.MaxSteps)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/opencode-ai/opencode/internal/llm/prompt"
+	"github.com/opencode-ai/opencode/internal/llm/tools"
+	"github.com/opencode-ai/opencode/internal/message"
+)
+
+// planModeContextKey carries the session in plan mode a turn plans for,
+// sub-agents started by the turn plan as well.
+type planModeContextKey struct{}
+
+// planTools are the tools available while planning: the read-only ones and
+// the checks that don't change anything.
+var planTools = map[string]bool{
+	tools.DiagnosticsToolName: true,
+	tools.SceneCheckToolName:  true,
+}
+
+func init() {
+	for name := range readOnlyTools {
+		planTools[name] = true
+	}
+}
+
+func (a *agent) SetPlanMode(sessionID string, enabled bool) {
+	if enabled {
+		a.planSessions.Store(sessionID, true)
+	} else {
+		a.planSessions.Delete(sessionID)
+	}
+}
+
+func (a *agent) PlanMode(sessionID string) bool {
+	_, ok := a.planSessions.Load(sessionID)
+	return ok
+}
+
+// ExecutePlan leaves plan mode and runs the plan, the latest plan of the
+// session when it is empty. The plan is stored as the user message of the
+// turn so that the history shows what was approved.
+func (a *agent) ExecutePlan(ctx context.Context, sessionID string, plan string) (<-chan AgentEvent, error) {
+	if a.IsSessionBusy(sessionID) {
+		return nil, ErrSessionBusy
+	}
+	if strings.TrimSpace(plan) == "" {
+		var err error
+		plan, err = LatestPlan(ctx, a.messages, sessionID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	a.SetPlanMode(sessionID, false)
+	return a.Run(ctx, sessionID, prompt.ApprovedPlanPrompt(plan))
+}
+
+// LatestPlan returns the text of the last assistant message of the session.
+func LatestPlan(ctx context.Context, messages message.Service, sessionID string) (string, error) {
+	msgs, err := messages.List(ctx, sessionID)
+	if err != nil {
+		return "", fmt.Errorf("failed to list messages: %w", err)
+	}
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].Role != message.Assistant {
+			continue
+		}
+		if text := strings.TrimSpace(msgs[i].Content().String()); text != "" {
+			return text, nil
+		}
+	}
+	return "", fmt.Errorf("no plan in session %s", sessionID)
+}
+
+// toolsFor returns the tools of the agent that may be used with ctx.
+func (a *agent) toolsFor(ctx context.Context) []tools.BaseTool {
+	if _, planning := ctx.Value(planModeContextKey{}).(string); !planning {
+		return a.tools
+	}
+	var allowed []tools.BaseTool
+	for _, tool := range a.tools {
+		if planTools[tool.Info().Name] {
+			allowed = append(allowed, tool)
+		}
+	}
+	return allowed
+}
@@ -0,0 +1,439 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencode-ai/opencode/internal/config"
+	"github.com/opencode-ai/opencode/internal/db"
+	"github.com/opencode-ai/opencode/internal/history"
+	"github.com/opencode-ai/opencode/internal/llm/models"
+	"github.com/opencode-ai/opencode/internal/llm/provider"
+	"github.com/opencode-ai/opencode/internal/llm/tools"
+	"github.com/opencode-ai/opencode/internal/logging"
+	"github.com/opencode-ai/opencode/internal/message"
+	"github.com/opencode-ai/opencode/internal/permission"
+	"github.com/opencode-ai/opencode/internal/pubsub"
+	"github.com/opencode-ai/opencode/internal/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockEnv is a coder agent backed by the mock provider, a real database and
+// real tools working in a temporary directory.
+type mockEnv struct {
+	agent       *agent
+	sessions    session.Service
+	messages    message.Service
+	permissions permission.Service
+	workDir     string
+}
+
+func newMockEnv(t *testing.T, script *provider.MockScript) *mockEnv {
+	t.Helper()
+	workDir := t.TempDir()
+	_, err := config.Load(workDir, false)
+	require.NoError(t, err)
+	// The config is loaded once per process, point it at this test's dirs
+	config.Get().WorkingDir = workDir
+	config.Get().Data.Directory = t.TempDir()
+
+	conn, err := db.Connect()
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	q := db.New(conn)
+
+	env := &mockEnv{
+		sessions:    session.NewService(q),
+		messages:    message.NewService(q),
+		permissions: permission.NewPermissionService(),
+		workDir:     workDir,
+	}
+	mockProvider, err := provider.NewProvider(
+		models.ProviderMock,
+		provider.WithModel(models.MockModels[models.MockModel]),
+		provider.WithMockOptions(provider.WithMockScript(script)),
+	)
+	require.NoError(t, err)
+
+	env.agent = &agent{
+		Broker:   pubsub.NewBroker[AgentEvent](),
+		name:     config.AgentCoder,
+		sessions: env.sessions,
+		messages: env.messages,
+		tools: []tools.BaseTool{
+			tools.NewViewTool(nil),
+			tools.NewWriteTool(nil, env.permissions, history.NewService(q, conn)),
+		},
+		provider: mockProvider,
+	}
+	return env
+}
+
+func (e *mockEnv) run(t *testing.T, ctx context.Context, prompt string) (session.Session, AgentEvent) {
+	t.Helper()
+	sess, err := e.sessions.Create(ctx, "test")
+	require.NoError(t, err)
+	done, err := e.agent.Run(ctx, sess.ID, prompt)
+	require.NoError(t, err)
+
+	select {
+	case result := <-done:
+		return sess, result
+	case <-time.After(10 * time.Second):
+		t.Fatal("agent did not finish")
+		return sess, AgentEvent{}
+	}
+}
+
+func TestRun_ToolLoop(t *testing.T) {
+	script := provider.NewMockScript().
+		Turn(
+			provider.MockThinking("The user wants the file."),
+			provider.MockText("Let me read it."),
+			provider.MockToolCall(tools.ViewToolName, `{"file_path":"hello.txt"}`),
+			provider.MockUsage(100, 20),
+		).
+		Turn(provider.MockText("It says hello."), provider.MockUsage(150, 10))
+	env := newMockEnv(t, script)
+	require.NoError(t, os.WriteFile(filepath.Join(env.workDir, "hello.txt"), []byte("hello\n"), 0o644))
+
+	sess, result := env.run(t, context.Background(), "What is in hello.txt?")
+
+	require.NoError(t, result.Error)
+	assert.Equal(t, AgentEventTypeResponse, result.Type)
+	assert.Equal(t, "It says hello.", result.Message.Content().String())
+	assert.Equal(t, models.MockModel, result.Message.Model)
+	assert.Zero(t, script.Remaining())
+
+	msgs, err := env.messages.List(context.Background(), sess.ID)
+	require.NoError(t, err)
+	roles := make([]message.MessageRole, len(msgs))
+	for i, msg := range msgs {
+		roles[i] = msg.Role
+	}
+	assert.Equal(t, []message.MessageRole{message.User, message.Assistant, message.Tool, message.Assistant}, roles)
+	assert.Equal(t, "The user wants the file.", msgs[1].ReasoningContent().Thinking)
+	assert.Equal(t, message.FinishReasonToolUse, msgs[1].FinishReason())
+	assert.Contains(t, msgs[2].ToolResults()[0].Content, "|hello")
+
+	// The second request carries the tool result back to the model
+	requests := script.Requests()
+	require.Len(t, requests, 2)
+	assert.Len(t, requests[1].Messages, 3)
+	assert.ElementsMatch(t, []string{tools.ViewToolName, tools.WriteToolName}, requests[0].Tools)
+
+	sess, err = env.sessions.Get(context.Background(), sess.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(150), sess.PromptTokens)
+}
+
+func TestRun_Cancel(t *testing.T) {
+	script := provider.NewMockScript().
+		Turn(provider.MockText("Working on it"), provider.MockDelay(5*time.Second), provider.MockText(" never sent"))
+	env := newMockEnv(t, script)
+
+	ctx := context.Background()
+	sess, err := env.sessions.Create(ctx, "test")
+	require.NoError(t, err)
+	done, err := env.agent.Run(ctx, sess.ID, "Start")
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		msgs, _ := env.messages.List(ctx, sess.ID)
+		return len(msgs) == 2 && msgs[1].Content().String() == "Working on it"
+	}, 5*time.Second, 10*time.Millisecond)
+	env.agent.Cancel(sess.ID)
+
+	result := <-done
+	assert.ErrorIs(t, result.Error, ErrRequestCancelled)
+	assert.False(t, env.agent.IsSessionBusy(sess.ID))
+
+	msgs, err := env.messages.List(ctx, sess.ID)
+	require.NoError(t, err)
+	assert.Equal(t, message.FinishReasonCanceled, msgs[1].FinishReason())
+	assert.Equal(t, "Working on it", msgs[1].Content().String())
+}
+
+func TestRun_PermissionDenied(t *testing.T) {
+	script := provider.NewMockScript().
+		Turn(
+			provider.MockToolCall(tools.WriteToolName, `{"file_path":"scene.tsx","content":"export default 1;"}`),
+			provider.MockToolCall(tools.ViewToolName, `{"file_path":"scene.tsx"}`),
+		)
+	env := newMockEnv(t, script)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		for event := range env.permissions.Subscribe(ctx) {
+			env.permissions.Deny(event.Payload)
+		}
+	}()
+
+	sess, result := env.run(t, ctx, "Write the scene")
+
+	require.NoError(t, result.Error)
+	assert.Equal(t, message.FinishReasonPermissionDenied, result.Message.FinishReason())
+	assert.Zero(t, script.Remaining(), "the model is not asked again after a denial")
+	assert.NoFileExists(t, filepath.Join(env.workDir, "scene.tsx"))
+
+	msgs, err := env.messages.List(ctx, sess.ID)
+	require.NoError(t, err)
+	require.Len(t, msgs, 3)
+	results := msgs[2].ToolResults()
+	require.Len(t, results, 2)
+	assert.True(t, results[0].IsError)
+	assert.Equal(t, "Tool execution canceled by user", results[1].Content)
+}
+
+func TestRun_ProviderError(t *testing.T) {
+	script := provider.NewMockScript().Turn(provider.MockText("Hal"), provider.MockError("overloaded"))
+	env := newMockEnv(t, script)
+
+	_, result := env.run(t, context.Background(), "Hi")
+
+	require.Error(t, result.Error)
+	assert.Contains(t, result.Error.Error(), "overloaded")
+}
+
+func TestRun_RecordAndReplay(t *testing.T) {
+	script := provider.NewMockScript().
+		Turn(provider.MockText("Let me read it."), provider.MockToolCall(tools.ViewToolName, `{"file_path":"hello.txt"}`)).
+		Turn(provider.MockText("It says hello."))
+	env := newMockEnv(t, script)
+	require.NoError(t, os.WriteFile(filepath.Join(env.workDir, "hello.txt"), []byte("hello\n"), 0o644))
+
+	messageDir := logging.MessageDir
+	logging.MessageDir = t.TempDir()
+	t.Cleanup(func() { logging.MessageDir = messageDir })
+	env.agent.provider = provider.NewCassetteRecorder().Record(env.agent.provider)
+
+	sess, result := env.run(t, context.Background(), "What is in hello.txt?")
+	require.NoError(t, result.Error)
+
+	cassette, err := provider.LoadCassette(filepath.Join(logging.MessageDir, logging.GetSessionPrefix(sess.ID)))
+	require.NoError(t, err)
+	assert.Equal(t, sess.ID, cassette.SessionID)
+	assert.Equal(t, []string{"What is in hello.txt?"}, cassette.Prompts())
+	require.Len(t, cassette.Turns, 2)
+	assert.Equal(t, models.MockModel, cassette.Turns[0].Model)
+	require.Len(t, cassette.Turns[0].ToolResults, 1)
+	assert.Contains(t, cassette.Turns[0].ToolResults[0].Content, "|hello")
+
+	// Replaying against changed files reports a different tool result
+	replay := newMockEnv(t, cassette.Script())
+	require.NoError(t, os.WriteFile(filepath.Join(replay.workDir, "hello.txt"), []byte("goodbye\n"), 0o644))
+	sess, result = replay.run(t, context.Background(), cassette.Prompts()[0])
+	require.NoError(t, result.Error)
+	assert.Equal(t, "It says hello.", result.Message.Content().String())
+
+	msgs, err := replay.messages.List(context.Background(), sess.ID)
+	require.NoError(t, err)
+	require.Len(t, msgs, 4)
+	replayed := msgs[2].ToolResults()[0]
+	recorded := cassette.ToolResults()[replayed.ToolCallID]
+	assert.Equal(t, cassette.Turns[0].ToolResults[0].ToolCallID, replayed.ToolCallID)
+	assert.Contains(t, replayed.Content, "|goodbye")
+	assert.NotEqual(t, recorded.Content, replayed.Content)
+}
+
+func TestRun_SubAgent(t *testing.T) {
+	script := provider.NewMockScript().
+		Turn(provider.MockEvent{ToolCall: &provider.MockToolCallEvent{ID: "call-1", Name: AgentToolName, Input: `{"prompt":"Find the scenes"}`}}).
+		Turn(provider.MockText("Found them.")).
+		Turn(provider.MockEvent{ToolCall: &provider.MockToolCallEvent{ID: "call-2", Name: AgentToolName, Input: `{"prompt":"And their tests?","session_id":"call-1"}`}}).
+		Turn(provider.MockText("Found those too."))
+	env := newMockEnv(t, script)
+	env.agent.tools = append(env.agent.tools, NewAgentTool(env.sessions, env.messages, env.permissions, nil, nil))
+
+	// The task agent answers from the mock provider without a script
+	models.EnableMockModel()
+	cfg := config.Get()
+	cfg.Providers[models.ProviderMock] = config.Provider{APIKey: "test"}
+	taskAgent := cfg.Agents[config.AgentTask]
+	cfg.Agents[config.AgentTask] = config.Agent{Model: models.MockModel}
+	t.Cleanup(func() {
+		cfg.Agents[config.AgentTask] = taskAgent
+		delete(cfg.Providers, models.ProviderMock)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := env.agent.Subscribe(ctx)
+
+	sess, result := env.run(t, ctx, "Where are the scenes?")
+	require.NoError(t, result.Error)
+	msgs, err := env.messages.List(ctx, sess.ID)
+	require.NoError(t, err)
+	require.Len(t, msgs, 4)
+	toolResult := msgs[2].ToolResults()[0]
+	assert.False(t, toolResult.IsError)
+	assert.Equal(t, "Mock response\n\nsession_id: call-1", toolResult.Content)
+
+	// The sub-agent's messages are reported under the tool call
+	var subAgentEvent AgentEvent
+	for subAgentEvent.Type != AgentEventTypeSubAgent {
+		select {
+		case event := <-events:
+			subAgentEvent = event.Payload
+		case <-time.After(time.Second):
+			t.Fatal("no sub-agent event")
+		}
+	}
+	assert.Equal(t, sess.ID, subAgentEvent.SessionID)
+	assert.Equal(t, "call-1", subAgentEvent.ToolCallID)
+	assert.Equal(t, "call-1", subAgentEvent.Message.SessionID)
+
+	// The next prompt continues the sub-agent's session
+	done, err := env.agent.Run(ctx, sess.ID, "And the tests?")
+	require.NoError(t, err)
+	result = <-done
+	require.NoError(t, result.Error)
+	assert.Equal(t, "Found those too.", result.Message.Content().String())
+
+	subMsgs, err := env.messages.List(ctx, "call-1")
+	require.NoError(t, err)
+	assert.Len(t, subMsgs, 4)
+	assert.Equal(t, "And their tests?", subMsgs[2].Content().String())
+	_, err = env.sessions.Get(ctx, "call-2")
+	assert.Error(t, err, "no new session is created")
+}
+
+func TestRun_SubAgentCassettes(t *testing.T) {
+	script := provider.NewMockScript().
+		Turn(provider.MockEvent{ToolCall: &provider.MockToolCallEvent{ID: "toolu_01scenes", Name: AgentToolName, Input: `{"prompt":"Find the scenes"}`}}).
+		Turn(provider.MockText("Found them."))
+	env := newMockEnv(t, script)
+	env.agent.tools = append(env.agent.tools, NewAgentTool(env.sessions, env.messages, env.permissions, nil, nil))
+
+	models.EnableMockModel()
+	cfg := config.Get()
+	cfg.Providers[models.ProviderMock] = config.Provider{APIKey: "test"}
+	taskAgent := cfg.Agents[config.AgentTask]
+	cfg.Agents[config.AgentTask] = config.Agent{Model: models.MockModel}
+	cfg.Debug = true
+	messageDir := logging.MessageDir
+	logging.MessageDir = t.TempDir()
+	t.Cleanup(func() {
+		cfg.Agents[config.AgentTask] = taskAgent
+		delete(cfg.Providers, models.ProviderMock)
+		cfg.Debug = false
+		logging.MessageDir = messageDir
+	})
+
+	// The task agent plays the cassette recorded for its session, sessions are
+	// named after the tool call that started them
+	cassetteDir := t.TempDir()
+	subCassette := `{"version":1,"session_id":"toolu_01scenes","turns":[{"events":[{"text":"In src/scenes."}]}]}`
+	require.NoError(t, os.WriteFile(filepath.Join(cassetteDir, provider.SubSessionCassetteFile("toolu_01scenes")), []byte(subCassette), 0o644))
+	SetMockOptions(nil, []provider.MockOption{provider.WithMockSubSessions(cassetteDir)})
+	t.Cleanup(func() { SetMockOptions(nil, nil) })
+	env.agent.provider = provider.NewCassetteRecorder().Record(env.agent.provider)
+
+	sess, result := env.run(t, context.Background(), "Where are the scenes?")
+	require.NoError(t, result.Error)
+	msgs, err := env.messages.List(context.Background(), sess.ID)
+	require.NoError(t, err)
+	require.Len(t, msgs, 4)
+	assert.Equal(t, "In src/scenes.\n\nsession_id: toolu_01scenes", msgs[2].ToolResults()[0].Content)
+
+	// and its turns are recorded next to the cassette of the session
+	recorded, err := provider.LoadCassette(filepath.Join(logging.MessageDir, logging.GetSessionPrefix(sess.ID), provider.SubSessionCassetteFile("toolu_01scenes")))
+	require.NoError(t, err)
+	assert.Equal(t, "toolu_01scenes", recorded.SessionID)
+	assert.Equal(t, []string{"Find the scenes"}, recorded.Prompts())
+}
+
+func TestRun_AutoCompact(t *testing.T) {
+	script := provider.NewMockScript().
+		Turn(provider.MockText("Hi.")).
+		Turn(provider.MockToolCall(tools.ViewToolName, `{"file_path":"hello.txt"}`)).
+		Turn(provider.MockText("It says hello."))
+	env := newMockEnv(t, script)
+	require.NoError(t, os.WriteFile(filepath.Join(env.workDir, "hello.txt"), []byte(strings.Repeat("hello\n", 400)), 0o644))
+	// The file overflows the context window once it has been read
+	model := models.MockModels[models.MockModel]
+	model.ContextWindow = 1000
+	var err error
+	env.agent.provider, err = provider.NewProvider(
+		models.ProviderMock,
+		provider.WithModel(model),
+		provider.WithMockOptions(provider.WithMockScript(script)),
+	)
+	require.NoError(t, err)
+	env.agent.summarizeProvider, err = provider.NewProvider(
+		models.ProviderMock,
+		provider.WithModel(model),
+		provider.WithMockOptions(provider.WithMockScript(provider.NewMockScript().Turn(provider.MockText("The user greeted.")))),
+	)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	sess, result := env.run(t, ctx, "Hello")
+	require.NoError(t, result.Error)
+	done, err := env.agent.Run(ctx, sess.ID, "What is in hello.txt?")
+	require.NoError(t, err)
+	result = <-done
+	require.NoError(t, result.Error)
+	assert.Equal(t, "It says hello.", result.Message.Content().String())
+
+	// The model continues with the summary and the whole last turn
+	requests := script.Requests()
+	require.Len(t, requests, 3)
+	last := requests[2].Messages
+	require.Len(t, last, 4)
+	assert.Equal(t, message.User, last[0].Role)
+	assert.Equal(t, "The user greeted.", last[0].Content().String())
+	assert.Equal(t, "What is in hello.txt?", last[1].Content().String())
+	assert.Equal(t, message.Tool, last[3].Role)
+
+	// The summary is stored hidden, later runs start from it
+	sess, err = env.sessions.Get(ctx, sess.ID)
+	require.NoError(t, err)
+	summary, err := env.messages.Get(ctx, sess.SummaryMessageID)
+	require.NoError(t, err)
+	assert.Equal(t, message.Summary, summary.Role)
+}
+
+func TestRun_PlanMode(t *testing.T) {
+	script := provider.NewMockScript().
+		Turn(provider.MockText("1. Write hello.txt")).
+		Turn(provider.MockToolCall(tools.WriteToolName, `{"file_path":"hello.txt","content":"hi"}`)).
+		Turn(provider.MockText("Done."))
+	env := newMockEnv(t, script)
+	ctx := context.Background()
+	sess, err := env.sessions.Create(ctx, "test")
+	require.NoError(t, err)
+	env.permissions.AutoApproveSession(sess.ID)
+
+	env.agent.SetPlanMode(sess.ID, true)
+	done, err := env.agent.Run(ctx, sess.ID, "Greet in hello.txt")
+	require.NoError(t, err)
+	result := <-done
+	require.NoError(t, result.Error)
+	plan, err := LatestPlan(ctx, env.messages, sess.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "1. Write hello.txt", plan)
+
+	// The plan is executed with every tool once plan mode is left
+	done, err = env.agent.ExecutePlan(ctx, sess.ID, plan+"\n2. Say done")
+	require.NoError(t, err)
+	result = <-done
+	require.NoError(t, result.Error)
+	assert.False(t, env.agent.PlanMode(sess.ID))
+	assert.FileExists(t, filepath.Join(env.workDir, "hello.txt"))
+
+	requests := script.Requests()
+	require.Len(t, requests, 3)
+	assert.Equal(t, []string{tools.ViewToolName}, requests[0].Tools)
+	assert.Contains(t, requests[0].System, "plan mode")
+	assert.ElementsMatch(t, []string{tools.ViewToolName, tools.WriteToolName}, requests[1].Tools)
+	assert.NotContains(t, requests[1].System, "plan mode")
+	approved := requests[1].Messages[len(requests[1].Messages)-1]
+	assert.Contains(t, approved.Content().String(), "1. Write hello.txt\n2. Say done")
+}
@@ -2,9 +2,12 @@ package agent
 
 import (
 	"context"
+	"slices"
 
+	"github.com/opencode-ai/opencode/internal/config"
 	"github.com/opencode-ai/opencode/internal/history"
 	"github.com/opencode-ai/opencode/internal/llm/tools"
+	"github.com/opencode-ai/opencode/internal/logging"
 	"github.com/opencode-ai/opencode/internal/lsp"
 	"github.com/opencode-ai/opencode/internal/message"
 	"github.com/opencode-ai/opencode/internal/permission"
@@ -31,11 +34,13 @@ func CoderAgentTools(
 			tools.NewGlobTool(),
 			tools.NewGrepTool(),
 			tools.NewLsTool(),
+			tools.NewLucidIconsTool(permissions, history),
+			tools.NewSceneCheckTool(lspClients),
 			tools.NewSourcegraphTool(),
 			tools.NewViewTool(lspClients),
 			tools.NewPatchTool(lspClients, permissions, history),
 			tools.NewWriteTool(lspClients, permissions, history),
-			NewAgentTool(sessions, messages, lspClients),
+			NewAgentTool(sessions, messages, permissions, history, lspClients),
 		}, otherTools...,
 	)
 }
@@ -49,3 +54,45 @@ func TaskAgentTools(lspClients map[string]*lsp.Client) []tools.BaseTool {
 		tools.NewViewTool(lspClients),
 	}
 }
+
+// subAgentTools returns the tools of a sub-agent run by the agent tool: the
+// read-only tools for the task agent, the coder's tools but the agent tool for
+// custom sub-agents.
+func subAgentTools(
+	agentName config.AgentName,
+	permissions permission.Service,
+	sessions session.Service,
+	messages message.Service,
+	history history.Service,
+	lspClients map[string]*lsp.Client,
+) []tools.BaseTool {
+	if agentName == config.AgentTask {
+		return TaskAgentTools(lspClients)
+	}
+	return slices.DeleteFunc(CoderAgentTools(permissions, sessions, messages, history, lspClients), func(tool tools.BaseTool) bool {
+		return tool.Info().Name == AgentToolName
+	})
+}
+
+// allowedTools keeps the tools the agent's configuration allows, all of them
+// when it doesn't list any. MCP tools are named <server>_<tool>.
+func allowedTools(agentName config.AgentName, agentTools []tools.BaseTool) []tools.BaseTool {
+	allowlist := config.Get().Agents[agentName].Tools
+	if len(allowlist) == 0 {
+		return agentTools
+	}
+	byName := make(map[string]tools.BaseTool, len(agentTools))
+	for _, tool := range agentTools {
+		byName[tool.Info().Name] = tool
+	}
+	allowed := make([]tools.BaseTool, 0, len(allowlist))
+	for _, name := range allowlist {
+		tool, ok := byName[name]
+		if !ok {
+			logging.Warn("Unknown tool in the agent's allowlist", "agent", agentName, "tool", name)
+			continue
+		}
+		allowed = append(allowed, tool)
+	}
+	return allowed
+}
@@ -0,0 +1,28 @@
+package models
+
+import "maps"
+
+const (
+	MockModel ModelID = "mock"
+
+	// MockScriptEnv names the script file the coder agent plays back on the
+	// mock model, the model is only available when it's set or replaying.
+	MockScriptEnv = "OPENCODE_MOCK_SCRIPT"
+)
+
+var MockModels = map[ModelID]Model{
+	MockModel: {
+		ID:                  MockModel,
+		Name:                "Mock",
+		Provider:            ProviderMock,
+		APIModel:            "mock",
+		ContextWindow:       200_000,
+		DefaultMaxTokens:    4096,
+		SupportsAttachments: true,
+	},
+}
+
+// EnableMockModel makes the mock model available.
+func EnableMockModel() {
+	maps.Copy(SupportedModels, MockModels)
+}
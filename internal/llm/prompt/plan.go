@@ -0,0 +1,23 @@
+package prompt
+
+import "fmt"
+
+// PlanModePrompt is added to the system prompt while a session is in plan
+// mode.
+const PlanModePrompt = `# Plan mode
+You are in plan mode: research the task and propose a plan, but do not carry it out yet. Only read-only tools are available, you cannot edit files or run commands.
+
+- Read the code, scenes and configuration the task touches before planning
+- Answer with the plan only: a short summary of the approach, then numbered steps naming the files to create or change and what changes in each
+- Mention open questions and risks after the steps
+- Do not ask whether to proceed, the user approves or edits the plan before it is executed`
+
+// ApprovedPlanPrompt is the message that starts executing a plan the user
+// approved.
+func ApprovedPlanPrompt(plan string) string {
+	return fmt.Sprintf(`The user approved the following plan, possibly after editing it. Execute it now, step by step, with all your tools. Follow the plan as written; if a step turns out to be wrong, explain why before deviating.
+
+<plan>
+%s
+</plan>`, plan)
+}
@@ -25,9 +25,15 @@ func GetAgentPrompt(agentName config.AgentName, provider models.ModelProvider) s
 		basePrompt = SummarizerPrompt(provider)
 	default:
 		basePrompt = "You are a helpful assistant"
+		if !config.IsBuiltinAgent(agentName) {
+			basePrompt = CoderPrompt(provider)
+		}
+	}
+	if agentPrompt, ok := readAgentPrompt(agentName); ok {
+		basePrompt = agentPrompt
 	}
 
-	if agentName == config.AgentCoder || agentName == config.AgentTask {
+	if agentName != config.AgentTitle && agentName != config.AgentSummarizer {
 		// Add context from project-specific instruction files if they exist
 		contextContent := getContextFromPaths()
 		logging.Debug("Context content", "Context", contextContent)
@@ -38,6 +44,20 @@ func GetAgentPrompt(agentName config.AgentName, provider models.ModelProvider) s
 	return basePrompt
 }
 
+// readAgentPrompt reads the system prompt file configured for the agent.
+func readAgentPrompt(agentName config.AgentName) (string, bool) {
+	path := config.Get().Agents[agentName].PromptPath()
+	if path == "" {
+		return "", false
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		logging.Warn("Failed to read the agent prompt, using the default", "agent", agentName, "path", path, "error", err)
+		return "", false
+	}
+	return string(content), true
+}
+
 var (
 	onceContext    sync.Once
 	contextContent string
@@ -87,7 +107,7 @@ func processContextPaths(workDir string, paths []string) string {
 
 							if result := processFile(path); result != "" {
 								resultCh <- result
-								logging.Info("Adding context from file", "file", path, "result", result[:600])
+								logging.Info("Adding context from file", "file", path, "result", result[:min(len(result), 600)])
 
 							}
 						} else {
@@ -109,7 +129,7 @@ func processContextPaths(workDir string, paths []string) string {
 					result := processFile(fullPath)
 					if result != "" {
 						resultCh <- result
-						logging.Info("Adding context from file", "file", fullPath, "result", result[:600])
+						logging.Info("Adding context from file", "file", fullPath, "result", result[:min(len(result), 600)])
 
 					}
 				} else {
@@ -0,0 +1,276 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/opencode-ai/opencode/internal/llm/models"
+	"github.com/opencode-ai/opencode/internal/llm/tools"
+	"github.com/opencode-ai/opencode/internal/logging"
+	"github.com/opencode-ai/opencode/internal/message"
+)
+
+const (
+	// CassetteVersion is the version of the cassette format written by the
+	// recorder.
+	CassetteVersion = 1
+	// CassetteFile is the name of the cassette in the debug directory of a
+	// session.
+	CassetteFile = "cassette.json"
+)
+
+// SubSessionCassetteFile is the name of the cassette of a sub-agent session,
+// kept in the debug directory of the session the user started.
+func SubSessionCassetteFile(sessionID string) string {
+	return "cassette-" + sessionID + ".json"
+}
+
+type cassetteSessionContextKey struct{}
+
+// WithCassetteSession records the generations under ctx in the debug
+// directory of the session, a session set by an outer generation is kept.
+// The agent of the user's session sets it, so that the cassettes of its
+// sub-agents land next to its own.
+func WithCassetteSession(ctx context.Context, sessionID string) context.Context {
+	if _, ok := ctx.Value(cassetteSessionContextKey{}).(string); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, cassetteSessionContextKey{}, sessionID)
+}
+
+// Cassette is a recorded session: the responses of the models in the order
+// the agent requested them, with the prompts that started them and the
+// results of their tool calls. Its turns are a mock script, so the mock
+// provider replays a cassette as it is.
+type Cassette struct {
+	Version   int        `json:"version"`
+	SessionID string     `json:"session_id"`
+	Turns     []MockTurn `json:"turns"`
+}
+
+// LoadCassette reads a cassette file, or the cassette of a session's debug
+// directory.
+func LoadCassette(path string) (*Cassette, error) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, CassetteFile)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+	var cassette Cassette
+	if err := json.Unmarshal(data, &cassette); err != nil {
+		return nil, fmt.Errorf("failed to parse cassette %s: %w", path, err)
+	}
+	if cassette.Version != CassetteVersion {
+		return nil, fmt.Errorf("unsupported cassette version %d in %s", cassette.Version, path)
+	}
+	return &cassette, nil
+}
+
+// Script returns a mock script that replays the cassette. Turns that failed
+// and were answered again by a fallback model are left out, since replaying
+// runs without fallbacks.
+func (c *Cassette) Script() *MockScript {
+	script := NewMockScript()
+	for i, turn := range c.Turns {
+		if turn.failed() && i+1 < len(c.Turns) && c.Turns[i+1].Retry {
+			continue
+		}
+		script.Turns = append(script.Turns, turn)
+	}
+	return script
+}
+
+// Prompts returns the user prompts of the session in order.
+func (c *Cassette) Prompts() []string {
+	var prompts []string
+	for _, turn := range c.Turns {
+		if turn.Prompt != "" {
+			prompts = append(prompts, turn.Prompt)
+		}
+	}
+	return prompts
+}
+
+// ToolResults returns the recorded tool results by tool call ID.
+func (c *Cassette) ToolResults() map[string]message.ToolResult {
+	results := make(map[string]message.ToolResult)
+	for _, turn := range c.Turns {
+		for _, result := range turn.ToolResults {
+			results[result.ToolCallID] = result
+		}
+	}
+	return results
+}
+
+// failed reports whether the turn ended with an error.
+func (t MockTurn) failed() bool {
+	return len(t.Events) > 0 && t.Events[len(t.Events)-1].Error != ""
+}
+
+// CassetteRecorder records the streamed responses of providers into the
+// cassette of each session, in the debug directory of the session. The
+// providers of an agent share a recorder so that a turn answered by a
+// fallback model lands in the same cassette.
+type CassetteRecorder struct {
+	mu        sync.Mutex
+	cassettes map[string]*Cassette
+	// requests is the length of the last request of each session, a request
+	// of the same length after a failed turn retries it
+	requests map[string]int
+}
+
+func NewCassetteRecorder() *CassetteRecorder {
+	return &CassetteRecorder{
+		cassettes: make(map[string]*Cassette),
+		requests:  make(map[string]int),
+	}
+}
+
+// Record wraps the provider so that its streamed responses are recorded while
+// debug logging of messages is enabled.
+func (c *CassetteRecorder) Record(p Provider) Provider {
+	return &recordingProvider{Provider: p, recorder: c}
+}
+
+type recordingProvider struct {
+	Provider
+	recorder *CassetteRecorder
+}
+
+func (r *recordingProvider) StreamResponse(ctx context.Context, messages []message.Message, baseTools []tools.BaseTool) <-chan ProviderEvent {
+	events := r.Provider.StreamResponse(ctx, messages, baseTools)
+	sessionID, _ := ctx.Value(tools.SessionIDContextKey).(string)
+	if logging.MessageDir == "" || sessionID == "" {
+		return events
+	}
+
+	file := cassetteFile{session: sessionID, name: CassetteFile}
+	if root, ok := ctx.Value(cassetteSessionContextKey{}).(string); ok && root != sessionID {
+		file = cassetteFile{session: root, name: SubSessionCassetteFile(sessionID)}
+	}
+	turn := r.recorder.startTurn(sessionID, file, r.Model().ID, messages)
+
+	recorded := make(chan ProviderEvent)
+	go func() {
+		defer close(recorded)
+		var text, thinking strings.Builder
+		// Consecutive deltas are stored as one event
+		flush := func() {
+			if thinking.Len() > 0 {
+				turn.Events = append(turn.Events, MockThinking(thinking.String()))
+				thinking.Reset()
+			}
+			if text.Len() > 0 {
+				turn.Events = append(turn.Events, MockText(text.String()))
+				text.Reset()
+			}
+		}
+		for event := range events {
+			switch event.Type {
+			case EventThinkingDelta:
+				if text.Len() > 0 {
+					flush()
+				}
+				thinking.WriteString(event.Thinking)
+			case EventContentDelta:
+				if thinking.Len() > 0 {
+					flush()
+				}
+				text.WriteString(event.Content)
+			case EventError:
+				flush()
+				turn.Events = append(turn.Events, MockError(event.Error.Error()))
+			case EventComplete:
+				flush()
+				for _, call := range event.Response.ToolCalls {
+					turn.Events = append(turn.Events, MockEvent{ToolCall: &MockToolCallEvent{ID: call.ID, Name: call.Name, Input: call.Input}})
+				}
+				usage := event.Response.Usage
+				turn.Events = append(turn.Events,
+					MockEvent{Usage: &MockUsageEvent{
+						InputTokens:         usage.InputTokens,
+						OutputTokens:        usage.OutputTokens,
+						CacheCreationTokens: usage.CacheCreationTokens,
+						CacheReadTokens:     usage.CacheReadTokens,
+					}},
+					MockFinish(event.Response.FinishReason),
+				)
+			}
+			recorded <- event
+		}
+		flush()
+		r.recorder.recordTurn(sessionID, file, turn)
+	}()
+	return recorded
+}
+
+// startTurn starts the turn answering the request. The results the request
+// carries back to the model are added to the turn that called the tools.
+func (r *CassetteRecorder) startTurn(sessionID string, file cassetteFile, model models.ModelID, messages []message.Message) MockTurn {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cassette := r.cassette(sessionID, file)
+	turn := MockTurn{Model: model}
+	if len(cassette.Turns) > 0 && cassette.Turns[len(cassette.Turns)-1].failed() && r.requests[sessionID] == len(messages) {
+		turn.Retry = true
+		return turn
+	}
+	r.requests[sessionID] = len(messages)
+	if len(messages) == 0 {
+		return turn
+	}
+
+	switch last := messages[len(messages)-1]; last.Role {
+	case message.User:
+		turn.Prompt = last.Content().String()
+	case message.Tool:
+		if len(cassette.Turns) > 0 {
+			previous := &cassette.Turns[len(cassette.Turns)-1]
+			previous.ToolResults = last.ToolResults()
+		}
+	}
+	return turn
+}
+
+func (r *CassetteRecorder) recordTurn(sessionID string, file cassetteFile, turn MockTurn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cassette := r.cassette(sessionID, file)
+	cassette.Turns = append(cassette.Turns, turn)
+
+	data, err := json.MarshalIndent(cassette, "", "  ")
+	if err != nil {
+		logging.Error("Failed to marshal cassette", "session_id", sessionID, "error", err)
+		return
+	}
+	logging.AppendToSessionLogFile(file.session, file.name, string(data))
+}
+
+// cassetteFile is where the cassette of a session is written: a file of the
+// debug directory of a session.
+type cassetteFile struct {
+	session string
+	name    string
+}
+
+// cassette returns the cassette of the session, continuing the one on disk
+// when the session was recorded by an earlier run. r.mu must be held.
+func (r *CassetteRecorder) cassette(sessionID string, file cassetteFile) *Cassette {
+	if cassette, ok := r.cassettes[sessionID]; ok {
+		return cassette
+	}
+	cassette := &Cassette{Version: CassetteVersion, SessionID: sessionID}
+	path := filepath.Join(logging.MessageDir, logging.GetSessionPrefix(file.session), file.name)
+	if recorded, err := LoadCassette(path); err == nil && recorded.SessionID == sessionID {
+		cassette = recorded
+	}
+	r.cassettes[sessionID] = cassette
+	return cassette
+}
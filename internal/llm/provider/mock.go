@@ -0,0 +1,395 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opencode-ai/opencode/internal/llm/models"
+	"github.com/opencode-ai/opencode/internal/llm/tools"
+	"github.com/opencode-ai/opencode/internal/message"
+)
+
+// MockScript is the scripted conversation the mock provider plays back. Every
+// request to the provider plays the next turn, so a script is deterministic as
+// long as the agent sends its requests in the same order.
+//
+// Scripts are written in Go with the builder methods:
+//
+//	script := provider.NewMockScript().
+//		Turn(provider.MockText("Let me look."), provider.MockToolCall("view", `{"file_path":"main.go"}`)).
+//		Turn(provider.MockText("Done."), provider.MockUsage(1200, 30))
+//
+// or loaded from a JSON file of the same shape:
+//
+//	{"turns": [{"events": [{"text": "Let me look."}, {"tool_call": {"name": "view", "input": "{}"}}]}]}
+type MockScript struct {
+	Turns []MockTurn `json:"turns"`
+
+	mu       sync.Mutex
+	next     int
+	requests []MockRequest
+}
+
+// MockTurn is one response of the provider. Turns of a recorded session also
+// keep what led to them and what came of them, replaying ignores these fields.
+type MockTurn struct {
+	Events []MockEvent `json:"events"`
+
+	Model       models.ModelID       `json:"model,omitempty"`        // The model that answered
+	Prompt      string               `json:"prompt,omitempty"`       // The user prompt that started the turn, if it did
+	ToolResults []message.ToolResult `json:"tool_results,omitempty"` // The results of the turn's tool calls
+	Retry       bool                 `json:"retry,omitempty"`        // The turn answered the request of the failed turn before it
+}
+
+// MockEvent is a single step of a turn, exactly one field is set. A turn ends
+// with tool_use when it has tool calls and end_turn otherwise, unless it sets
+// a finish reason or fails with an error.
+type MockEvent struct {
+	Text     string               `json:"text,omitempty"`
+	Thinking string               `json:"thinking,omitempty"`
+	ToolCall *MockToolCallEvent   `json:"tool_call,omitempty"`
+	Usage    *MockUsageEvent      `json:"usage,omitempty"`
+	Finish   message.FinishReason `json:"finish,omitempty"`
+	Error    string               `json:"error,omitempty"`
+	// Delay pauses the stream, in milliseconds
+	Delay int `json:"delay,omitempty"`
+}
+
+// MockToolCallEvent is a tool call requested by the mock model. The ID is
+// generated from the turn and position when it's empty.
+type MockToolCallEvent struct {
+	ID    string `json:"id,omitempty"`
+	Name  string `json:"name"`
+	Input string `json:"input"`
+}
+
+// MockUsageEvent sets the token usage reported for the turn.
+type MockUsageEvent struct {
+	InputTokens         int64 `json:"input_tokens"`
+	OutputTokens        int64 `json:"output_tokens"`
+	CacheCreationTokens int64 `json:"cache_creation_tokens,omitempty"`
+	CacheReadTokens     int64 `json:"cache_read_tokens,omitempty"`
+}
+
+// MockRequest is a request the mock provider received, for assertions.
+type MockRequest struct {
+	System   string
+	Messages []message.Message
+	Tools    []string
+}
+
+// NewMockScript returns an empty script.
+func NewMockScript() *MockScript {
+	return &MockScript{}
+}
+
+// LoadMockScript reads a script from a JSON file. The file may also be a
+// recorded cassette, which is replayed as its Script.
+func LoadMockScript(path string) (*MockScript, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mock script: %w", err)
+	}
+	var header struct {
+		Version int `json:"version"`
+	}
+	if json.Unmarshal(data, &header) == nil && header.Version != 0 {
+		cassette, err := LoadCassette(path)
+		if err != nil {
+			return nil, err
+		}
+		return cassette.Script(), nil
+	}
+	script := NewMockScript()
+	if err := json.Unmarshal(data, script); err != nil {
+		return nil, fmt.Errorf("failed to parse mock script %s: %w", path, err)
+	}
+	return script, nil
+}
+
+// Turn appends a turn to the script.
+func (s *MockScript) Turn(events ...MockEvent) *MockScript {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Turns = append(s.Turns, MockTurn{Events: events})
+	return s
+}
+
+// MockText streams text.
+func MockText(text string) MockEvent {
+	return MockEvent{Text: text}
+}
+
+// MockThinking streams reasoning.
+func MockThinking(thinking string) MockEvent {
+	return MockEvent{Thinking: thinking}
+}
+
+// MockToolCall requests a tool call, input is the JSON of its parameters.
+func MockToolCall(name, input string) MockEvent {
+	return MockEvent{ToolCall: &MockToolCallEvent{Name: name, Input: input}}
+}
+
+// MockUsage sets the token usage of the turn.
+func MockUsage(inputTokens, outputTokens int64) MockEvent {
+	return MockEvent{Usage: &MockUsageEvent{InputTokens: inputTokens, OutputTokens: outputTokens}}
+}
+
+// MockFinish overrides the finish reason of the turn.
+func MockFinish(reason message.FinishReason) MockEvent {
+	return MockEvent{Finish: reason}
+}
+
+// MockError fails the turn.
+func MockError(msg string) MockEvent {
+	return MockEvent{Error: msg}
+}
+
+// MockDelay pauses the stream.
+func MockDelay(d time.Duration) MockEvent {
+	return MockEvent{Delay: int(d / time.Millisecond)}
+}
+
+// Requests returns the requests received so far.
+func (s *MockScript) Requests() []MockRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]MockRequest(nil), s.requests...)
+}
+
+// Remaining returns the number of turns that have not been played.
+func (s *MockScript) Remaining() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.Turns) - s.next
+}
+
+// play records the request and returns the next turn with its index.
+func (s *MockScript) play(system string, messages []message.Message, baseTools []tools.BaseTool) (MockTurn, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	request := MockRequest{System: system, Messages: messages}
+	for _, tool := range baseTools {
+		request.Tools = append(request.Tools, tool.Info().Name)
+	}
+	s.requests = append(s.requests, request)
+
+	if s.next >= len(s.Turns) {
+		return MockTurn{}, 0, fmt.Errorf("mock script exhausted after %d turns", len(s.Turns))
+	}
+	turn := s.Turns[s.next]
+	s.next++
+	return turn, s.next, nil
+}
+
+type mockOptions struct {
+	script *MockScript
+	// subSessionDir holds the cassettes of sub-agent sessions to replay
+	subSessionDir string
+}
+
+type MockOption func(*mockOptions)
+
+// WithMockScript plays the script, it may be shared between providers.
+// Without a script, the provider answers every request with a fixed text.
+func WithMockScript(script *MockScript) MockOption {
+	return func(options *mockOptions) {
+		options.script = script
+	}
+}
+
+// WithMockSubSessions replays the cassettes of sub-agent sessions recorded in
+// dir, picked by the session of each request. Requests of sessions without a
+// cassette get the fixed answer.
+func WithMockSubSessions(dir string) MockOption {
+	return func(options *mockOptions) {
+		options.subSessionDir = dir
+	}
+}
+
+// subSessionScripts are the scripts of the replayed sub-agent cassettes by
+// path. A continued sub-agent session runs in a new agent, it picks up the
+// script where the previous one stopped.
+var subSessionScripts sync.Map
+
+// subSessionScript returns the script replaying the cassette of the request's
+// session in dir, or nil when the session wasn't recorded there.
+func subSessionScript(ctx context.Context, dir string) *MockScript {
+	sessionID, _ := ctx.Value(tools.SessionIDContextKey).(string)
+	if sessionID == "" {
+		return nil
+	}
+	path := filepath.Join(dir, SubSessionCassetteFile(sessionID))
+	if script, ok := subSessionScripts.Load(path); ok {
+		return script.(*MockScript)
+	}
+	cassette, err := LoadCassette(path)
+	if err != nil {
+		return nil
+	}
+	script, _ := subSessionScripts.LoadOrStore(path, cassette.Script())
+	return script.(*MockScript)
+}
+
+type mockClient struct {
+	providerOptions providerClientOptions
+	options         mockOptions
+}
+
+type MockClient ProviderClient
+
+func newMockClient(opts providerClientOptions) (MockClient, error) {
+	mockOpts := mockOptions{}
+	for _, o := range opts.mockOptions {
+		o(&mockOpts)
+	}
+	return &mockClient{
+		providerOptions: opts,
+		options:         mockOpts,
+	}, nil
+}
+
+// mockDefaultResponse answers every request of a mock provider without a
+// script, such as the title and task agents of a scripted coder.
+const mockDefaultResponse = "Mock response"
+
+func (m *mockClient) send(ctx context.Context, messages []message.Message, tools []tools.BaseTool) (*ProviderResponse, error) {
+	var response *ProviderResponse
+	for event := range m.stream(ctx, messages, tools) {
+		switch event.Type {
+		case EventError:
+			return nil, event.Error
+		case EventComplete:
+			response = event.Response
+		}
+	}
+	if response == nil {
+		return nil, errors.New("mock stream ended without a response")
+	}
+	return response, nil
+}
+
+func (m *mockClient) stream(ctx context.Context, messages []message.Message, tools []tools.BaseTool) <-chan ProviderEvent {
+	eventChan := make(chan ProviderEvent)
+
+	go func() {
+		defer close(eventChan)
+
+		send := func(event ProviderEvent) bool {
+			select {
+			case eventChan <- event:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		turn := MockTurn{Events: []MockEvent{MockText(mockDefaultResponse)}}
+		turnIndex := 0
+		script := m.options.script
+		if script == nil && m.options.subSessionDir != "" {
+			script = subSessionScript(ctx, m.options.subSessionDir)
+		}
+		if script != nil {
+			var err error
+			turn, turnIndex, err = script.play(m.providerOptions.systemMessageFor(ctx), messages, tools)
+			if err != nil {
+				send(ProviderEvent{Type: EventError, Error: err})
+				return
+			}
+		}
+		fail := func(err error) {
+			send(ProviderEvent{Type: EventError, Error: err})
+		}
+
+		var (
+			content   strings.Builder
+			toolCalls []message.ToolCall
+			usage     TokenUsage
+			finish    message.FinishReason
+		)
+		for i, event := range turn.Events {
+			if ctx.Err() != nil {
+				fail(ctx.Err())
+				return
+			}
+			ok := true
+			switch {
+			case event.Delay > 0:
+				select {
+				case <-time.After(time.Duration(event.Delay) * time.Millisecond):
+				case <-ctx.Done():
+					fail(ctx.Err())
+					return
+				}
+			case event.Text != "":
+				content.WriteString(event.Text)
+				ok = send(ProviderEvent{Type: EventContentDelta, Content: event.Text})
+			case event.Thinking != "":
+				ok = send(ProviderEvent{Type: EventThinkingDelta, Thinking: event.Thinking})
+			case event.ToolCall != nil:
+				call := message.ToolCall{
+					ID:    event.ToolCall.ID,
+					Name:  event.ToolCall.Name,
+					Input: event.ToolCall.Input,
+					Type:  "function",
+				}
+				if call.ID == "" {
+					call.ID = fmt.Sprintf("mock_%d_%d", turnIndex, i)
+				}
+				ok = send(ProviderEvent{Type: EventToolUseStart, ToolCall: &message.ToolCall{ID: call.ID, Name: call.Name, Type: call.Type}}) &&
+					send(ProviderEvent{Type: EventToolUseStop, ToolCall: &call})
+				call.Finished = true
+				toolCalls = append(toolCalls, call)
+			case event.Usage != nil:
+				usage = TokenUsage{
+					InputTokens:         event.Usage.InputTokens,
+					OutputTokens:        event.Usage.OutputTokens,
+					CacheCreationTokens: event.Usage.CacheCreationTokens,
+					CacheReadTokens:     event.Usage.CacheReadTokens,
+				}
+			case event.Finish != "":
+				finish = event.Finish
+			case event.Error != "":
+				fail(errors.New(event.Error))
+				return
+			}
+			if !ok {
+				fail(ctx.Err())
+				return
+			}
+		}
+
+		if finish == "" {
+			finish = message.FinishReasonEndTurn
+			if len(toolCalls) > 0 {
+				finish = message.FinishReasonToolUse
+			}
+		}
+		send(ProviderEvent{
+			Type: EventComplete,
+			Response: &ProviderResponse{
+				Content:      content.String(),
+				ToolCalls:    toolCalls,
+				Usage:        usage,
+				FinishReason: finish,
+			},
+		})
+	}()
+
+	return eventChan
+}
+
+// WithMockOptions configures the mock provider.
+func WithMockOptions(mockOptions ...MockOption) ProviderClientOption {
+	return func(options *providerClientOptions) {
+		options.mockOptions = mockOptions
+	}
+}
@@ -65,10 +65,10 @@ func newOpenAIClient(opts providerClientOptions) OpenAIClient {
 	}
 }
 
-func (o *openaiClient) convertMessages(messages []message.Message) (openaiMessages []openai.ChatCompletionMessageParamUnion) {
+func (o *openaiClient) convertMessages(ctx context.Context, messages []message.Message) (openaiMessages []openai.ChatCompletionMessageParamUnion) {
 	// Add system message first
 	// logging.Info("System message", "content", o.providerOptions.systemMessage)
-	openaiMessages = append(openaiMessages, openai.SystemMessage(o.providerOptions.systemMessage))
+	openaiMessages = append(openaiMessages, openai.SystemMessage(o.providerOptions.systemMessageFor(ctx)))
 
 	for _, msg := range messages {
 		switch msg.Role {
@@ -187,7 +187,7 @@ func (o *openaiClient) preparedParams(messages []openai.ChatCompletionMessagePar
 }
 
 func (o *openaiClient) send(ctx context.Context, messages []message.Message, tools []tools.BaseTool) (response *ProviderResponse, err error) {
-	params := o.preparedParams(o.convertMessages(messages), o.convertTools(tools))
+	params := o.preparedParams(o.convertMessages(ctx, messages), o.convertTools(tools))
 	cfg := config.Get()
 	if cfg.Debug {
 		jsonData, _ := json.Marshal(params)
@@ -196,7 +196,7 @@ func (o *openaiClient) send(ctx context.Context, messages []message.Message, too
 	attempts := 0
 	for {
 		attempts++
-		logging.Info("Making OpenAI API call", "model", o.providerOptions.model.APIModel, "system_prompt", o.providerOptions.systemMessage[0:2000]+"....", "attempt", attempts, "system_prompt_length", len(o.providerOptions.systemMessage))
+		logging.Info("Making OpenAI API call", "model", o.providerOptions.model.APIModel, "system_prompt", truncateForLog(o.providerOptions.systemMessageFor(ctx), 2000), "attempt", attempts, "system_prompt_length", len(o.providerOptions.systemMessageFor(ctx)))
 		for _, msg := range messages {
 			logging.Info("Processing message", "role", msg.Role, "content_length", len(msg.Content().Text), "tool_calls_count", len(msg.ToolCalls()), "tool_results_count", len(msg.ToolResults()))
 		}
@@ -250,7 +250,7 @@ func (o *openaiClient) send(ctx context.Context, messages []message.Message, too
 }
 
 func (o *openaiClient) stream(ctx context.Context, messages []message.Message, tools []tools.BaseTool) <-chan ProviderEvent {
-	params := o.preparedParams(o.convertMessages(messages), o.convertTools(tools))
+	params := o.preparedParams(o.convertMessages(ctx, messages), o.convertTools(tools))
 	params.StreamOptions = openai.ChatCompletionStreamOptionsParam{
 		IncludeUsage: openai.Bool(true),
 	}
@@ -267,7 +267,7 @@ func (o *openaiClient) stream(ctx context.Context, messages []message.Message, t
 	go func() {
 		for {
 			attempts++
-			logging.Info("Making OpenAI streaming API call", "model", o.providerOptions.model.APIModel, "attempt", attempts, "system_prompt", o.providerOptions.systemMessage[0:2000]+"....", "system_prompt_length", len(o.providerOptions.systemMessage))
+			logging.Info("Making OpenAI streaming API call", "model", o.providerOptions.model.APIModel, "attempt", attempts, "system_prompt", truncateForLog(o.providerOptions.systemMessageFor(ctx), 2000), "system_prompt_length", len(o.providerOptions.systemMessageFor(ctx)))
 			for _, msg := range messages {
 				logging.Info("Processing streaming message", "role", msg.Role, "content_length", len(msg.Content().Text), "tool_calls_count", len(msg.ToolCalls()), "tool_results_count", len(msg.ToolResults()))
 			}
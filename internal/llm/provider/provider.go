@@ -69,6 +69,7 @@ type providerClientOptions struct {
 	geminiOptions    []GeminiOption
 	bedrockOptions   []BedrockOption
 	copilotOptions   []CopilotOption
+	mockOptions      []MockOption
 }
 
 type ProviderClientOption func(*providerClientOptions)
@@ -161,8 +162,14 @@ func NewProvider(providerName models.ModelProvider, opts ...ProviderClientOption
 			client:  newOpenAIClient(clientOptions),
 		}, nil
 	case models.ProviderMock:
-		// TODO: implement mock client for test
-		panic("not implemented")
+		client, err := newMockClient(clientOptions)
+		if err != nil {
+			return nil, err
+		}
+		return &baseProvider[MockClient]{
+			options: clientOptions,
+			client:  client,
+		}, nil
 	}
 	return nil, fmt.Errorf("provider not supported: %s", providerName)
 }
@@ -216,6 +223,40 @@ func WithSystemMessage(systemMessage string) ProviderClientOption {
 	}
 }
 
+type systemContextKey struct{}
+
+// WithSystemContext returns a context that makes providers append text to
+// their system message, for instructions that only apply to one request. Text
+// added earlier to ctx is kept.
+func WithSystemContext(ctx context.Context, text string) context.Context {
+	if extra, ok := ctx.Value(systemContextKey{}).(string); ok && extra != "" {
+		text = extra + "\n\n" + text
+	}
+	return context.WithValue(ctx, systemContextKey{}, text)
+}
+
+// WithoutSystemContext returns a context that drops the text added to ctx by
+// WithSystemContext, for requests made on behalf of another agent.
+func WithoutSystemContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, systemContextKey{}, "")
+}
+
+// systemMessageFor returns the system message to use for a request made with
+// ctx.
+func (o providerClientOptions) systemMessageFor(ctx context.Context) string {
+	if extra, ok := ctx.Value(systemContextKey{}).(string); ok && extra != "" {
+		return o.systemMessage + "\n\n" + extra
+	}
+	return o.systemMessage
+}
+
+func truncateForLog(s string, maxLen int) string {
+	if len(s) <= maxLen {
+		return s
+	}
+	return s[:maxLen] + "...."
+}
+
 func WithAnthropicOptions(anthropicOptions ...AnthropicOption) ProviderClientOption {
 	return func(options *providerClientOptions) {
 		options.anthropicOptions = anthropicOptions
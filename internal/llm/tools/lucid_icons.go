@@ -4,54 +4,149 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
 
+	"github.com/opencode-ai/opencode/internal/config"
+	"github.com/opencode-ai/opencode/internal/history"
 	"github.com/opencode-ai/opencode/internal/logging"
+	"github.com/opencode-ai/opencode/internal/permission"
 )
 
-type LucidIconsTool struct{}
+type LucidIconsTool struct {
+	permissions permission.Service
+	files       history.Service
+}
 
 type LucidIconsParams struct {
 	Assets []string `json:"assets"`
 }
 
+type LucidIconsPermissionsParams struct {
+	FilePaths []string `json:"file_paths"`
+}
+
 type LucidIconsResponseMetadata struct {
-	FilesPaths []string `json:"filepaths"`
+	FilesPaths []string          `json:"filepaths"`
+	Icons      map[string]string `json:"icons"`
+	Unresolved []string          `json:"unresolved"`
 }
 
 const (
-	LucidIconsToolName = "lucid_icons"
-	lucidIconsDescription = `Icon asset fetching tool that downloads Lucid icons as SVG files based on asset names.
+	LucidIconsToolName    = "lucid_icons"
+	lucidIconsDescription = `Icon asset tool that copies Lucide icons as SVG files into the project based on asset names.
 
 WHEN TO USE THIS TOOL:
-- Use when you need to download icon assets for your frontend application
-- Perfect for getting consistent, high-quality SVG icons from the Lucid icon library
-- Use when building UI components that need visual icons
+- Use when a scene needs icons or simple pictograms (people, buildings, animals, devices, ...)
+- Perfect for getting consistent, high-quality SVG icons from the Lucide icon library
+- Use before writing a scene that references the icons with an Img node
 
 HOW TO USE:
 - Provide a list of asset names (e.g., "hospital", "person", "dog")
-- The tool will fetch corresponding Lucid icons as SVG files
-- Icons are saved to the frontend/public directory
-- Returns relative file paths to the downloaded icons
+- Each name is matched against the Lucide icon set, including common synonyms and the icon tags
+- Matched icons are written as <icon-name>.svg to the project's public icons directory
+- The user is asked for permission before the icons are written
+- Returns one file path per resolved asset and the list of names that could not be resolved
 
 FEATURES:
-- Downloads SVG icons from Lucid icon library
-- Saves icons to frontend/public directory for web usage
-- Returns relative file paths for easy integration
+- Works offline from the local Lucide icon cache
+- Fuzzy matching: plurals, synonyms, tags and small typos are resolved to the closest icon
 - Handles multiple assets in a single request
 
 LIMITATIONS:
-- Currently returns hardcoded paths (implementation in progress)
-- Requires internet connection for fetching icons
-- Limited to Lucid icon library assets
+- Limited to the icons available in the local cache
+- Icons are monochrome line icons, colors have to be set in the scene
 
 TIPS:
-- Use descriptive asset names like "home", "user", "settings"
-- Icons are saved as SVG format for scalability
-- Returned paths are relative to project root for easy imports`
+- Use short, concrete names like "home", "user", "settings"
+- Check the unresolved list and retry with a simpler or more common word
+- Files in the public directory are served from the root, e.g. frontend/public/icons/dog.svg is loaded as /icons/dog.svg`
 )
 
-func NewLucidIconsTool() BaseTool {
-	return &LucidIconsTool{}
+// lucideStaticIcons is where the lucide-static npm package keeps its SVGs. It
+// is used when no cache directory is configured or the cache is empty.
+var lucideStaticIcons = filepath.Join("frontend", "node_modules", "lucide-static", "icons")
+
+// iconSynonyms maps common asset names to Lucide icon names that do not share
+// their wording.
+var iconSynonyms = map[string]string{
+	"person":     "user",
+	"human":      "user",
+	"man":        "user",
+	"woman":      "user",
+	"people":     "users",
+	"team":       "users",
+	"group":      "users",
+	"doctor":     "stethoscope",
+	"medicine":   "pill",
+	"money":      "banknote",
+	"cash":       "banknote",
+	"email":      "mail",
+	"letter":     "mail",
+	"phone":      "smartphone",
+	"computer":   "monitor",
+	"time":       "clock",
+	"gear":       "settings",
+	"trash":      "trash-2",
+	"delete":     "trash-2",
+	"warning":    "triangle-alert",
+	"error":      "circle-x",
+	"success":    "circle-check",
+	"love":       "heart",
+	"like":       "thumbs-up",
+	"location":   "map-pin",
+	"place":      "map-pin",
+	"world":      "globe",
+	"internet":   "globe",
+	"idea":       "lightbulb",
+	"weather":    "cloud-sun",
+	"rain":       "cloud-rain",
+	"snow":       "snowflake",
+	"fire":       "flame",
+	"electric":   "zap",
+	"lightning":  "zap",
+	"energy":     "zap",
+	"document":   "file-text",
+	"photo":      "image",
+	"picture":    "image",
+	"chat":       "message-circle",
+	"message":    "message-square",
+	"security":   "shield",
+	"key":        "key-round",
+	"chart":      "chart-bar",
+	"graph":      "chart-line",
+	"statistics": "chart-column",
+	"education":  "graduation-cap",
+	"student":    "graduation-cap",
+	"food":       "utensils",
+	"restaurant": "utensils",
+	"shop":       "store",
+	"shopping":   "shopping-cart",
+	"cart":       "shopping-cart",
+	"vehicle":    "car",
+	"airplane":   "plane",
+	"flight":     "plane",
+	"boat":       "sailboat",
+	"robot":      "bot",
+	"ai":         "bot",
+}
+
+// iconIndex is the set of Lucide icons available on disk.
+type iconIndex struct {
+	dir   string
+	names []string            // sorted icon names
+	tags  map[string][]string // icon name -> tags, from tags.json if present
+}
+
+func NewLucidIconsTool(permissions permission.Service, files history.Service) BaseTool {
+	return &LucidIconsTool{
+		permissions: permissions,
+		files:       files,
+	}
 }
 
 func (l *LucidIconsTool) Info() ToolInfo {
@@ -61,7 +156,7 @@ func (l *LucidIconsTool) Info() ToolInfo {
 		Parameters: map[string]any{
 			"assets": map[string]any{
 				"type":        "array",
-				"description": "List of asset names to download (e.g., 'hospital', 'person', 'dog')",
+				"description": "List of asset names to resolve to icons (e.g., 'hospital', 'person', 'dog')",
 				"items": map[string]any{
 					"type": "string",
 				},
@@ -82,20 +177,294 @@ func (l *LucidIconsTool) Run(ctx context.Context, call ToolCall) (ToolResponse,
 		return NewTextErrorResponse("assets list is required"), nil
 	}
 
-	logging.Info("Received LucidIconsTool call with assets", "assets", params.Assets)
-	
-	// TODO: Implement actual icon fetching logic
-	// For now, return hardcoded paths as requested
-	filepaths := []string{
-		"frontend/public/logo.svg",
-		"frontend/public/grid.png",
-		"frontend/public/placeholder.png",
-	}
-	
-	return WithResponseMetadata(
-		NewTextResponse(fmt.Sprintf("Downloaded %d icons to frontend/public directory", len(params.Assets))),
-		LucidIconsResponseMetadata{
-			FilesPaths: filepaths,
+	cfg := config.Get()
+	index, err := loadIconIndex(iconCacheDirs(cfg)...)
+	if err != nil {
+		return NewTextErrorResponse(err.Error()), nil
+	}
+
+	publicDir := cfg.Icons.PublicDir
+	if !filepath.IsAbs(publicDir) {
+		publicDir = filepath.Join(config.WorkingDirectory(), publicDir)
+	}
+
+	metadata := LucidIconsResponseMetadata{
+		FilesPaths: []string{},
+		Icons:      map[string]string{},
+		Unresolved: []string{},
+	}
+	var output strings.Builder
+	// The icons to write by target path, icons already in the public
+	// directory are left alone
+	writes := map[string]string{}
+	for _, asset := range params.Assets {
+		icon, ok := index.resolve(asset)
+		if !ok {
+			metadata.Unresolved = append(metadata.Unresolved, asset)
+			continue
+		}
+
+		content, err := os.ReadFile(filepath.Join(index.dir, icon+".svg"))
+		if err != nil {
+			return ToolResponse{}, fmt.Errorf("error reading icon %s: %w", icon, err)
+		}
+		target := filepath.Join(publicDir, icon+".svg")
+		if existing, err := os.ReadFile(target); err != nil || string(existing) != string(content) {
+			writes[target] = string(content)
+		}
+
+		relPath, err := filepath.Rel(config.WorkingDirectory(), target)
+		if err != nil {
+			relPath = target
+		}
+		metadata.FilesPaths = append(metadata.FilesPaths, relPath)
+		metadata.Icons[asset] = icon
+		fmt.Fprintf(&output, "%s -> %s (%s)\n", asset, icon, relPath)
+	}
+
+	if len(writes) > 0 {
+		if err := l.writeIcons(ctx, publicDir, writes); err != nil {
+			return ToolResponse{}, err
+		}
+	}
+
+	logging.Info("Resolved lucide icons", "icons", metadata.Icons, "unresolved", metadata.Unresolved)
+	if len(metadata.Unresolved) > 0 {
+		fmt.Fprintf(&output, "Could not resolve: %s\n", strings.Join(metadata.Unresolved, ", "))
+	}
+	if len(metadata.FilesPaths) == 0 {
+		return WithResponseMetadata(NewTextErrorResponse(output.String()), metadata), nil
+	}
+	return WithResponseMetadata(NewTextResponse(output.String()), metadata), nil
+}
+
+// writeIcons writes the icons once the user allowed it and records them in
+// the file history of the session, like the write tool does.
+func (l *LucidIconsTool) writeIcons(ctx context.Context, publicDir string, writes map[string]string) error {
+	sessionID, messageID := GetContextValues(ctx)
+	if sessionID == "" || messageID == "" {
+		return fmt.Errorf("session_id and message_id are required")
+	}
+
+	targets := slices.Sorted(maps.Keys(writes))
+	rootDir := config.WorkingDirectory()
+	permissionPath := publicDir
+	if rel, err := filepath.Rel(rootDir, publicDir); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		permissionPath = rootDir
+	}
+	p := l.permissions.Request(
+		ctx,
+		permission.CreatePermissionRequest{
+			SessionID:   sessionID,
+			Path:        permissionPath,
+			ToolName:    LucidIconsToolName,
+			Action:      "write",
+			Description: fmt.Sprintf("Copy icons to %s:\n\n- %s", publicDir, strings.Join(targets, "\n- ")),
+			Params: LucidIconsPermissionsParams{
+				FilePaths: targets,
+			},
 		},
-	), nil
+	)
+	if !p {
+		return permission.ErrorPermissionDenied
+	}
+
+	if err := os.MkdirAll(publicDir, 0o755); err != nil {
+		return fmt.Errorf("error creating icons directory: %w", err)
+	}
+	for _, target := range targets {
+		oldContent := ""
+		if oldBytes, err := os.ReadFile(target); err == nil {
+			oldContent = string(oldBytes)
+		}
+		if err := os.WriteFile(target, []byte(writes[target]), 0o644); err != nil {
+			return fmt.Errorf("error writing icon %s: %w", target, err)
+		}
+
+		file, err := l.files.GetByPathAndSession(ctx, target, sessionID)
+		if err != nil {
+			if _, err = l.files.Create(ctx, sessionID, target, oldContent); err != nil {
+				return fmt.Errorf("error creating file history: %w", err)
+			}
+		} else if file.Content != oldContent {
+			// The icon was changed outside of the session, keep that version
+			if _, err = l.files.CreateVersion(ctx, sessionID, target, oldContent); err != nil {
+				logging.Debug("Error creating file history version", "error", err)
+			}
+		}
+		if _, err = l.files.CreateVersion(ctx, sessionID, target, writes[target]); err != nil {
+			logging.Debug("Error creating file history version", "error", err)
+		}
+		recordFileWrite(target)
+	}
+	return nil
+}
+
+// iconCacheDirs returns the directories searched for Lucide icons, in order.
+func iconCacheDirs(cfg *config.Config) []string {
+	cacheDir := cfg.Icons.CacheDir
+	if cacheDir == "" {
+		cacheDir = filepath.Join(cfg.Data.Directory, "icons", "lucide")
+	}
+	dirs := []string{cacheDir, lucideStaticIcons}
+	for i, dir := range dirs {
+		if !filepath.IsAbs(dir) {
+			dirs[i] = filepath.Join(config.WorkingDirectory(), dir)
+		}
+	}
+	return dirs
+}
+
+// loadIconIndex indexes the first directory that contains SVG files.
+func loadIconIndex(dirs ...string) (*iconIndex, error) {
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		index := &iconIndex{dir: dir, tags: map[string][]string{}}
+		for _, entry := range entries {
+			if entry.IsDir() || filepath.Ext(entry.Name()) != ".svg" {
+				continue
+			}
+			index.names = append(index.names, strings.TrimSuffix(entry.Name(), ".svg"))
+		}
+		if len(index.names) == 0 {
+			continue
+		}
+		sort.Strings(index.names)
+
+		// lucide-static ships tags.json next to the icons directory
+		for _, tagsPath := range []string{filepath.Join(dir, "tags.json"), filepath.Join(filepath.Dir(dir), "tags.json")} {
+			data, err := os.ReadFile(tagsPath)
+			if err != nil {
+				continue
+			}
+			if err := json.Unmarshal(data, &index.tags); err != nil {
+				logging.Warn("Failed to parse lucide tags", "path", tagsPath, "error", err)
+			}
+			break
+		}
+		return index, nil
+	}
+	return nil, fmt.Errorf("no lucide icons found in %s, install the frontend dependencies or copy the SVGs of the lucide-static package there", strings.Join(dirs, " or "))
+}
+
+// resolve finds the icon that best matches an asset name: exact names first,
+// then synonyms, tags, name segments and finally close spellings.
+func (idx *iconIndex) resolve(asset string) (string, bool) {
+	name := normalizeIconName(asset)
+	if name == "" {
+		return "", false
+	}
+
+	candidates := []string{name}
+	if singular := strings.TrimSuffix(name, "s"); singular != name {
+		candidates = append(candidates, singular)
+		if strings.HasSuffix(name, "ies") {
+			candidates = append(candidates, strings.TrimSuffix(name, "ies")+"y")
+		} else if strings.HasSuffix(name, "es") {
+			candidates = append(candidates, strings.TrimSuffix(name, "es"))
+		}
+	}
+
+	for _, candidate := range candidates {
+		if idx.has(candidate) {
+			return candidate, true
+		}
+		if synonym, ok := iconSynonyms[candidate]; ok && idx.has(synonym) {
+			return synonym, true
+		}
+	}
+
+	for _, candidate := range candidates {
+		if icon, ok := idx.byTag(candidate); ok {
+			return icon, true
+		}
+	}
+
+	for _, candidate := range candidates {
+		if icon, ok := idx.bySegment(candidate); ok {
+			return icon, true
+		}
+	}
+
+	return idx.closest(name)
+}
+
+func (idx *iconIndex) has(name string) bool {
+	_, found := slices.BinarySearch(idx.names, name)
+	return found
+}
+
+// byTag returns the shortest icon name tagged with the asset name.
+func (idx *iconIndex) byTag(name string) (string, bool) {
+	tag := strings.ReplaceAll(name, "-", " ")
+	best := ""
+	for _, icon := range idx.names {
+		if !slices.Contains(idx.tags[icon], tag) {
+			continue
+		}
+		if best == "" || len(icon) < len(best) {
+			best = icon
+		}
+	}
+	return best, best != ""
+}
+
+// bySegment returns the shortest icon name containing the asset name as a
+// whole hyphen separated segment, e.g. "hospital" matches "hospital-cross".
+func (idx *iconIndex) bySegment(name string) (string, bool) {
+	best := ""
+	for _, icon := range idx.names {
+		if !slices.Contains(strings.Split(icon, "-"), name) && !strings.HasPrefix(icon, name+"-") {
+			continue
+		}
+		if best == "" || len(icon) < len(best) {
+			best = icon
+		}
+	}
+	return best, best != ""
+}
+
+// closest returns the icon name with the smallest edit distance, allowing
+// roughly one typo per four characters.
+func (idx *iconIndex) closest(name string) (string, bool) {
+	maxDistance := max(1, len(name)/4)
+	best, bestDistance := "", maxDistance+1
+	for _, icon := range idx.names {
+		if d := levenshtein(name, icon); d < bestDistance {
+			best, bestDistance = icon, d
+		}
+	}
+	return best, best != ""
+}
+
+// normalizeIconName lowercases a name and joins its words with hyphens, the
+// way Lucide names its icons.
+func normalizeIconName(name string) string {
+	fields := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !('a' <= r && r <= 'z' || '0' <= r && r <= '9')
+	})
+	return strings.Join(fields, "-")
+}
+
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
 }
@@ -0,0 +1,125 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencode-ai/opencode/internal/config"
+	"github.com/opencode-ai/opencode/internal/db"
+	"github.com/opencode-ai/opencode/internal/history"
+	"github.com/opencode-ai/opencode/internal/permission"
+	"github.com/opencode-ai/opencode/internal/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIconIndex_Resolve(t *testing.T) {
+	emptyDir := t.TempDir()
+	iconsDir := filepath.Join(t.TempDir(), "icons")
+	require.NoError(t, os.MkdirAll(iconsDir, 0o755))
+	for _, name := range []string{"user", "users", "dog", "hospital", "heart-pulse", "stethoscope", "battery-charging"} {
+		require.NoError(t, os.WriteFile(filepath.Join(iconsDir, name+".svg"), []byte("<svg/>"), 0o644))
+	}
+	tags := `{"heart-pulse": ["heartbeat", "health"], "battery-charging": ["power", "charge"]}`
+	require.NoError(t, os.WriteFile(filepath.Join(filepath.Dir(iconsDir), "tags.json"), []byte(tags), 0o644))
+
+	index, err := loadIconIndex(emptyDir, iconsDir)
+	require.NoError(t, err)
+	assert.Equal(t, iconsDir, index.dir)
+
+	tests := []struct {
+		asset string
+		want  string
+	}{
+		{"dog", "dog"},
+		{"Dogs", "dog"},
+		{"person", "user"},
+		{"People", "users"},
+		{"doctor", "stethoscope"},
+		{"heartbeat", "heart-pulse"},
+		{"battery", "battery-charging"},
+		{"hospitl", "hospital"},
+		{"spaceship", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.asset, func(t *testing.T) {
+			got, ok := index.resolve(tt.asset)
+			assert.Equal(t, tt.want != "", ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestLoadIconIndex_Empty(t *testing.T) {
+	_, err := loadIconIndex(t.TempDir())
+	assert.Error(t, err)
+}
+
+func TestLucidIconsTool_AsksBeforeWriting(t *testing.T) {
+	workDir := t.TempDir()
+	_, err := config.Load(workDir, false)
+	require.NoError(t, err)
+	// The config is loaded once per process, point it at this test's dirs
+	cfg := config.Get()
+	cfg.WorkingDir = workDir
+	cfg.Data.Directory = t.TempDir()
+	cfg.Icons.CacheDir = t.TempDir()
+	cfg.Icons.PublicDir = filepath.Join("frontend", "public", "icons")
+	require.NoError(t, os.WriteFile(filepath.Join(cfg.Icons.CacheDir, "dog.svg"), []byte("<svg/>"), 0o644))
+
+	conn, err := db.Connect()
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	q := db.New(conn)
+	sess, err := session.NewService(q).Create(context.Background(), "test")
+	require.NoError(t, err)
+	files := history.NewService(q, conn)
+	permissions := permission.NewPermissionService()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = context.WithValue(ctx, SessionIDContextKey, sess.ID)
+	ctx = context.WithValue(ctx, MessageIDContextKey, "message-1")
+	grant := make(chan bool, 1)
+	paths := make(chan string, 1)
+	requests := permissions.Subscribe(ctx)
+	go func() {
+		for event := range requests {
+			paths <- event.Payload.Path
+			if <-grant {
+				permissions.Grant(event.Payload)
+			} else {
+				permissions.Deny(event.Payload)
+			}
+		}
+	}()
+
+	tool := NewLucidIconsTool(permissions, files)
+	call := ToolCall{ID: "call-1", Name: LucidIconsToolName, Input: `{"assets":["dogs"]}`}
+	target := filepath.Join(workDir, cfg.Icons.PublicDir, "dog.svg")
+
+	grant <- false
+	_, err = tool.Run(ctx, call)
+	assert.ErrorIs(t, err, permission.ErrorPermissionDenied)
+	assert.NoFileExists(t, target)
+	projectPath := <-paths
+
+	grant <- true
+	resp, err := tool.Run(ctx, call)
+	require.NoError(t, err)
+	assert.False(t, resp.IsError)
+	assert.FileExists(t, target)
+	<-paths
+	versions, err := files.ListBySession(ctx, sess.ID)
+	require.NoError(t, err)
+	assert.Len(t, versions, 2, "the missing file and the icon are kept in the history")
+
+	// A sibling directory sharing the project's name is outside of it
+	cfg.Icons.PublicDir = filepath.Join(workDir+"-site", "public")
+	grant <- false
+	_, err = tool.Run(ctx, call)
+	assert.ErrorIs(t, err, permission.ErrorPermissionDenied)
+	assert.NotEqual(t, projectPath, <-paths)
+}
@@ -0,0 +1,451 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/opencode-ai/opencode/internal/config"
+	"github.com/opencode-ai/opencode/internal/logging"
+	"github.com/opencode-ai/opencode/internal/lsp"
+	"github.com/opencode-ai/opencode/internal/lsp/protocol"
+)
+
+type SceneCheckParams struct {
+	FilePath string `json:"file_path"`
+}
+
+// SceneDiagnostic is a single problem found in a scene file. Line and column
+// are 1-based.
+type SceneDiagnostic struct {
+	Source   string `json:"source"` // tsc, lsp or lint
+	Code     string `json:"code,omitempty"`
+	Severity string `json:"severity"` // error or warning
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Message  string `json:"message"`
+}
+
+type SceneCheckResponseMetadata struct {
+	FilePath    string            `json:"file_path"`
+	TypeChecker string            `json:"type_checker"` // tsc, lsp or none
+	Passed      bool              `json:"passed"`
+	Diagnostics []SceneDiagnostic `json:"diagnostics"`
+}
+
+type sceneCheckTool struct {
+	lspClients map[string]*lsp.Client
+}
+
+const (
+	SceneCheckToolName = "scene_check"
+
+	// DefaultScenePath is the scene checked when no file is given.
+	DefaultScenePath = "frontend/src/scenes/example.tsx"
+
+	sceneCheckTimeout = 2 * time.Minute
+
+	severityError   = "error"
+	severityWarning = "warning"
+
+	sceneCheckDescription = `Validates a Motion Canvas scene file (.tsx) before you report it as done.
+
+WHEN TO USE THIS TOOL:
+- Use after writing or editing a scene file
+- Use again after every fix until the check passes
+
+HOW TO USE:
+- Provide the path of the scene file, defaults to ` + DefaultScenePath + `
+- Fix every error in the returned diagnostics and run the check again
+
+FEATURES:
+- Type-checks the scene against the project's tsconfig.json with tsc --noEmit, or with the TypeScript language server when tsc is not installed
+- Lints for Motion Canvas guideline violations:
+  - no-layout: Layout nodes and the layout prop are not allowed, use Rect and Node
+  - allowed-imports: imports must come from @motion-canvas/2d or @motion-canvas/core
+  - make-scene: the file must export default makeScene2D(function* (view) {...})
+  - view-fill: the scene must set the background with view.fill(...)
+- Returns diagnostics with source, code, severity, line and column
+
+LIMITATIONS:
+- Only diagnostics of the checked file are reported
+- The type check is skipped when neither tsc nor a TypeScript language server is available
+
+TIPS:
+- Diagnostics are sorted by line, fix them from top to bottom
+- Type errors often cascade, re-run the check after fixing the first ones`
+)
+
+func NewSceneCheckTool(lspClients map[string]*lsp.Client) BaseTool {
+	return &sceneCheckTool{
+		lspClients,
+	}
+}
+
+func (s *sceneCheckTool) Info() ToolInfo {
+	return ToolInfo{
+		Name:        SceneCheckToolName,
+		Description: sceneCheckDescription,
+		Parameters: map[string]any{
+			"file_path": map[string]any{
+				"type":        "string",
+				"description": "The path to the scene file to check (defaults to " + DefaultScenePath + ")",
+			},
+		},
+		Required: []string{},
+	}
+}
+
+func (s *sceneCheckTool) Run(ctx context.Context, call ToolCall) (ToolResponse, error) {
+	var params SceneCheckParams
+	if err := json.Unmarshal([]byte(call.Input), &params); err != nil {
+		return NewTextErrorResponse(fmt.Sprintf("error parsing parameters: %s", err)), nil
+	}
+
+	filePath := params.FilePath
+	if filePath == "" {
+		filePath = DefaultScenePath
+	}
+	if !filepath.IsAbs(filePath) {
+		filePath = filepath.Join(config.WorkingDirectory(), filePath)
+	}
+
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return NewTextErrorResponse(fmt.Sprintf("file not found: %s", filePath)), nil
+		}
+		return ToolResponse{}, fmt.Errorf("error reading scene: %w", err)
+	}
+
+	diagnostics, typeChecker, err := s.typeCheck(ctx, filePath)
+	if err != nil {
+		return ToolResponse{}, err
+	}
+	diagnostics = append(diagnostics, lintScene(string(content))...)
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		if diagnostics[i].Line != diagnostics[j].Line {
+			return diagnostics[i].Line < diagnostics[j].Line
+		}
+		return diagnostics[i].Column < diagnostics[j].Column
+	})
+
+	metadata := SceneCheckResponseMetadata{
+		FilePath:    filePath,
+		TypeChecker: typeChecker,
+		Passed:      countSceneSeverity(diagnostics, severityError) == 0,
+		Diagnostics: diagnostics,
+	}
+	logging.Debug("Scene check finished", "file", filePath, "type_checker", typeChecker, "diagnostics", len(diagnostics))
+	return WithResponseMetadata(NewTextResponse(formatSceneCheck(metadata)), metadata), nil
+}
+
+// typeCheck runs tsc from the project of the scene when it is installed and
+// falls back to the LSP clients otherwise.
+func (s *sceneCheckTool) typeCheck(ctx context.Context, filePath string) ([]SceneDiagnostic, string, error) {
+	projectDir := findTSConfigDir(filePath)
+	if projectDir != "" {
+		if tsc := findTSC(projectDir); tsc != "" {
+			diagnostics, err := runTSC(ctx, tsc, projectDir, filePath)
+			return diagnostics, "tsc", err
+		}
+	}
+
+	if len(s.lspClients) > 0 {
+		notifyLspOpenFile(ctx, filePath, s.lspClients)
+		waitForLspDiagnostics(ctx, filePath, s.lspClients)
+		return lspSceneDiagnostics(filePath, s.lspClients), "lsp", nil
+	}
+	return nil, "none", nil
+}
+
+// findTSConfigDir returns the closest directory above filePath that has a
+// tsconfig.json, without leaving the working directory.
+func findTSConfigDir(filePath string) string {
+	root := config.WorkingDirectory()
+	for dir := filepath.Dir(filePath); ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, "tsconfig.json")); err == nil {
+			return dir
+		}
+		if dir == root || dir == filepath.Dir(dir) {
+			return ""
+		}
+	}
+}
+
+func findTSC(projectDir string) string {
+	local := filepath.Join(projectDir, "node_modules", ".bin", "tsc")
+	if _, err := os.Stat(local); err == nil {
+		return local
+	}
+	if path, err := exec.LookPath("tsc"); err == nil {
+		return path
+	}
+	return ""
+}
+
+func runTSC(ctx context.Context, tsc, projectDir, filePath string) ([]SceneDiagnostic, error) {
+	ctx, cancel := context.WithTimeout(ctx, sceneCheckTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, tsc, "--noEmit", "--pretty", "false", "-p", projectDir)
+	cmd.Dir = projectDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		// tsc exits with a non-zero status when it reports errors
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("error running tsc: %w", err)
+		}
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("tsc timed out after %s", sceneCheckTimeout)
+		}
+	}
+	return parseTSCOutput(string(output), projectDir, filePath), nil
+}
+
+var tscDiagnosticPattern = regexp.MustCompile(`^(.+)\((\d+),(\d+)\): (error|warning) (TS\d+): (.*)$`)
+
+// parseTSCOutput extracts the diagnostics of filePath from tsc output in the
+// --pretty false format. Paths in the output are relative to projectDir.
+func parseTSCOutput(output, projectDir, filePath string) []SceneDiagnostic {
+	var diagnostics []SceneDiagnostic
+	current := false
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+		match := tscDiagnosticPattern.FindStringSubmatch(line)
+		if match == nil {
+			// Related information and message chains are indented
+			if current && strings.HasPrefix(line, " ") {
+				last := &diagnostics[len(diagnostics)-1]
+				last.Message += "\n" + strings.TrimSpace(line)
+			}
+			continue
+		}
+
+		path := match[1]
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(projectDir, path)
+		}
+		current = filepath.Clean(path) == filepath.Clean(filePath)
+		if !current {
+			continue
+		}
+		lineNum, _ := strconv.Atoi(match[2])
+		column, _ := strconv.Atoi(match[3])
+		diagnostics = append(diagnostics, SceneDiagnostic{
+			Source:   "tsc",
+			Code:     match[5],
+			Severity: match[4],
+			Line:     lineNum,
+			Column:   column,
+			Message:  match[6],
+		})
+	}
+	return diagnostics
+}
+
+func lspSceneDiagnostics(filePath string, lsps map[string]*lsp.Client) []SceneDiagnostic {
+	var diagnostics []SceneDiagnostic
+	for _, client := range lsps {
+		for uri, diags := range client.GetDiagnostics() {
+			if uri.Path() != filePath {
+				continue
+			}
+			for _, diag := range diags {
+				severity := severityWarning
+				if diag.Severity == protocol.SeverityError {
+					severity = severityError
+				} else if diag.Severity != protocol.SeverityWarning {
+					continue
+				}
+				code := ""
+				if diag.Code != nil {
+					code = fmt.Sprintf("%v", diag.Code)
+				}
+				diagnostics = append(diagnostics, SceneDiagnostic{
+					Source:   "lsp",
+					Code:     code,
+					Severity: severity,
+					Line:     int(diag.Range.Start.Line) + 1,
+					Column:   int(diag.Range.Start.Character) + 1,
+					Message:  diag.Message,
+				})
+			}
+		}
+	}
+	return diagnostics
+}
+
+var (
+	sceneImportPattern = regexp.MustCompile(`(?m)^\s*import\s+(?:[^'";]*?\bfrom\s*)?['"]([^'"]+)['"]`)
+	// The layout prop is only matched inside a JSX tag, its group is where
+	// it starts
+	sceneLayoutPattern = regexp.MustCompile(`<Layout\b|\bnew\s+Layout\s*\(|<\w+[^>]*\s(layout)(?:\s*=\s*\{\s*true\s*\})?[\s/>]`)
+	sceneMakePattern   = regexp.MustCompile(`export\s+default\s+makeScene2D\s*\(\s*function\s*\*\s*\w*\s*\(\s*(\w+)`)
+)
+
+var allowedSceneImports = []string{"@motion-canvas/2d", "@motion-canvas/core"}
+
+// lintScene checks a scene against the rules of MotionCanvasGuidelines.md
+// that the type checker cannot catch.
+func lintScene(source string) []SceneDiagnostic {
+	code := stripComments(source)
+	var diagnostics []SceneDiagnostic
+	add := func(rule string, offset int, message string) {
+		line, column := lineColumn(code, offset)
+		diagnostics = append(diagnostics, SceneDiagnostic{
+			Source:   "lint",
+			Code:     rule,
+			Severity: severityError,
+			Line:     line,
+			Column:   column,
+			Message:  message,
+		})
+	}
+
+	for _, match := range sceneImportPattern.FindAllStringSubmatchIndex(code, -1) {
+		module := code[match[2]:match[3]]
+		if !isAllowedSceneImport(module) {
+			add("allowed-imports", match[2], fmt.Sprintf("import from %q is not allowed, import only from @motion-canvas/2d or @motion-canvas/core", module))
+		}
+	}
+
+	// Text props may mention layouts, only look at the code itself
+	bare := blankStrings(code)
+	for _, match := range sceneLayoutPattern.FindAllStringSubmatchIndex(bare, -1) {
+		start := match[0]
+		if match[2] >= 0 {
+			start = match[2]
+		}
+		add("no-layout", start, "Layout and the layout prop are not allowed, position children with Rect and Node")
+	}
+
+	match := sceneMakePattern.FindStringSubmatchIndex(code)
+	if match == nil {
+		add("make-scene", 0, "the scene must export default makeScene2D(function* (view) {...})")
+		return diagnostics
+	}
+	view := code[match[2]:match[3]]
+	if !regexp.MustCompile(`\b` + regexp.QuoteMeta(view) + `\.fill\s*\(`).MatchString(code) {
+		add("view-fill", match[0], fmt.Sprintf("the scene must set the background color with %s.fill('#000000')", view))
+	}
+	return diagnostics
+}
+
+func isAllowedSceneImport(module string) bool {
+	for _, allowed := range allowedSceneImports {
+		if module == allowed || strings.HasPrefix(module, allowed+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// stripComments blanks out comments, keeping offsets and line numbers intact.
+func stripComments(source string) string {
+	return blankSource(source, false)
+}
+
+// blankStrings blanks out the contents of string literals as well.
+func blankStrings(source string) string {
+	return blankSource(source, true)
+}
+
+// blankSource replaces comments, and string contents when blank is set, with
+// spaces. It does not understand JSX text or regular expression literals,
+// which is good enough for the lint rules.
+func blankSource(source string, blank bool) string {
+	out := []byte(source)
+	var quote byte
+	for i := 0; i < len(out); i++ {
+		c := out[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+				continue
+			}
+			if c == '\\' && i+1 < len(out) {
+				if blank {
+					out[i] = ' '
+				}
+				i++
+				c = out[i]
+			}
+			if blank && c != '\n' {
+				out[i] = ' '
+			}
+		case c == '"' || c == '\'' || c == '`':
+			quote = c
+		case c == '/' && i+1 < len(out) && out[i+1] == '/':
+			for ; i < len(out) && out[i] != '\n'; i++ {
+				out[i] = ' '
+			}
+		case c == '/' && i+1 < len(out) && out[i+1] == '*':
+			end := strings.Index(string(out[i+2:]), "*/")
+			stop := len(out)
+			if end >= 0 {
+				stop = i + 2 + end + 2
+			}
+			for ; i < stop; i++ {
+				if out[i] != '\n' {
+					out[i] = ' '
+				}
+			}
+			i--
+		}
+	}
+	return string(out)
+}
+
+func lineColumn(source string, offset int) (int, int) {
+	before := source[:offset]
+	line := strings.Count(before, "\n") + 1
+	column := offset - strings.LastIndex(before, "\n")
+	return line, column
+}
+
+func countSceneSeverity(diagnostics []SceneDiagnostic, severity string) int {
+	count := 0
+	for _, diag := range diagnostics {
+		if diag.Severity == severity {
+			count++
+		}
+	}
+	return count
+}
+
+func formatSceneCheck(result SceneCheckResponseMetadata) string {
+	var output strings.Builder
+	fmt.Fprintf(&output, "<scene_check file=%q type_checker=%q>\n", result.FilePath, result.TypeChecker)
+	for _, diag := range result.Diagnostics {
+		code := diag.Source
+		if diag.Code != "" {
+			code += " " + diag.Code
+		}
+		fmt.Fprintf(&output, "%s: %d:%d [%s] %s\n", diag.Severity, diag.Line, diag.Column, code, diag.Message)
+	}
+	output.WriteString("</scene_check>\n")
+
+	if result.TypeChecker == "none" {
+		output.WriteString("Type check skipped: neither tsc nor a TypeScript language server is available.\n")
+	}
+	errorCount := countSceneSeverity(result.Diagnostics, severityError)
+	fmt.Fprintf(&output, "%d errors, %d warnings\n", errorCount, countSceneSeverity(result.Diagnostics, severityWarning))
+	if result.Passed {
+		output.WriteString("The scene passed the check.\n")
+	} else {
+		output.WriteString("Fix the errors above and run scene_check again.\n")
+	}
+	return output.String()
+}
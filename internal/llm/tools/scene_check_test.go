@@ -0,0 +1,99 @@
+package tools
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLintScene(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   []string
+	}{
+		{
+			name: "valid scene",
+			source: `import {makeScene2D, Circle} from '@motion-canvas/2d';
+import {
+  all,
+  createRef,
+} from '@motion-canvas/core';
+
+// A Layout would be nice here, but we use Rect
+export default makeScene2D(function* (view) {
+  view.fill('#000000');
+  const layout = {gap: 20};
+  view.add(<Txt text="no layout here" x={layout.gap} />);
+  yield* all(layout ? view.opacity(1, 1) : view.opacity(0, 1));
+});`,
+			want: nil,
+		},
+		{
+			name: "guideline violations",
+			source: `import {makeScene2D, Layout} from '@motion-canvas/2d';
+import {logMethods} from './utils';
+import 'side-effect';
+
+export default makeScene2D(function* (scene) {
+  scene.add(<Layout direction="column" />);
+  scene.add(<Rect layout width={100} />);
+  scene.add(
+    <Rect
+      width={100}
+      layout={true}
+    />,
+  );
+});`,
+			want: []string{"allowed-imports", "allowed-imports", "no-layout", "no-layout", "no-layout", "view-fill"},
+		},
+		{
+			name:   "missing makeScene2D",
+			source: `export const scene = 1;`,
+			want:   []string{"make-scene"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rules []string
+			for _, diag := range lintScene(tt.source) {
+				assert.Equal(t, "lint", diag.Source)
+				assert.Equal(t, severityError, diag.Severity)
+				rules = append(rules, diag.Code)
+			}
+			assert.Equal(t, tt.want, rules)
+		})
+	}
+}
+
+func TestLintScene_Position(t *testing.T) {
+	diags := lintScene("import {makeScene2D} from '@motion-canvas/2d';\nimport {x} from 'lodash';\nexport default makeScene2D(function* (view) { view.fill('#000') });")
+	if assert.Len(t, diags, 1) {
+		assert.Equal(t, 2, diags[0].Line)
+		assert.Equal(t, 18, diags[0].Column)
+	}
+
+	// The layout prop is reported where it is, not at its tag
+	diags = lintScene("import {makeScene2D} from '@motion-canvas/2d';\nexport default makeScene2D(function* (view) { view.fill('#000'); view.add(<Rect layout />) });")
+	if assert.Len(t, diags, 1) {
+		assert.Equal(t, 2, diags[0].Line)
+		assert.Equal(t, 81, diags[0].Column)
+	}
+}
+
+func TestParseTSCOutput(t *testing.T) {
+	projectDir := filepath.Join(string(filepath.Separator), "project", "frontend")
+	scene := filepath.Join(projectDir, "src", "scenes", "example.tsx")
+	output := `src/scenes/example.tsx(12,5): error TS2304: Cannot find name 'foo'.
+src/scenes/other.tsx(1,1): error TS2307: Cannot find module 'x'.
+src/scenes/example.tsx(20,10): error TS2322: Type 'string' is not assignable to type 'number'.
+  The expected type comes from property 'x'.
+`
+	diags := parseTSCOutput(output, projectDir, scene)
+	if assert.Len(t, diags, 2) {
+		assert.Equal(t, SceneDiagnostic{Source: "tsc", Code: "TS2304", Severity: "error", Line: 12, Column: 5, Message: "Cannot find name 'foo'."}, diags[0])
+		assert.Equal(t, 20, diags[1].Line)
+		assert.Contains(t, diags[1].Message, "The expected type comes from property 'x'.")
+	}
+}
@@ -1,8 +1,42 @@
 package message
 
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// MaxAttachmentSize is the size limit of an attached file.
+const MaxAttachmentSize = int64(5 * 1024 * 1024) // 5MB
+
 type Attachment struct {
 	FilePath string
 	FileName string
 	MimeType string
 	Content  []byte
 }
+
+// ReadAttachment reads the file at path, detecting its MIME type from its
+// first bytes.
+func ReadAttachment(path string) (Attachment, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return Attachment{}, fmt.Errorf("unable to read %s: %w", path, err)
+	}
+	if info.Size() > MaxAttachmentSize {
+		return Attachment{}, fmt.Errorf("%s is too large, max 5MB", path)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Attachment{}, fmt.Errorf("unable to read %s: %w", path, err)
+	}
+
+	mimeBufferSize := min(512, len(content))
+	return Attachment{
+		FilePath: path,
+		FileName: filepath.Base(path),
+		MimeType: http.DetectContentType(content[:mimeBufferSize]),
+		Content:  content,
+	}, nil
+}
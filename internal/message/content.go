@@ -15,6 +15,9 @@ const (
 	User      MessageRole = "user"
 	System    MessageRole = "system"
 	Tool      MessageRole = "tool"
+	// Summary messages hold the summary of a compacted conversation. They are
+	// sent to the model in place of the history but never shown.
+	Summary MessageRole = "summary"
 )
 
 type FinishReason string
@@ -26,6 +29,7 @@ const (
 	FinishReasonCanceled         FinishReason = "canceled"
 	FinishReasonError            FinishReason = "error"
 	FinishReasonPermissionDenied FinishReason = "permission_denied"
+	FinishReasonLimitReached     FinishReason = "limit_reached"
 
 	// Should never happen
 	FinishReasonUnknown FinishReason = "unknown"
@@ -1,6 +1,7 @@
 package permission
 
 import (
+	"context"
 	"errors"
 	"path/filepath"
 	"slices"
@@ -37,42 +38,57 @@ type Service interface {
 	GrantPersistant(permission PermissionRequest)
 	Grant(permission PermissionRequest)
 	Deny(permission PermissionRequest)
-	Request(opts CreatePermissionRequest) bool
+	Request(ctx context.Context, opts CreatePermissionRequest) bool
 	AutoApproveSession(sessionID string)
+	IsAutoApproved(sessionID string) bool
 }
 
 type permissionService struct {
 	*pubsub.Broker[PermissionRequest]
 
+	mu                  sync.RWMutex
 	sessionPermissions  []PermissionRequest
 	pendingRequests     sync.Map
 	autoApproveSessions []string
+
+	// sessionTurns lets one request per session wait for an answer at a
+	// time, tools may run concurrently but the UIs show a single permission
+	// dialog for a session. A turn is held by filling the session's channel.
+	sessionTurns map[string]chan struct{}
 }
 
 func (s *permissionService) GrantPersistant(permission PermissionRequest) {
-	respCh, ok := s.pendingRequests.Load(permission.ID)
-	if ok {
-		respCh.(chan bool) <- true
-	}
+	s.mu.Lock()
 	s.sessionPermissions = append(s.sessionPermissions, permission)
+	s.mu.Unlock()
+
+	s.answer(permission, true)
 }
 
 func (s *permissionService) Grant(permission PermissionRequest) {
-	respCh, ok := s.pendingRequests.Load(permission.ID)
-	if ok {
-		respCh.(chan bool) <- true
-	}
+	s.answer(permission, true)
 }
 
 func (s *permissionService) Deny(permission PermissionRequest) {
-	respCh, ok := s.pendingRequests.Load(permission.ID)
-	if ok {
-		respCh.(chan bool) <- false
+	s.answer(permission, false)
+}
+
+// answer sends the answer to the waiting request. Only the first answer is
+// sent, a request may be answered by the user and denied by the server
+// concurrently.
+func (s *permissionService) answer(permission PermissionRequest, granted bool) {
+	if respCh, ok := s.pendingRequests.LoadAndDelete(permission.ID); ok {
+		respCh.(chan bool) <- granted
 	}
 }
 
-func (s *permissionService) Request(opts CreatePermissionRequest) bool {
-	if slices.Contains(s.autoApproveSessions, opts.SessionID) {
+// Request asks the user for permission and waits for the answer, the request
+// is denied when ctx is done first.
+func (s *permissionService) Request(ctx context.Context, opts CreatePermissionRequest) bool {
+	s.mu.RLock()
+	autoApprove := slices.Contains(s.autoApproveSessions, opts.SessionID)
+	s.mu.RUnlock()
+	if autoApprove {
 		return true
 	}
 	dir := filepath.Dir(opts.Path)
@@ -89,10 +105,18 @@ func (s *permissionService) Request(opts CreatePermissionRequest) bool {
 		Params:      opts.Params,
 	}
 
-	for _, p := range s.sessionPermissions {
-		if p.ToolName == permission.ToolName && p.Action == permission.Action && p.SessionID == permission.SessionID && p.Path == permission.Path {
-			return true
-		}
+	turn := s.sessionTurn(opts.SessionID)
+	select {
+	case turn <- struct{}{}:
+		defer func() { <-turn }()
+	case <-ctx.Done():
+		return false
+	}
+
+	// Checked after waiting for our turn, an earlier request may have been
+	// granted for the whole session
+	if s.hasSessionPermission(permission) {
+		return true
 	}
 
 	respCh := make(chan bool, 1)
@@ -102,18 +126,52 @@ func (s *permissionService) Request(opts CreatePermissionRequest) bool {
 
 	s.Publish(pubsub.CreatedEvent, permission)
 
-	// Wait for the response with a timeout
-	resp := <-respCh
-	return resp
+	select {
+	case resp := <-respCh:
+		return resp
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (s *permissionService) sessionTurn(sessionID string) chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	turn, ok := s.sessionTurns[sessionID]
+	if !ok {
+		turn = make(chan struct{}, 1)
+		s.sessionTurns[sessionID] = turn
+	}
+	return turn
+}
+
+func (s *permissionService) hasSessionPermission(permission PermissionRequest) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, p := range s.sessionPermissions {
+		if p.ToolName == permission.ToolName && p.Action == permission.Action && p.SessionID == permission.SessionID && p.Path == permission.Path {
+			return true
+		}
+	}
+	return false
 }
 
 func (s *permissionService) AutoApproveSession(sessionID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.autoApproveSessions = append(s.autoApproveSessions, sessionID)
 }
 
+func (s *permissionService) IsAutoApproved(sessionID string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Contains(s.autoApproveSessions, sessionID)
+}
+
 func NewPermissionService() Service {
 	return &permissionService{
 		Broker:             pubsub.NewBroker[PermissionRequest](),
 		sessionPermissions: make([]PermissionRequest, 0),
+		sessionTurns:       make(map[string]chan struct{}),
 	}
 }
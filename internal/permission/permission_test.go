@@ -0,0 +1,94 @@
+package permission
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/opencode-ai/opencode/internal/pubsub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestWaitsPerSession(t *testing.T) {
+	svc := NewPermissionService()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := svc.Subscribe(ctx)
+
+	request := func(ctx context.Context, sessionID string) <-chan bool {
+		answer := make(chan bool, 1)
+		go func() {
+			answer <- svc.Request(ctx, CreatePermissionRequest{
+				SessionID: sessionID,
+				ToolName:  "bash",
+				Action:    "execute",
+				Path:      "/project/src",
+			})
+		}()
+		return answer
+	}
+	next := func() PermissionRequest {
+		select {
+		case event := <-events:
+			require.Equal(t, pubsub.CreatedEvent, event.Type)
+			return event.Payload
+		case <-time.After(time.Second):
+			t.Fatal("no permission request was published")
+		}
+		return PermissionRequest{}
+	}
+
+	// An unanswered prompt doesn't hold up the prompts of other sessions
+	sessionCtx, cancelSession := context.WithCancel(ctx)
+	unanswered := request(sessionCtx, "session-1")
+	assert.Equal(t, "session-1", next().SessionID)
+	other := request(ctx, "session-2")
+	req := next()
+	assert.Equal(t, "session-2", req.SessionID)
+	svc.Grant(req)
+	assert.True(t, <-other)
+
+	// Cancelling the session denies its waiting prompt
+	cancelSession()
+	select {
+	case granted := <-unanswered:
+		assert.False(t, granted)
+	case <-time.After(time.Second):
+		t.Fatal("the request of the cancelled session kept waiting")
+	}
+
+	// and lets the session ask again
+	again := request(ctx, "session-1")
+	req = next()
+	svc.Deny(req)
+	assert.False(t, <-again)
+}
+
+func TestAnswerOnce(t *testing.T) {
+	svc := NewPermissionService()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := svc.Subscribe(ctx)
+
+	answer := make(chan bool, 1)
+	go func() {
+		answer <- svc.Request(ctx, CreatePermissionRequest{SessionID: "session-1", ToolName: "bash", Action: "execute", Path: "/project/src"})
+	}()
+	req := (<-events).Payload
+
+	// Later answers of the same request are dropped instead of blocking
+	answered := make(chan struct{})
+	go func() {
+		svc.Deny(req)
+		svc.Deny(req)
+		svc.Grant(req)
+		close(answered)
+	}()
+	select {
+	case <-answered:
+	case <-time.After(time.Second):
+		t.Fatal("answering the request twice blocked")
+	}
+	assert.False(t, <-answer)
+}
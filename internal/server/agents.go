@@ -0,0 +1,33 @@
+package server
+
+import (
+	"sync"
+
+	"github.com/opencode-ai/opencode/internal/config"
+)
+
+// agentRegistry remembers the agent each session runs on. Sessions without
+// one, such as sessions from an earlier server run, run on the coder.
+type agentRegistry struct {
+	mu     sync.Mutex
+	agents map[string]config.AgentName // session ID -> agent
+}
+
+func newAgentRegistry() *agentRegistry {
+	return &agentRegistry{agents: make(map[string]config.AgentName)}
+}
+
+func (r *agentRegistry) set(sessionID string, name config.AgentName) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.agents[sessionID] = name
+}
+
+func (r *agentRegistry) get(sessionID string) config.AgentName {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if name, ok := r.agents[sessionID]; ok {
+		return name
+	}
+	return config.AgentCoder
+}
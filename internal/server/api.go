@@ -0,0 +1,307 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/opencode-ai/opencode/internal/config"
+	"github.com/opencode-ai/opencode/internal/history"
+	"github.com/opencode-ai/opencode/internal/logging"
+	"github.com/opencode-ai/opencode/internal/message"
+	"github.com/opencode-ai/opencode/internal/session"
+	"github.com/opencode-ai/opencode/internal/transcript"
+)
+
+// SessionPayload is the REST representation of a session.
+type SessionPayload struct {
+	ID               string  `json:"id"`
+	ParentSessionID  string  `json:"parent_session_id,omitempty"`
+	Title            string  `json:"title"`
+	MessageCount     int64   `json:"message_count"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	Cost             float64 `json:"cost"`
+	CreatedAt        int64   `json:"created_at"`
+	UpdatedAt        int64   `json:"updated_at"`
+
+	// Tokens used over the whole session, its sub-agents included
+	TotalPromptTokens     int64 `json:"total_prompt_tokens"`
+	TotalCompletionTokens int64 `json:"total_completion_tokens"`
+}
+
+// MessagePayload is the REST representation of a message and its parts.
+type MessagePayload struct {
+	ID        string        `json:"id"`
+	SessionID string        `json:"session_id"`
+	Role      string        `json:"role"`
+	Model     string        `json:"model,omitempty"`
+	Parts     []PartPayload `json:"parts"`
+	CreatedAt int64         `json:"created_at"`
+	UpdatedAt int64         `json:"updated_at"`
+}
+
+// PartPayload wraps a content part with its type, mirroring how parts are
+// stored in the database.
+type PartPayload struct {
+	Type string `json:"type"`
+	Data any    `json:"data"`
+}
+
+// binaryPart leaves out the raw bytes, the overlay only needs to know that an
+// attachment was sent.
+type binaryPart struct {
+	Path     string `json:"path"`
+	MIMEType string `json:"mime_type"`
+}
+
+// FilePayload is the REST representation of a file version.
+type FilePayload struct {
+	ID        string `json:"id"`
+	SessionID string `json:"session_id"`
+	Path      string `json:"path"`
+	Content   string `json:"content"`
+	Version   string `json:"version"`
+	CreatedAt int64  `json:"created_at"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+// AgentPayload describes an agent a session can run on.
+type AgentPayload struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Model       string `json:"model"`
+}
+
+type renameSessionRequest struct {
+	Title string `json:"title"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// apiRoutes registers the REST endpoints used by the overlay to browse and
+// manage past sessions.
+func (s *ChatServer) apiRoutes(r chi.Router) {
+	r.Get("/agents", s.handleListAgents)
+	r.Get("/sessions", s.handleListSessions)
+	r.Route("/sessions/{sessionID}", func(r chi.Router) {
+		r.Get("/", s.handleGetSession)
+		r.Patch("/", s.handleRenameSession)
+		r.Delete("/", s.handleDeleteSession)
+		r.Get("/messages", s.handleListMessages)
+		r.Get("/files", s.handleListFiles)
+	})
+}
+
+func (s *ChatServer) handleListAgents(w http.ResponseWriter, r *http.Request) {
+	agents := config.Get().Agents
+	names := s.app.AgentNames()
+	payload := make([]AgentPayload, len(names))
+	for i, name := range names {
+		payload[i] = AgentPayload{
+			Name:        string(name),
+			Description: agents[name].Description,
+			Model:       string(agents[name].Model),
+		}
+	}
+	writeJSON(w, http.StatusOK, payload)
+}
+
+func (s *ChatServer) handleListSessions(w http.ResponseWriter, r *http.Request) {
+	sessions, err := s.app.Sessions.List(r.Context())
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	payload := make([]SessionPayload, len(sessions))
+	for i, sess := range sessions {
+		payload[i] = toSessionPayload(sess)
+	}
+	writeJSON(w, http.StatusOK, payload)
+}
+
+func (s *ChatServer) handleGetSession(w http.ResponseWriter, r *http.Request) {
+	sess, err := s.app.Sessions.Get(r.Context(), chi.URLParam(r, "sessionID"))
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toSessionPayload(sess))
+}
+
+func (s *ChatServer) handleRenameSession(w http.ResponseWriter, r *http.Request) {
+	var req renameSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid request body"})
+		return
+	}
+	req.Title = strings.TrimSpace(req.Title)
+	if req.Title == "" {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "title is required"})
+		return
+	}
+
+	sess, err := s.app.Sessions.Get(r.Context(), chi.URLParam(r, "sessionID"))
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	sess.Title = req.Title
+	sess, err = s.app.Sessions.Save(r.Context(), sess)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toSessionPayload(sess))
+}
+
+func (s *ChatServer) handleDeleteSession(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	sess, err := s.app.Sessions.Get(ctx, chi.URLParam(r, "sessionID"))
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	if s.app.IsSessionBusy(sess.ID) {
+		writeJSON(w, http.StatusConflict, errorResponse{Error: "session is busy"})
+		return
+	}
+
+	svc := transcript.Services{Sessions: s.app.Sessions, Messages: s.app.Messages, History: s.app.History}
+	if err := transcript.Delete(ctx, svc, sess.ID); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	logging.Info("Deleted session", "session_id", sess.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *ChatServer) handleListMessages(w http.ResponseWriter, r *http.Request) {
+	sess, err := s.app.Sessions.Get(r.Context(), chi.URLParam(r, "sessionID"))
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	msgs, err := s.app.Messages.List(r.Context(), sess.ID)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	payload := make([]MessagePayload, 0, len(msgs))
+	for _, msg := range msgs {
+		// Summaries of compacted conversations are for the model only
+		if msg.Role == message.Summary {
+			continue
+		}
+		payload = append(payload, toMessagePayload(msg))
+	}
+	writeJSON(w, http.StatusOK, payload)
+}
+
+// handleListFiles returns every file version written in the session, or only
+// the latest version of each file with ?latest=true.
+func (s *ChatServer) handleListFiles(w http.ResponseWriter, r *http.Request) {
+	sess, err := s.app.Sessions.Get(r.Context(), chi.URLParam(r, "sessionID"))
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	var files []history.File
+	if r.URL.Query().Get("latest") == "true" {
+		files, err = s.app.History.ListLatestSessionFiles(r.Context(), sess.ID)
+	} else {
+		files, err = s.app.History.ListBySession(r.Context(), sess.ID)
+	}
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	payload := make([]FilePayload, len(files))
+	for i, f := range files {
+		payload[i] = toFilePayload(f)
+	}
+	writeJSON(w, http.StatusOK, payload)
+}
+
+func toSessionPayload(s session.Session) SessionPayload {
+	return SessionPayload{
+		ID:               s.ID,
+		ParentSessionID:  s.ParentSessionID,
+		Title:            s.Title,
+		MessageCount:     s.MessageCount,
+		PromptTokens:     s.PromptTokens,
+		CompletionTokens: s.CompletionTokens,
+		Cost:             s.Cost,
+		CreatedAt:        s.CreatedAt,
+		UpdatedAt:        s.UpdatedAt,
+
+		TotalPromptTokens:     s.TotalPromptTokens,
+		TotalCompletionTokens: s.TotalCompletionTokens,
+	}
+}
+
+func toMessagePayload(msg message.Message) MessagePayload {
+	parts := make([]PartPayload, 0, len(msg.Parts))
+	for _, part := range msg.Parts {
+		switch p := part.(type) {
+		case message.ReasoningContent:
+			parts = append(parts, PartPayload{Type: "reasoning", Data: p})
+		case message.TextContent:
+			parts = append(parts, PartPayload{Type: "text", Data: p})
+		case message.ImageURLContent:
+			parts = append(parts, PartPayload{Type: "image_url", Data: p})
+		case message.BinaryContent:
+			parts = append(parts, PartPayload{Type: "binary", Data: binaryPart{Path: p.Path, MIMEType: p.MIMEType}})
+		case message.ToolCall:
+			parts = append(parts, PartPayload{Type: "tool_call", Data: p})
+		case message.ToolResult:
+			parts = append(parts, PartPayload{Type: "tool_result", Data: p})
+		case message.Finish:
+			parts = append(parts, PartPayload{Type: "finish", Data: p})
+		}
+	}
+	return MessagePayload{
+		ID:        msg.ID,
+		SessionID: msg.SessionID,
+		Role:      string(msg.Role),
+		Model:     string(msg.Model),
+		Parts:     parts,
+		CreatedAt: msg.CreatedAt,
+		UpdatedAt: msg.UpdatedAt,
+	}
+}
+
+func toFilePayload(f history.File) FilePayload {
+	return FilePayload{
+		ID:        f.ID,
+		SessionID: f.SessionID,
+		Path:      f.Path,
+		Content:   f.Content,
+		Version:   f.Version,
+		CreatedAt: f.CreatedAt,
+		UpdatedAt: f.UpdatedAt,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logging.Error("Failed to write JSON response", "error", err)
+	}
+}
+
+// writeAPIError maps a service error to a JSON error response.
+func writeAPIError(w http.ResponseWriter, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "not found"})
+		return
+	}
+	logging.Error("API request failed", "error", err)
+	writeJSON(w, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"crypto/subtle"
+	"io"
+	"log"
+	"net/http"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/gorilla/websocket"
+	"github.com/opencode-ai/opencode/internal/logging"
+)
+
+// authSubprotocol is the WebSocket subprotocol browsers offer, followed by
+// the token, to authenticate the upgrade: new WebSocket(url, ["bearer", token]).
+const authSubprotocol = "bearer"
+
+// originAllowed reports whether a browser origin may talk to the server.
+// Requests without an Origin header do not come from a browser and are left
+// to the token check.
+func originAllowed(origin string, allowedOrigins []string) bool {
+	if origin == "" {
+		return true
+	}
+	return slices.Contains(allowedOrigins, "*") || slices.Contains(allowedOrigins, origin)
+}
+
+func newUpgrader(allowedOrigins []string) websocket.Upgrader {
+	return websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool {
+			return originAllowed(r.Header.Get("Origin"), allowedOrigins)
+		},
+		// Browsers fail the connection unless one of their subprotocols is
+		// selected, the token is never echoed back
+		Subprotocols: []string{authSubprotocol},
+	}
+}
+
+// requestLogger is chi's request logger writing to out, with the token query
+// parameter redacted from the logged URI.
+func requestLogger(out io.Writer) func(http.Handler) http.Handler {
+	return middleware.RequestLogger(redactingLogFormatter{
+		LogFormatter: &middleware.DefaultLogFormatter{Logger: log.New(out, "", log.LstdFlags), NoColor: runtime.GOOS == "windows"},
+	})
+}
+
+type redactingLogFormatter struct {
+	middleware.LogFormatter
+}
+
+func (f redactingLogFormatter) NewLogEntry(r *http.Request) middleware.LogEntry {
+	query := r.URL.Query()
+	if !query.Has("token") {
+		return f.LogFormatter.NewLogEntry(r)
+	}
+	query.Set("token", "REDACTED")
+	redacted := r.Clone(r.Context())
+	redacted.URL.RawQuery = query.Encode()
+	redacted.RequestURI = redacted.URL.RequestURI()
+	return f.LogFormatter.NewLogEntry(redacted)
+}
+
+// corsMiddleware rejects requests from disallowed origins and answers CORS
+// preflight requests for the allowed ones.
+func corsMiddleware(allowedOrigins []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if !originAllowed(origin, allowedOrigins) {
+				logging.Warn("Rejecting request from disallowed origin", "origin", origin, "remote_addr", r.RemoteAddr)
+				http.Error(w, "Origin not allowed", http.StatusForbidden)
+				return
+			}
+			if origin != "" {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+				w.Header().Add("Vary", "Origin")
+			}
+
+			if r.Method == http.MethodOptions {
+				logging.Debug("Handling CORS preflight request", "origin", origin)
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// authMiddleware requires the shared secret as a bearer token. Browsers cannot
+// set headers on WebSocket upgrades, so the token is also accepted after the
+// bearer subprotocol, or as the token query parameter. An empty token disables
+// the check.
+func authMiddleware(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if token == "" {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			provided := r.URL.Query().Get("token")
+			if protocols := websocket.Subprotocols(r); len(protocols) == 2 && protocols[0] == authSubprotocol {
+				provided = protocols[1]
+			}
+			if auth := r.Header.Get("Authorization"); auth != "" {
+				provided = strings.TrimPrefix(auth, "Bearer ")
+			}
+			if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+				logging.Warn("Rejecting request with invalid token", "path", r.URL.Path, "remote_addr", r.RemoteAddr)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+
+	"github.com/opencode-ai/opencode/internal/logging"
+	"github.com/opencode-ai/opencode/internal/permission"
+)
+
+// forwardPermissionRequests publishes permission requests of the sessions this
+// connection drives, and remembers them until the client answers.
+func (c *connection) forwardPermissionRequests() {
+	defer logging.RecoverPanic("websocket-permission-events", nil)
+
+	eventChan := c.server.app.Permissions.Subscribe(c.ctx)
+	for event := range eventChan {
+		req := event.Payload
+		if !c.ownsSession(req.SessionID) {
+			continue
+		}
+
+		c.mu.Lock()
+		closed := c.closed
+		if !closed {
+			c.pendingPermissions[req.ID] = req
+		}
+		c.mu.Unlock()
+		if closed {
+			// Published while the connection was closing, nobody will see it
+			c.server.app.Permissions.Deny(req)
+			continue
+		}
+
+		logging.Debug("Forwarding permission request", "permission_id", req.ID, "tool", req.ToolName, "session_id", req.SessionID)
+		c.send(WebSocketMessage{
+			Type:      ServerMessagePermissionRequest,
+			SessionID: req.SessionID,
+			Permission: &PermissionPayload{
+				ID:          req.ID,
+				ToolName:    req.ToolName,
+				Description: req.Description,
+				Action:      req.Action,
+				Path:        req.Path,
+				Params:      req.Params,
+			},
+		})
+	}
+}
+
+func (c *connection) handlePermissionResponse(msg ClientMessage) {
+	c.mu.Lock()
+	req, ok := c.pendingPermissions[msg.PermissionID]
+	delete(c.pendingPermissions, msg.PermissionID)
+	c.mu.Unlock()
+	if !ok {
+		c.sendError("Unknown or expired permission request: " + msg.PermissionID)
+		return
+	}
+
+	logging.Info("Permission decision received", "permission_id", req.ID, "tool", req.ToolName, "decision", msg.Decision)
+	switch msg.Decision {
+	case PermissionGrant:
+		c.server.app.Permissions.Grant(req)
+	case PermissionGrantSession:
+		c.server.app.Permissions.GrantPersistant(req)
+	case PermissionDeny:
+		c.server.app.Permissions.Deny(req)
+	}
+}
+
+// denyPendingPermissions unblocks tools still waiting on this connection,
+// since nobody is left to answer them.
+func (c *connection) denyPendingPermissions() {
+	c.mu.Lock()
+	pending := make([]permission.PermissionRequest, 0, len(c.pendingPermissions))
+	for id, req := range c.pendingPermissions {
+		pending = append(pending, req)
+		delete(c.pendingPermissions, id)
+	}
+	c.mu.Unlock()
+
+	for _, req := range pending {
+		logging.Info("Denying unanswered permission request", "permission_id", req.ID, "tool", req.ToolName)
+		c.server.app.Permissions.Deny(req)
+	}
+}
+
+// denyUnattendedPermissions denies the permission requests of sessions no
+// connection owns, like a generation that keeps running after its client
+// closed the socket. Nobody could answer them and the generation would wait
+// forever, a client that resumes the session sees the denied tool calls.
+func (s *ChatServer) denyUnattendedPermissions(ctx context.Context) {
+	defer logging.RecoverPanic("websocket-unattended-permissions", nil)
+
+	for event := range s.app.Permissions.Subscribe(ctx) {
+		req := event.Payload
+		if s.attached(req.SessionID) {
+			continue
+		}
+		logging.Info("Denying permission request of a session without a client", "permission_id", req.ID, "tool", req.ToolName, "session_id", req.SessionID)
+		s.app.Permissions.Deny(req)
+	}
+}
+
+// attached reports whether an open connection owns the session.
+func (s *ChatServer) attached(sessionID string) bool {
+	s.connsMu.RLock()
+	conns := make([]*connection, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.connsMu.RUnlock()
+	for _, c := range conns {
+		if c.ownsSession(sessionID) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *ChatServer) attach(c *connection) {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	s.conns[c] = struct{}{}
+}
+
+func (s *ChatServer) detach(c *connection) {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	delete(s.conns, c)
+}
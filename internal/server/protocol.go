@@ -0,0 +1,177 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ClientMessageType identifies a message sent by the browser over /ws.
+type ClientMessageType string
+
+const (
+	// ClientMessageStart creates a new session and runs the prompt in it.
+	ClientMessageStart ClientMessageType = "start"
+	// ClientMessageFollowUp runs the prompt in the session bound to the connection.
+	ClientMessageFollowUp ClientMessageType = "follow_up"
+	// ClientMessageResume binds the connection to an existing session, optionally running a prompt.
+	ClientMessageResume ClientMessageType = "resume"
+	// ClientMessageCancel stops the generation running in the bound session.
+	ClientMessageCancel ClientMessageType = "cancel"
+	// ClientMessagePermission answers a permission_request.
+	ClientMessagePermission ClientMessageType = "permission_response"
+	// ClientMessageApprovePlan executes the plan of the bound session, as edited by the client.
+	ClientMessageApprovePlan ClientMessageType = "approve_plan"
+)
+
+// PermissionDecision is the client's answer to a permission request.
+type PermissionDecision string
+
+const (
+	PermissionGrant        PermissionDecision = "grant"
+	PermissionGrantSession PermissionDecision = "grant_session"
+	PermissionDeny         PermissionDecision = "deny"
+)
+
+// ClientMessage is the envelope for every client→server message.
+type ClientMessage struct {
+	Type         ClientMessageType  `json:"type"`
+	SessionID    string             `json:"session_id,omitempty"`
+	Prompt       string             `json:"prompt,omitempty"`
+	PermissionID string             `json:"permission_id,omitempty"`
+	Decision     PermissionDecision `json:"decision,omitempty"`
+	Scene        string             `json:"scene,omitempty"`     // scene name or path under frontend/src/scenes, for start and resume
+	Agent        string             `json:"agent,omitempty"`     // agent the session runs on, for start and resume
+	PlanMode     *bool              `json:"plan_mode,omitempty"` // switches plan mode before running the prompt, for start, follow_up and resume
+	Plan         string             `json:"plan,omitempty"`      // plan to execute for approve_plan, the latest plan when empty
+}
+
+// Server→client message types.
+const (
+	ServerMessageSessionCreated = "session_created"
+	ServerMessageSessionResumed = "session_resumed"
+	ServerMessageAgentResponse  = "agent_response"
+	ServerMessageAgentDone      = "agent_done"
+	ServerMessageCancelled      = "cancelled"
+	ServerMessageLimitReached   = "limit_reached"
+	ServerMessageError          = "error"
+
+	ServerMessagePermissionRequest = "permission_request"
+
+	// Live progress of the running generation
+	ServerMessageContentDelta     = "content_delta"
+	ServerMessageThinkingDelta    = "thinking_delta"
+	ServerMessageToolCallStarted  = "tool_call_started"
+	ServerMessageToolCallFinished = "tool_call_finished"
+	ServerMessageToolResult       = "tool_result"
+	ServerMessageCompaction       = "compaction"
+	ServerMessageFallback         = "fallback"
+)
+
+type WebSocketMessage struct {
+	Type       string             `json:"type"`
+	SessionID  string             `json:"session_id,omitempty"`
+	MessageID  string             `json:"message_id,omitempty"`
+	Title      string             `json:"title,omitempty"`
+	Scene      string             `json:"scene,omitempty"`
+	Agent      string             `json:"agent,omitempty"`
+	PlanMode   bool               `json:"plan_mode,omitempty"`
+	Content    string             `json:"content,omitempty"`
+	ToolCall   *ToolCallPayload   `json:"tool_call,omitempty"`
+	ToolResult *ToolResultPayload `json:"tool_result,omitempty"`
+	Permission *PermissionPayload `json:"permission,omitempty"`
+	Error      string             `json:"error,omitempty"`
+
+	// Set on the progress of a sub-agent, the agent tool call it runs under
+	ParentToolCallID string `json:"parent_tool_call_id,omitempty"`
+}
+
+// ToolCallPayload describes a tool call requested by the model. Input is the
+// raw JSON arguments and may be empty until the call is finished.
+type ToolCallPayload struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Input string `json:"input"`
+}
+
+// ToolResultPayload is the outcome of running a tool call.
+type ToolResultPayload struct {
+	ToolCallID string `json:"tool_call_id"`
+	Name       string `json:"name"`
+	Content    string `json:"content"`
+	Metadata   string `json:"metadata,omitempty"`
+	IsError    bool   `json:"is_error"`
+}
+
+// PermissionPayload describes a tool call waiting for the user's approval.
+type PermissionPayload struct {
+	ID          string `json:"id"`
+	ToolName    string `json:"tool_name"`
+	Description string `json:"description"`
+	Action      string `json:"action"`
+	Path        string `json:"path"`
+	Params      any    `json:"params"`
+}
+
+// parseClientMessage decodes and validates a client message. Messages without
+// a type are treated as the legacy `{prompt}` format: a start when the
+// connection has no session yet and a follow-up otherwise.
+func parseClientMessage(data []byte, hasSession bool) (ClientMessage, error) {
+	var msg ClientMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return ClientMessage{}, fmt.Errorf("invalid message: %w", err)
+	}
+
+	if msg.Type == "" {
+		if hasSession {
+			msg.Type = ClientMessageFollowUp
+		} else {
+			msg.Type = ClientMessageStart
+		}
+	}
+
+	if msg.Scene != "" && (msg.Type == ClientMessageStart || msg.Type == ClientMessageResume) {
+		scenePath, err := resolveScenePath(msg.Scene)
+		if err != nil {
+			return ClientMessage{}, err
+		}
+		msg.Scene = scenePath
+	}
+
+	switch msg.Type {
+	case ClientMessageStart:
+		if msg.Prompt == "" {
+			return ClientMessage{}, fmt.Errorf("prompt is required")
+		}
+	case ClientMessageFollowUp:
+		if msg.Prompt == "" {
+			return ClientMessage{}, fmt.Errorf("prompt is required")
+		}
+		if !hasSession {
+			return ClientMessage{}, fmt.Errorf("no active session, send a start or resume message first")
+		}
+	case ClientMessageResume:
+		if msg.SessionID == "" {
+			return ClientMessage{}, fmt.Errorf("session_id is required")
+		}
+	case ClientMessageCancel:
+		if !hasSession {
+			return ClientMessage{}, fmt.Errorf("no active session to cancel")
+		}
+	case ClientMessageApprovePlan:
+		if !hasSession {
+			return ClientMessage{}, fmt.Errorf("no active session, send a start or resume message first")
+		}
+	case ClientMessagePermission:
+		if msg.PermissionID == "" {
+			return ClientMessage{}, fmt.Errorf("permission_id is required")
+		}
+		switch msg.Decision {
+		case PermissionGrant, PermissionGrantSession, PermissionDeny:
+		default:
+			return ClientMessage{}, fmt.Errorf("invalid decision: %q", msg.Decision)
+		}
+	default:
+		return ClientMessage{}, fmt.Errorf("unknown message type: %s", msg.Type)
+	}
+	return msg, nil
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/opencode-ai/opencode/internal/config"
+	"github.com/opencode-ai/opencode/internal/logging"
+)
+
+const (
+	// scenesDir holds the generated scenes, relative to the working directory.
+	scenesDir = "frontend/src/scenes"
+	// projectFile is the Motion Canvas project the scenes are registered in.
+	projectFile = "frontend/src/project.ts"
+
+	sceneBlockStart = "// opencode:scenes:start"
+	sceneBlockEnd   = "// opencode:scenes:end"
+)
+
+var sceneSegmentPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// resolveScenePath turns a scene name from the client into a .tsx path under
+// scenesDir. Accepted forms are "intro", "chapter1/intro", "intro.tsx" and
+// "frontend/src/scenes/intro.tsx".
+func resolveScenePath(name string) (string, error) {
+	name = strings.TrimSpace(filepath.ToSlash(name))
+	name = strings.TrimPrefix(name, scenesDir+"/")
+	name = strings.TrimSuffix(name, ".tsx")
+	if name == "" {
+		return "", fmt.Errorf("scene name is empty")
+	}
+	if path.IsAbs(name) {
+		return "", fmt.Errorf("scene %q must be relative to %s", name, scenesDir)
+	}
+	for _, segment := range strings.Split(name, "/") {
+		if !sceneSegmentPattern.MatchString(segment) {
+			return "", fmt.Errorf("invalid scene name %q: use letters, digits, '-' and '_' separated by '/'", name)
+		}
+	}
+	return path.Join(scenesDir, name+".tsx"), nil
+}
+
+// defaultScenePath gives every session its own scene when the client does not
+// name one.
+func defaultScenePath(sessionID string) string {
+	id := strings.ReplaceAll(sessionID, "-", "")
+	if len(id) > 8 {
+		id = id[:8]
+	}
+	return path.Join(scenesDir, "scene_"+id+".tsx")
+}
+
+// sceneContext is appended to the coder agent's system prompt for runs of a
+// session, overriding the example.tsx output path of the guidelines.
+func sceneContext(scenePath string) string {
+	return fmt.Sprintf(`# Scene Target
+The output scene file for this session is %s. Write the scene to this file instead of frontend/src/scenes/example.tsx, create it if it does not exist, and run scene_check on it. Do not modify other scenes.`, scenePath)
+}
+
+// sceneRegistry remembers the scene of each session and registers scenes in
+// the Motion Canvas project.
+type sceneRegistry struct {
+	mu     sync.Mutex
+	scenes map[string]string // session ID -> scene path
+}
+
+func newSceneRegistry() *sceneRegistry {
+	return &sceneRegistry{scenes: make(map[string]string)}
+}
+
+func (r *sceneRegistry) set(sessionID, scenePath string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.scenes[sessionID] = scenePath
+}
+
+// get returns the scene of the session, sessions from an earlier server run
+// fall back to their default scene.
+func (r *sceneRegistry) get(sessionID string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if scenePath, ok := r.scenes[sessionID]; ok {
+		return scenePath
+	}
+	return defaultScenePath(sessionID)
+}
+
+// register adds the scene to the generated block of project.ts if the agent
+// wrote it. It reports whether the scene exists.
+func (r *sceneRegistry) register(scenePath string) (bool, error) {
+	root := config.WorkingDirectory()
+	if _, err := os.Stat(filepath.Join(root, scenePath)); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	projectPath := filepath.Join(root, projectFile)
+	content, err := os.ReadFile(projectPath)
+	if err != nil {
+		return true, fmt.Errorf("failed to read %s: %w", projectFile, err)
+	}
+	updated, changed, err := addSceneImport(string(content), scenePath)
+	if err != nil || !changed {
+		return true, err
+	}
+	if err := os.WriteFile(projectPath, []byte(updated), 0o644); err != nil {
+		return true, fmt.Errorf("failed to write %s: %w", projectFile, err)
+	}
+	logging.Info("Registered scene in project", "scene", scenePath)
+	return true, nil
+}
+
+// addSceneImport inserts the loader line of a scene before the end marker of
+// the generated block. example.tsx is loaded by project.ts itself.
+func addSceneImport(project, scenePath string) (string, bool, error) {
+	rel := strings.TrimSuffix(strings.TrimPrefix(scenePath, scenesDir+"/"), ".tsx")
+	if rel == "example" {
+		return project, false, nil
+	}
+	start := strings.Index(project, sceneBlockStart)
+	end := strings.Index(project, sceneBlockEnd)
+	if start < 0 || end < start {
+		return project, false, fmt.Errorf("%s has no %q block", projectFile, sceneBlockStart)
+	}
+
+	line := fmt.Sprintf("generatedScenes.push(await loadScene('%s', () => import('./scenes/%s?scene')));", rel, rel)
+	if strings.Contains(project[start:end], line) {
+		return project, false, nil
+	}
+	// Keep the indentation of the end marker
+	lineStart := strings.LastIndex(project[:end], "\n") + 1
+	indent := project[lineStart:end]
+	return project[:lineStart] + indent + line + "\n" + project[lineStart:], true, nil
+}
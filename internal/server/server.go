@@ -0,0 +1,609 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
+	"github.com/opencode-ai/opencode/internal/app"
+	"github.com/opencode-ai/opencode/internal/config"
+	"github.com/opencode-ai/opencode/internal/llm/agent"
+	"github.com/opencode-ai/opencode/internal/llm/provider"
+	"github.com/opencode-ai/opencode/internal/logging"
+	"github.com/opencode-ai/opencode/internal/message"
+	"github.com/opencode-ai/opencode/internal/permission"
+	"github.com/opencode-ai/opencode/internal/pubsub"
+)
+
+const sceneSessionTitle = "Motion Canvas Scene Generation"
+
+// shutdownTimeout bounds how long Serve waits for in-flight requests.
+const shutdownTimeout = 10 * time.Second
+
+// Helper function to truncate strings for logging
+func truncateString(s string, maxLen int) string {
+	if len(s) <= maxLen {
+		return s
+	}
+	return s[:maxLen] + "..."
+}
+
+// ChatServer exposes an app.App to the Motion Canvas frontend over HTTP and
+// WebSocket.
+type ChatServer struct {
+	// ctx bounds generations; they outlive the connection that started them
+	// unless the socket is dropped abnormally.
+	ctx      context.Context
+	app      *app.App
+	cfg      config.ServerConfig
+	upgrader websocket.Upgrader
+
+	// autoApprove skips interactive permission prompts for every session.
+	autoApprove bool
+
+	scenes *sceneRegistry
+	agents *agentRegistry
+
+	// conns are the open WebSocket connections
+	connsMu sync.RWMutex
+	conns   map[*connection]struct{}
+}
+
+// New creates a ChatServer. Generations are cancelled when ctx is done.
+func New(ctx context.Context, app *app.App, cfg config.ServerConfig, autoApprove bool) *ChatServer {
+	return &ChatServer{
+		ctx:         ctx,
+		app:         app,
+		cfg:         cfg,
+		upgrader:    newUpgrader(cfg.AllowedOrigins),
+		autoApprove: autoApprove,
+		scenes:      newSceneRegistry(),
+		agents:      newAgentRegistry(),
+		conns:       make(map[*connection]struct{}),
+	}
+}
+
+// Serve listens on the configured address until ctx is done, then shuts the
+// HTTP server down gracefully.
+func (s *ChatServer) Serve(ctx context.Context) error {
+	if s.autoApprove {
+		logging.Warn("Auto-approving all tool permission requests")
+	}
+	if s.cfg.AuthToken == "" {
+		logging.Warn("No server.authToken configured, /ws is open to every allowed origin")
+	}
+
+	go s.denyUnattendedPermissions(ctx)
+
+	srv := &http.Server{
+		Addr:    s.cfg.Address,
+		Handler: s.routes(s.cfg),
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		logging.Info("WebSocket server starting", "address", s.cfg.Address, "tls", s.cfg.TLSCertFile != "", "allowed_origins", s.cfg.AllowedOrigins)
+		var err error
+		if s.cfg.TLSCertFile != "" {
+			err = srv.ListenAndServeTLS(s.cfg.TLSCertFile, s.cfg.TLSKeyFile)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		errCh <- err
+	}()
+
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("server failed: %w", err)
+	case <-ctx.Done():
+	}
+
+	logging.Info("Shutting down WebSocket server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	// Hijacked WebSocket connections are not tracked by Shutdown, they end
+	// with the generations bound to s.ctx.
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to shut down server: %w", err)
+	}
+	return nil
+}
+
+// routes builds the HTTP handler. Origins are checked on every request, the
+// auth token on everything but the root health check.
+func (s *ChatServer) routes(serverCfg config.ServerConfig) http.Handler {
+	r := chi.NewRouter()
+	r.Use(requestLogger(os.Stdout))
+	r.Use(corsMiddleware(serverCfg.AllowedOrigins))
+
+	logging.Debug("Registering root endpoint")
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		logging.Debug("Root endpoint accessed", "remote_addr", r.RemoteAddr)
+		w.Write([]byte("Motion Canvas AI Backend - WebSocket Ready"))
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(authMiddleware(serverCfg.AuthToken))
+
+		logging.Debug("Registering WebSocket endpoint")
+		r.Get("/ws", s.handleWebSocket)
+
+		logging.Debug("Registering REST API endpoints")
+		r.Route("/api", s.apiRoutes)
+	})
+	return r
+}
+
+// connection holds the state of a single /ws client. A connection is bound to
+// at most one session at a time; follow-ups and cancels target that session.
+type connection struct {
+	server *ChatServer
+	conn   *websocket.Conn
+	ctx    context.Context
+
+	// gorilla/websocket supports a single concurrent writer only
+	writeMu sync.Mutex
+
+	mu        sync.RWMutex
+	sessionID string
+	running   map[string]struct{} // sessions with a generation started here
+	closed    bool
+
+	pendingPermissions map[string]permission.PermissionRequest
+}
+
+func (s *ChatServer) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	logging.Debug("WebSocket endpoint accessed", "remote_addr", r.RemoteAddr, "user_agent", r.UserAgent())
+
+	// Upgrade to WebSocket
+	logging.Info("Attempting to upgrade connection to WebSocket", "remote_addr", r.RemoteAddr)
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logging.Error("Failed to upgrade to WebSocket", "error", err, "remote_addr", r.RemoteAddr)
+		return
+	}
+	defer func() {
+		logging.Debug("Closing WebSocket connection", "remote_addr", r.RemoteAddr)
+		conn.Close()
+	}()
+
+	logging.Debug("WebSocket connection established successfully", "remote_addr", r.RemoteAddr)
+	s.handleWebSocketConnection(conn)
+}
+
+func (s *ChatServer) handleWebSocketConnection(conn *websocket.Conn) {
+	logging.Debug("Starting WebSocket connection handler")
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &connection{
+		server:  s,
+		conn:    conn,
+		ctx:     ctx,
+		running: make(map[string]struct{}),
+
+		pendingPermissions: make(map[string]permission.PermissionRequest),
+	}
+	s.attach(c)
+	defer func() {
+		logging.Info("Cancelling WebSocket connection context")
+		cancel()
+	}()
+
+	for _, a := range s.app.Agents {
+		go c.forwardAgentEvents(a)
+	}
+	go c.forwardMessageEvents()
+	go c.forwardPermissionRequests()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				// The client may resume its sessions later, let them finish
+				logging.Debug("WebSocket closed by client", "session_id", c.currentSession())
+				c.close(false)
+			} else {
+				logging.Warn("WebSocket closed abnormally, cancelling generations", "error", err, "session_id", c.currentSession())
+				c.close(true)
+			}
+			return
+		}
+
+		msg, err := parseClientMessage(data, c.currentSession() != "")
+		if err != nil {
+			logging.Warn("Invalid message received from WebSocket", "error", err)
+			c.sendError(err.Error())
+			continue
+		}
+		logging.Debug("Received client message", "type", msg.Type, "session_id", msg.SessionID, "prompt_length", len(msg.Prompt))
+
+		switch msg.Type {
+		case ClientMessageStart:
+			c.handleStart(msg)
+		case ClientMessageFollowUp:
+			c.setPlanMode(c.currentSession(), msg.PlanMode)
+			c.runPrompt(c.currentSession(), msg.Prompt)
+		case ClientMessageResume:
+			c.handleResume(msg)
+		case ClientMessageCancel:
+			c.handleCancel()
+		case ClientMessagePermission:
+			c.handlePermissionResponse(msg)
+		case ClientMessageApprovePlan:
+			c.handleApprovePlan(msg)
+		}
+	}
+}
+
+func (c *connection) currentSession() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.sessionID
+}
+
+func (c *connection) bindSession(sessionID string) {
+	c.mu.Lock()
+	c.sessionID = sessionID
+	c.mu.Unlock()
+
+	if c.server.autoApprove {
+		c.server.app.Permissions.AutoApproveSession(sessionID)
+	}
+}
+
+// ownsSession reports whether events of the session should reach this
+// connection: the bound session, any generation it started and the sessions
+// of their sub-agents.
+func (c *connection) ownsSession(sessionID string) bool {
+	if c.streamsSession(sessionID) {
+		return true
+	}
+	sess, err := c.server.app.Sessions.Get(c.ctx, sessionID)
+	return err == nil && sess.ParentSessionID != "" && c.ownsSession(sess.ParentSessionID)
+}
+
+// streamsSession reports whether the progress of the session is streamed to
+// this connection: the bound session and the generations started here, which
+// keep streaming after the connection moved to another session. The messages
+// of sub-agents arrive as agent events of their parent session.
+func (c *connection) streamsSession(sessionID string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, running := c.running[sessionID]
+	return running || (sessionID != "" && sessionID == c.sessionID)
+}
+
+func (c *connection) handleStart(msg ClientMessage) {
+	agentName := config.AgentName(msg.Agent)
+	if agentName == "" {
+		agentName = config.AgentCoder
+	}
+	if _, err := c.server.app.Agent(agentName); err != nil {
+		c.sendError(err.Error())
+		return
+	}
+
+	logging.Debug("Creating new session for Motion Canvas Scene Generation", "agent", agentName)
+	session, err := c.server.app.Sessions.Create(c.ctx, sceneSessionTitle)
+	if err != nil {
+		logging.Error("Failed to create session", "error", err)
+		c.sendError("Failed to create session: " + err.Error())
+		return
+	}
+	c.bindSession(session.ID)
+	c.server.agents.set(session.ID, agentName)
+
+	scenePath := msg.Scene
+	if scenePath == "" {
+		scenePath = defaultScenePath(session.ID)
+	}
+	c.server.scenes.set(session.ID, scenePath)
+	c.setPlanMode(session.ID, msg.PlanMode)
+
+	c.send(WebSocketMessage{
+		Type:      ServerMessageSessionCreated,
+		SessionID: session.ID,
+		Title:     session.Title,
+		Scene:     scenePath,
+		Agent:     string(agentName),
+		PlanMode:  c.server.app.PlanMode(session.ID),
+	})
+
+	c.runPrompt(session.ID, msg.Prompt)
+}
+
+func (c *connection) handleResume(msg ClientMessage) {
+	if msg.Agent != "" {
+		if _, err := c.server.app.Agent(config.AgentName(msg.Agent)); err != nil {
+			c.sendError(err.Error())
+			return
+		}
+	}
+	session, err := c.server.app.Sessions.Get(c.ctx, msg.SessionID)
+	if err != nil {
+		logging.Warn("Failed to resume session", "error", err, "session_id", msg.SessionID)
+		c.sendError("Session not found: " + msg.SessionID)
+		return
+	}
+	c.bindSession(session.ID)
+	if msg.Scene != "" {
+		c.server.scenes.set(session.ID, msg.Scene)
+	}
+	if msg.Agent != "" {
+		c.server.agents.set(session.ID, config.AgentName(msg.Agent))
+	}
+	c.setPlanMode(session.ID, msg.PlanMode)
+
+	c.send(WebSocketMessage{
+		Type:      ServerMessageSessionResumed,
+		SessionID: session.ID,
+		Title:     session.Title,
+		Scene:     c.server.scenes.get(session.ID),
+		Agent:     string(c.server.agents.get(session.ID)),
+		PlanMode:  c.server.app.PlanMode(session.ID),
+	})
+
+	if msg.Prompt != "" {
+		c.runPrompt(session.ID, msg.Prompt)
+	}
+}
+
+// setPlanMode switches plan mode of the session when the client asked to.
+func (c *connection) setPlanMode(sessionID string, planMode *bool) {
+	if planMode != nil {
+		c.server.app.SetPlanMode(sessionID, *planMode)
+	}
+}
+
+// handleApprovePlan leaves plan mode and executes the plan of the bound
+// session.
+func (c *connection) handleApprovePlan(msg ClientMessage) {
+	sessionID := c.currentSession()
+	c.startAgent(sessionID, func(ctx context.Context, runAgent agent.Service) (<-chan agent.AgentEvent, error) {
+		c.server.app.SetPlanMode(sessionID, false)
+		return runAgent.ExecutePlan(ctx, sessionID, msg.Plan)
+	})
+}
+
+// handleCancel stops the generation of the bound session. The "cancelled"
+// reply is sent by runPrompt once the agent has stopped.
+func (c *connection) handleCancel() {
+	sessionID := c.currentSession()
+	if !c.server.app.IsSessionBusy(sessionID) {
+		c.sendError("No generation is running for this session")
+		return
+	}
+	logging.Info("Cancelling generation", "session_id", sessionID)
+	c.server.app.Cancel(sessionID)
+}
+
+// close marks the connection as closed so pending results are dropped, and
+// optionally cancels the generations it started.
+func (c *connection) close(cancelRuns bool) {
+	c.mu.Lock()
+	c.closed = true
+	running := make([]string, 0, len(c.running))
+	for sessionID := range c.running {
+		running = append(running, sessionID)
+	}
+	c.mu.Unlock()
+
+	c.server.detach(c)
+	c.denyPendingPermissions()
+	if !cancelRuns {
+		return
+	}
+	for _, sessionID := range running {
+		logging.Info("Cancelling abandoned generation", "session_id", sessionID)
+		c.server.app.Cancel(sessionID)
+	}
+}
+
+func (c *connection) setRunning(sessionID string, running bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if running {
+		c.running[sessionID] = struct{}{}
+	} else {
+		delete(c.running, sessionID)
+	}
+}
+
+// runPrompt runs the prompt in the session.
+func (c *connection) runPrompt(sessionID, prompt string) {
+	logging.Debug("Running prompt", "session_id", sessionID, "prompt", truncateString(prompt, 200))
+	c.startAgent(sessionID, func(ctx context.Context, runAgent agent.Service) (<-chan agent.AgentEvent, error) {
+		return runAgent.Run(ctx, sessionID, prompt)
+	})
+}
+
+// startAgent starts the session's agent on the session and reports the final
+// result asynchronously so the connection keeps reading client messages
+// meanwhile.
+func (c *connection) startAgent(sessionID string, start func(ctx context.Context, runAgent agent.Service) (<-chan agent.AgentEvent, error)) {
+	scenePath := c.server.scenes.get(sessionID)
+	agentName := c.server.agents.get(sessionID)
+	logging.Debug("Starting agent for session", "session_id", sessionID, "agent", agentName, "scene", scenePath)
+	runAgent, err := c.server.app.Agent(agentName)
+	if err != nil {
+		c.sendError(err.Error())
+		return
+	}
+	if c.server.app.IsSessionBusy(sessionID) && !runAgent.IsSessionBusy(sessionID) {
+		c.sendError("Another agent is working on this session")
+		return
+	}
+	ctx := provider.WithSystemContext(c.server.ctx, sceneContext(scenePath))
+	planning := runAgent.PlanMode(sessionID)
+	done, err := start(ctx, runAgent)
+	if err != nil {
+		logging.Error("Failed to start agent", "error", err, "session_id", sessionID, "agent", agentName)
+		c.sendError("Failed to start agent: " + err.Error())
+		return
+	}
+	c.setRunning(sessionID, true)
+
+	go func() {
+		defer logging.RecoverPanic("websocket-run", nil)
+
+		result := <-done
+		c.setRunning(sessionID, false)
+		logging.Debug("Agent processing completed", "session_id", sessionID, "has_error", result.Error != nil)
+		if errors.Is(result.Error, agent.ErrRequestCancelled) || errors.Is(result.Error, context.Canceled) {
+			c.sendCancelled(sessionID)
+			return
+		}
+		if result.Type == agent.AgentEventTypeLimitReached {
+			logging.Warn("Agent stopped by a limit", "error", result.Error, "session_id", sessionID)
+			c.send(WebSocketMessage{
+				Type:      ServerMessageLimitReached,
+				SessionID: sessionID,
+				MessageID: result.Message.ID,
+				Content:   result.Message.Content().String(),
+				Error:     result.Error.Error(),
+			})
+			return
+		}
+		if result.Error != nil {
+			logging.Error("Agent completed with error", "error", result.Error, "session_id", sessionID)
+			c.send(WebSocketMessage{
+				Type:      ServerMessageError,
+				SessionID: sessionID,
+				Error:     "Agent error: " + result.Error.Error(),
+			})
+			return
+		}
+		c.send(WebSocketMessage{
+			Type:      ServerMessageAgentResponse,
+			SessionID: sessionID,
+			Content:   result.Message.Content().String(),
+		})
+
+		// After a planning turn the client approves the plan
+		doneMsg := WebSocketMessage{
+			Type:      ServerMessageAgentDone,
+			SessionID: sessionID,
+			PlanMode:  planning,
+		}
+		written, err := c.server.scenes.register(scenePath)
+		if err != nil {
+			logging.Error("Failed to register scene", "error", err, "scene", scenePath)
+		}
+		if written {
+			doneMsg.Scene = scenePath
+		}
+		c.send(doneMsg)
+	}()
+}
+
+// forwardAgentEvents relays the agent's events of the streamed sessions.
+func (c *connection) forwardAgentEvents(a agent.Service) {
+	defer logging.RecoverPanic("websocket-agent-events", nil)
+
+	// Messages of sub-agents are streamed like the session's own
+	subAgents := newMessageStream()
+	eventChan := a.Subscribe(c.ctx)
+	for event := range eventChan {
+		if !c.streamsSession(event.Payload.SessionID) {
+			continue
+		}
+		if event.Payload.Type == agent.AgentEventTypeSubAgent {
+			msgEvent := pubsub.Event[message.Message]{Type: event.Type, Payload: event.Payload.Message}
+			for _, msg := range subAgents.diff(msgEvent) {
+				msg.ParentToolCallID = event.Payload.ToolCallID
+				c.send(msg)
+			}
+			continue
+		}
+		c.handleAgentEvent(event.Payload)
+	}
+}
+
+func (c *connection) handleAgentEvent(event agent.AgentEvent) {
+	logging.Debug("Handling agent event", "event_type", event.Type, "session_id", event.SessionID)
+	switch event.Type {
+	case agent.AgentEventTypeResponse:
+		c.send(WebSocketMessage{
+			Type:      ServerMessageAgentResponse,
+			SessionID: event.SessionID,
+			Content:   event.Message.Content().String(),
+		})
+	case agent.AgentEventTypeSummarize:
+		// The history is being compacted, the generation continues afterwards
+		c.send(WebSocketMessage{
+			Type:      ServerMessageCompaction,
+			SessionID: event.SessionID,
+			Content:   event.Progress,
+		})
+	case agent.AgentEventTypeFallback:
+		c.send(WebSocketMessage{
+			Type:      ServerMessageFallback,
+			SessionID: event.SessionID,
+			Content:   event.Progress,
+			Error:     event.Error.Error(),
+		})
+	case agent.AgentEventTypeError:
+		logging.Error("Processing agent error event", "error", event.Error, "session_id", event.SessionID)
+		c.sendError(event.Error.Error())
+	default:
+		logging.Warn("Unknown agent event type", "event_type", event.Type, "session_id", event.SessionID)
+	}
+}
+
+// sendCancelled reports a cancelled generation along with whatever the
+// assistant had produced before it was stopped.
+func (c *connection) sendCancelled(sessionID string) {
+	msg := WebSocketMessage{
+		Type:      ServerMessageCancelled,
+		SessionID: sessionID,
+	}
+	msgs, err := c.server.app.Messages.List(context.Background(), sessionID)
+	if err != nil {
+		logging.Error("Failed to load partial message", "error", err, "session_id", sessionID)
+	}
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].Role == message.Assistant {
+			msg.MessageID = msgs[i].ID
+			msg.Content = msgs[i].Content().String()
+			break
+		}
+		if msgs[i].Role == message.User {
+			// Cancelled before the assistant answered
+			break
+		}
+	}
+	c.send(msg)
+}
+
+func (c *connection) send(msg WebSocketMessage) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.mu.RLock()
+	closed := c.closed
+	c.mu.RUnlock()
+	if closed {
+		logging.Debug("Dropping WebSocket message for closed connection", "type", msg.Type, "session_id", msg.SessionID)
+		return
+	}
+
+	logging.Debug("Sending WebSocket message", "type", msg.Type, "session_id", msg.SessionID, "content_length", len(msg.Content))
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if err := c.conn.WriteJSON(msg); err != nil {
+		logging.Error("Failed to send WebSocket message", "error", err, "message_type", msg.Type, "session_id", msg.SessionID)
+	}
+}
+
+func (c *connection) sendError(errorMsg string) {
+	logging.Warn("Sending error message to client", "error", errorMsg)
+	c.send(WebSocketMessage{
+		Type:      ServerMessageError,
+		SessionID: c.currentSession(),
+		Error:     errorMsg,
+	})
+}
@@ -0,0 +1,610 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/gorilla/websocket"
+	"github.com/opencode-ai/opencode/internal/app"
+	"github.com/opencode-ai/opencode/internal/config"
+	"github.com/opencode-ai/opencode/internal/db"
+	"github.com/opencode-ai/opencode/internal/llm/agent"
+	"github.com/opencode-ai/opencode/internal/logging"
+	"github.com/opencode-ai/opencode/internal/message"
+	"github.com/opencode-ai/opencode/internal/permission"
+	"github.com/opencode-ai/opencode/internal/pubsub"
+	"github.com/opencode-ai/opencode/internal/session"
+)
+
+func TestRootEndpoint(t *testing.T) {
+	// Initialize logging for tests
+	logging.InitGlobalLogging("test.log")
+
+	// Create router like in main.go
+	r := chi.NewRouter()
+	r.Use(middleware.Logger)
+	
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Motion Canvas AI Backend - WebSocket Ready"))
+	})
+
+	// Create test request
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	// Serve the request
+	r.ServeHTTP(w, req)
+
+	// Check response
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+
+	expected := "Motion Canvas AI Backend - WebSocket Ready"
+	if w.Body.String() != expected {
+		t.Errorf("Expected '%s', got '%s'", expected, w.Body.String())
+	}
+}
+
+func TestServerAccessControl(t *testing.T) {
+	logging.InitGlobalLogging("test.log")
+
+	s := &ChatServer{}
+	handler := s.routes(config.ServerConfig{
+		AllowedOrigins: []string{"http://localhost:9000"},
+		AuthToken:      "secret",
+	})
+
+	tests := []struct {
+		name           string
+		path           string
+		origin         string
+		authorization  string
+		protocol       string
+		expectedStatus int
+	}{
+		{
+			name:           "Root is public",
+			path:           "/",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Disallowed origin",
+			path:           "/",
+			origin:         "http://evil.example",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Missing token",
+			path:           "/ws",
+			origin:         "http://localhost:9000",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Wrong bearer token",
+			path:           "/ws",
+			authorization:  "Bearer nope",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Token in query reaches the upgrade",
+			path:           "/ws?token=secret",
+			origin:         "http://localhost:9000",
+			expectedStatus: http.StatusBadRequest, // not a WebSocket handshake
+		},
+		{
+			name:           "Token in subprotocol reaches the upgrade",
+			path:           "/ws",
+			origin:         "http://localhost:9000",
+			protocol:       "bearer, secret",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Wrong token in subprotocol",
+			path:           "/ws",
+			origin:         "http://localhost:9000",
+			protocol:       "bearer, nope",
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			if tt.protocol != "" {
+				req.Header.Set("Sec-WebSocket-Protocol", tt.protocol)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestRequestLoggerRedactsToken(t *testing.T) {
+	var logged strings.Builder
+	handler := requestLogger(&logged)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("token"); got != "secret" {
+			t.Errorf("Expected the handler to see the token, got %q", got)
+		}
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/ws?session=s1&token=secret", nil))
+
+	if !strings.Contains(logged.String(), "/ws?session=s1&token=REDACTED") {
+		t.Errorf("Expected the request to be logged with a redacted token, got %q", logged.String())
+	}
+	if strings.Contains(logged.String(), "secret") {
+		t.Errorf("Expected no token in the log, got %q", logged.String())
+	}
+}
+
+func TestParseClientMessage(t *testing.T) {
+	tests := []struct {
+		name         string
+		data         string
+		hasSession   bool
+		expectedType ClientMessageType
+		expectedErr  string
+	}{
+		{
+			name:         "Legacy prompt starts a session",
+			data:         `{"prompt": "Create a Motion Canvas scene"}`,
+			expectedType: ClientMessageStart,
+		},
+		{
+			name:         "Legacy prompt follows up on the active session",
+			data:         `{"prompt": "Make the circle red"}`,
+			hasSession:   true,
+			expectedType: ClientMessageFollowUp,
+		},
+		{
+			name:         "Start with a scene name",
+			data:         `{"type": "start", "prompt": "Draw a graph", "scene": "graphs/bfs"}`,
+			expectedType: ClientMessageStart,
+		},
+		{
+			name:        "Start with a scene outside the scenes directory",
+			data:        `{"type": "start", "prompt": "Draw a graph", "scene": "../project"}`,
+			expectedErr: `invalid scene name "../project": use letters, digits, '-' and '_' separated by '/'`,
+		},
+		{
+			name:         "Resume with session id",
+			data:         `{"type": "resume", "session_id": "abc"}`,
+			expectedType: ClientMessageResume,
+		},
+		{
+			name:         "Cancel on active session",
+			data:         `{"type": "cancel"}`,
+			hasSession:   true,
+			expectedType: ClientMessageCancel,
+		},
+		{
+			name:         "Permission response",
+			data:         `{"type": "permission_response", "permission_id": "p1", "decision": "grant_session"}`,
+			hasSession:   true,
+			expectedType: ClientMessagePermission,
+		},
+		{
+			name:         "Approve plan with an edited plan",
+			data:         `{"type": "approve_plan", "plan": "1. Add a circle"}`,
+			hasSession:   true,
+			expectedType: ClientMessageApprovePlan,
+		},
+		{
+			name:        "Approve plan without session",
+			data:        `{"type": "approve_plan"}`,
+			expectedErr: "no active session, send a start or resume message first",
+		},
+		{
+			name:        "Permission response with invalid decision",
+			data:        `{"type": "permission_response", "permission_id": "p1", "decision": "maybe"}`,
+			expectedErr: `invalid decision: "maybe"`,
+		},
+		{
+			name:        "Empty prompt",
+			data:        `{"prompt": ""}`,
+			expectedErr: "prompt is required",
+		},
+		{
+			name:        "Follow up without session",
+			data:        `{"type": "follow_up", "prompt": "Slow it down"}`,
+			expectedErr: "no active session, send a start or resume message first",
+		},
+		{
+			name:        "Resume without session id",
+			data:        `{"type": "resume"}`,
+			expectedErr: "session_id is required",
+		},
+		{
+			name:        "Unknown type",
+			data:        `{"type": "render"}`,
+			expectedErr: "unknown message type: render",
+		},
+		{
+			name:        "Invalid JSON",
+			data:        `invalid json`,
+			expectedErr: "invalid message: invalid character 'i' looking for beginning of value",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := parseClientMessage([]byte(tt.data), tt.hasSession)
+			if tt.expectedErr != "" {
+				if err == nil || err.Error() != tt.expectedErr {
+					t.Errorf("Expected error '%s', got '%v'", tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if msg.Type != tt.expectedType {
+				t.Errorf("Expected type '%s', got '%s'", tt.expectedType, msg.Type)
+			}
+		})
+	}
+}
+
+func TestWebSocketUpgrade(t *testing.T) {
+	// Initialize logging for tests
+	logging.InitGlobalLogging("test.log")
+
+	// Create test server
+	upgrader := newUpgrader(nil)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("Failed to upgrade: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		// Send a test message
+		msg := WebSocketMessage{
+			Type:    "test",
+			Content: "WebSocket connection successful",
+		}
+		if err := conn.WriteJSON(msg); err != nil {
+			t.Errorf("Failed to write JSON: %v", err)
+		}
+
+		// Read client response
+		var received WebSocketMessage
+		if err := conn.ReadJSON(&received); err != nil {
+			t.Logf("Client disconnected or failed to read: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	// Convert HTTP URL to WebSocket URL
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	// Connect to WebSocket
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect to WebSocket: %v", err)
+	}
+	defer conn.Close()
+
+	// Read test message
+	var msg WebSocketMessage
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("Failed to read JSON: %v", err)
+	}
+
+	if msg.Type != "test" {
+		t.Errorf("Expected type 'test', got '%s'", msg.Type)
+	}
+
+	if msg.Content != "WebSocket connection successful" {
+		t.Errorf("Expected content 'WebSocket connection successful', got '%s'", msg.Content)
+	}
+
+	// Send response
+	response := WebSocketMessage{
+		Type:    "client_response",
+		Content: "Received",
+	}
+	if err := conn.WriteJSON(response); err != nil {
+		t.Errorf("Failed to write JSON response: %v", err)
+	}
+}
+
+func TestDenyUnattendedPermissions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	workDir := t.TempDir()
+	_, err := config.Load(workDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The config is loaded once per process, point it at this test's dirs
+	config.Get().WorkingDir = workDir
+	config.Get().Data.Directory = t.TempDir()
+	conn, err := db.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	s := New(ctx, &app.App{
+		Sessions:    session.NewService(db.New(conn)),
+		Permissions: permission.NewPermissionService(),
+	}, config.ServerConfig{}, false)
+	c := &connection{server: s, ctx: ctx, sessionID: "attached", running: make(map[string]struct{})}
+	s.attach(c)
+	go s.denyUnattendedPermissions(ctx)
+	// Let the watcher subscribe before anything is published
+	time.Sleep(50 * time.Millisecond)
+
+	request := func(sessionID string) <-chan bool {
+		answer := make(chan bool, 1)
+		go func() {
+			answer <- s.app.Permissions.Request(ctx, permission.CreatePermissionRequest{
+				SessionID: sessionID,
+				ToolName:  "bash",
+				Action:    "execute",
+				Path:      "/project/src",
+			})
+		}()
+		return answer
+	}
+
+	select {
+	case granted := <-request("closed"):
+		if granted {
+			t.Error("a request without a client should be denied")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the request of a session without a client kept waiting")
+	}
+
+	attached := request("attached")
+	select {
+	case <-attached:
+		t.Fatal("the request of an attached session should wait for its client")
+	case <-time.After(100 * time.Millisecond):
+	}
+	s.detach(c)
+	cancel()
+	if granted := <-attached; granted {
+		t.Error("a cancelled request should be denied")
+	}
+}
+
+// streamingAgent is an agent whose events are published by the test.
+type streamingAgent struct {
+	agent.Service
+	events *pubsub.Broker[agent.AgentEvent]
+}
+
+func (a streamingAgent) Subscribe(ctx context.Context) <-chan pubsub.Event[agent.AgentEvent] {
+	return a.events.Subscribe(ctx)
+}
+
+func TestStreamAfterStartingAnotherSession(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	workDir := t.TempDir()
+	if _, err := config.Load(workDir, false); err != nil {
+		t.Fatal(err)
+	}
+	// The config is loaded once per process, point it at this test's dirs
+	config.Get().WorkingDir = workDir
+	config.Get().Data.Directory = t.TempDir()
+	conn, err := db.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	q := db.New(conn)
+	sessions := session.NewService(q)
+	messages := message.NewService(q)
+	s := New(ctx, &app.App{Sessions: sessions, Messages: messages}, config.ServerConfig{}, false)
+	var first, second, other session.Session
+	for _, sess := range []*session.Session{&first, &second, &other} {
+		if *sess, err = sessions.Create(ctx, "test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The connection started a generation in the first session, then a
+	// second session while the first is still streaming
+	events := pubsub.NewBroker[agent.AgentEvent]()
+	connected := make(chan *connection, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := s.upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("Failed to upgrade: %v", err)
+			return
+		}
+		c := &connection{server: s, conn: ws, ctx: ctx, running: make(map[string]struct{})}
+		c.setRunning(first.ID, true)
+		c.bindSession(second.ID)
+		go c.forwardAgentEvents(streamingAgent{events: events})
+		go c.forwardMessageEvents()
+		connected <- c
+	}))
+	defer server.Close()
+	client, _, err := websocket.DefaultDialer.DialContext(ctx, "ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Failed to connect to WebSocket: %v", err)
+	}
+	defer client.Close()
+	<-connected
+	// Let the forwarders subscribe before anything is published
+	time.Sleep(50 * time.Millisecond)
+
+	for _, sessionID := range []string{other.ID, first.ID} {
+		events.Publish(pubsub.CreatedEvent, agent.AgentEvent{Type: agent.AgentEventTypeSummarize, SessionID: sessionID, Progress: "Compacting conversation..."})
+		if _, err := messages.Create(ctx, sessionID, message.CreateMessageParams{
+			Role:  message.Assistant,
+			Parts: []message.ContentPart{message.TextContent{Text: "Drawing the circle."}},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	received := map[string]bool{}
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	for !received[ServerMessageCompaction] || !received[ServerMessageContentDelta] {
+		var msg WebSocketMessage
+		if err := client.ReadJSON(&msg); err != nil {
+			t.Fatalf("The first session stopped streaming, got %v: %v", received, err)
+		}
+		if msg.SessionID != first.ID {
+			t.Errorf("Expected only events of the first session, got %s of %s", msg.Type, msg.SessionID)
+		}
+		received[msg.Type] = true
+	}
+}
+
+func TestMessageStreamDiff(t *testing.T) {
+	stream := newMessageStream()
+	msg := message.Message{ID: "m1", SessionID: "s1", Role: message.Assistant}
+
+	if events := stream.diff(pubsub.Event[message.Message]{Type: pubsub.CreatedEvent, Payload: msg}); len(events) != 0 {
+		t.Fatalf("Expected no events for an empty message, got %d", len(events))
+	}
+
+	msg.AppendReasoningContent("Planning")
+	msg.AppendContent("Hello")
+	events := stream.diff(pubsub.Event[message.Message]{Type: pubsub.UpdatedEvent, Payload: msg})
+	if len(events) != 2 || events[0].Type != ServerMessageThinkingDelta || events[1].Content != "Hello" {
+		t.Fatalf("Unexpected events: %+v", events)
+	}
+
+	msg.AppendContent(" world")
+	msg.AddToolCall(message.ToolCall{ID: "t1", Name: "view"})
+	events = stream.diff(pubsub.Event[message.Message]{Type: pubsub.UpdatedEvent, Payload: msg})
+	if len(events) != 2 || events[0].Content != " world" || events[1].Type != ServerMessageToolCallStarted {
+		t.Fatalf("Unexpected events: %+v", events)
+	}
+
+	msg.SetToolCalls([]message.ToolCall{{ID: "t1", Name: "view", Input: `{"file_path":"a.tsx"}`, Finished: true}})
+	msg.AddFinish(message.FinishReasonToolUse)
+	events = stream.diff(pubsub.Event[message.Message]{Type: pubsub.UpdatedEvent, Payload: msg})
+	if len(events) != 1 || events[0].Type != ServerMessageToolCallFinished || events[0].ToolCall.Input != `{"file_path":"a.tsx"}` {
+		t.Fatalf("Unexpected events: %+v", events)
+	}
+
+	// A finished message is not streamed again
+	if events := stream.diff(pubsub.Event[message.Message]{Type: pubsub.UpdatedEvent, Payload: msg}); len(events) != 0 {
+		t.Fatalf("Expected no events after finish, got %+v", events)
+	}
+
+	toolMsg := message.Message{
+		ID:        "m2",
+		SessionID: "s1",
+		Role:      message.Tool,
+		Parts:     []message.ContentPart{message.ToolResult{ToolCallID: "t1", Content: "ok"}},
+	}
+	events = stream.diff(pubsub.Event[message.Message]{Type: pubsub.CreatedEvent, Payload: toolMsg})
+	if len(events) != 1 || events[0].ToolResult.Name != "view" || events[0].ToolResult.Content != "ok" {
+		t.Fatalf("Unexpected events: %+v", events)
+	}
+}
+
+func TestToMessagePayload(t *testing.T) {
+	msg := message.Message{
+		ID:        "m1",
+		SessionID: "s1",
+		Role:      message.Assistant,
+		Parts: []message.ContentPart{
+			message.TextContent{Text: "hello"},
+			message.BinaryContent{Path: "scene.png", MIMEType: "image/png", Data: []byte{1, 2, 3}},
+			message.ToolCall{ID: "call-1", Name: "view", Finished: true},
+		},
+	}
+
+	payload := toMessagePayload(msg)
+	if payload.Role != "assistant" || len(payload.Parts) != 3 {
+		t.Fatalf("unexpected payload: %+v", payload)
+	}
+	wantTypes := []string{"text", "binary", "tool_call"}
+	for i, want := range wantTypes {
+		if payload.Parts[i].Type != want {
+			t.Errorf("part %d: expected type %q, got %q", i, want, payload.Parts[i].Type)
+		}
+	}
+	if bin, ok := payload.Parts[1].Data.(binaryPart); !ok || bin.Path != "scene.png" {
+		t.Errorf("expected binary part without data, got %#v", payload.Parts[1].Data)
+	}
+}
+
+func TestResolveScenePath(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "intro", want: "frontend/src/scenes/intro.tsx"},
+		{name: "intro.tsx", want: "frontend/src/scenes/intro.tsx"},
+		{name: "chapter_1/intro-2", want: "frontend/src/scenes/chapter_1/intro-2.tsx"},
+		{name: "frontend/src/scenes/intro.tsx", want: "frontend/src/scenes/intro.tsx"},
+		{name: "", wantErr: true},
+		{name: "../project", wantErr: true},
+		{name: "a/../../b", wantErr: true},
+		{name: "/etc/passwd", wantErr: true},
+		{name: "my scene", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveScenePath(tt.name)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestAddSceneImport(t *testing.T) {
+	project := "const generatedScenes = [];\n" + sceneBlockStart + "\n" + sceneBlockEnd + "\n"
+
+	updated, changed, err := addSceneImport(project, "frontend/src/scenes/chapter1/intro.tsx")
+	if err != nil || !changed {
+		t.Fatalf("expected the scene to be added, changed=%v err=%v", changed, err)
+	}
+	line := "generatedScenes.push(await loadScene('chapter1/intro', () => import('./scenes/chapter1/intro?scene')));"
+	want := "const generatedScenes = [];\n" + sceneBlockStart + "\n" + line + "\n" + sceneBlockEnd + "\n"
+	if updated != want {
+		t.Errorf("unexpected project:\n%s", updated)
+	}
+
+	if _, changed, _ := addSceneImport(updated, "frontend/src/scenes/chapter1/intro.tsx"); changed {
+		t.Error("expected registering the same scene twice to be a no-op")
+	}
+	if _, changed, _ := addSceneImport(project, "frontend/src/scenes/example.tsx"); changed {
+		t.Error("expected example.tsx to be left to project.ts")
+	}
+	if _, _, err := addSceneImport("export default {}", "frontend/src/scenes/intro.tsx"); err == nil {
+		t.Error("expected an error without the scene markers")
+	}
+}
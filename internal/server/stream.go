@@ -0,0 +1,161 @@
+package server
+
+import (
+	"github.com/opencode-ai/opencode/internal/logging"
+	"github.com/opencode-ai/opencode/internal/message"
+	"github.com/opencode-ai/opencode/internal/pubsub"
+)
+
+// messageProgress remembers how much of an assistant message has already been
+// sent to the client.
+type messageProgress struct {
+	contentLen   int
+	reasoningLen int
+	toolCalls    map[string]bool // tool call ID -> finished
+}
+
+// messageStream turns message.Service snapshots into incremental client
+// events. Every update carries the full message, so a dropped pubsub event
+// only delays a delta instead of losing it.
+type messageStream struct {
+	progress  map[string]*messageProgress
+	toolNames map[string]string
+}
+
+func newMessageStream() *messageStream {
+	return &messageStream{
+		progress:  make(map[string]*messageProgress),
+		toolNames: make(map[string]string),
+	}
+}
+
+// diff returns the client events produced by a message event.
+func (m *messageStream) diff(event pubsub.Event[message.Message]) []WebSocketMessage {
+	msg := event.Payload
+	switch msg.Role {
+	case message.Assistant:
+		return m.diffAssistant(event.Type, msg)
+	case message.Tool:
+		if event.Type != pubsub.CreatedEvent {
+			return nil
+		}
+		return m.toolResults(msg)
+	}
+	return nil
+}
+
+func (m *messageStream) diffAssistant(eventType pubsub.EventType, msg message.Message) []WebSocketMessage {
+	if eventType == pubsub.DeletedEvent {
+		delete(m.progress, msg.ID)
+		return nil
+	}
+
+	progress, ok := m.progress[msg.ID]
+	if !ok {
+		// Finished messages we never tracked belong to an earlier turn, e.g. a
+		// cancelled message being finalized again.
+		if eventType != pubsub.CreatedEvent && msg.IsFinished() {
+			return nil
+		}
+		progress = &messageProgress{toolCalls: make(map[string]bool)}
+		m.progress[msg.ID] = progress
+	}
+
+	var events []WebSocketMessage
+
+	if thinking := msg.ReasoningContent().Thinking; len(thinking) > progress.reasoningLen {
+		events = append(events, WebSocketMessage{
+			Type:      ServerMessageThinkingDelta,
+			SessionID: msg.SessionID,
+			MessageID: msg.ID,
+			Content:   thinking[progress.reasoningLen:],
+		})
+		progress.reasoningLen = len(thinking)
+	}
+
+	if text := msg.Content().Text; len(text) > progress.contentLen {
+		events = append(events, WebSocketMessage{
+			Type:      ServerMessageContentDelta,
+			SessionID: msg.SessionID,
+			MessageID: msg.ID,
+			Content:   text[progress.contentLen:],
+		})
+		progress.contentLen = len(text)
+	}
+
+	for _, toolCall := range msg.ToolCalls() {
+		finished, seen := progress.toolCalls[toolCall.ID]
+		if !seen {
+			m.toolNames[toolCall.ID] = toolCall.Name
+			events = append(events, WebSocketMessage{
+				Type:      ServerMessageToolCallStarted,
+				SessionID: msg.SessionID,
+				MessageID: msg.ID,
+				ToolCall:  newToolCallPayload(toolCall),
+			})
+		}
+		if toolCall.Finished && !finished {
+			events = append(events, WebSocketMessage{
+				Type:      ServerMessageToolCallFinished,
+				SessionID: msg.SessionID,
+				MessageID: msg.ID,
+				ToolCall:  newToolCallPayload(toolCall),
+			})
+		}
+		progress.toolCalls[toolCall.ID] = toolCall.Finished
+	}
+
+	if msg.IsFinished() {
+		delete(m.progress, msg.ID)
+	}
+	return events
+}
+
+func (m *messageStream) toolResults(msg message.Message) []WebSocketMessage {
+	results := msg.ToolResults()
+	events := make([]WebSocketMessage, 0, len(results))
+	for _, result := range results {
+		name := result.Name
+		if name == "" {
+			name = m.toolNames[result.ToolCallID]
+		}
+		delete(m.toolNames, result.ToolCallID)
+		events = append(events, WebSocketMessage{
+			Type:      ServerMessageToolResult,
+			SessionID: msg.SessionID,
+			MessageID: msg.ID,
+			ToolResult: &ToolResultPayload{
+				ToolCallID: result.ToolCallID,
+				Name:       name,
+				Content:    result.Content,
+				Metadata:   result.Metadata,
+				IsError:    result.IsError,
+			},
+		})
+	}
+	return events
+}
+
+func newToolCallPayload(toolCall message.ToolCall) *ToolCallPayload {
+	return &ToolCallPayload{
+		ID:    toolCall.ID,
+		Name:  toolCall.Name,
+		Input: toolCall.Input,
+	}
+}
+
+// forwardMessageEvents streams progress of the streamed sessions to the client.
+func (c *connection) forwardMessageEvents() {
+	defer logging.RecoverPanic("websocket-message-events", nil)
+
+	stream := newMessageStream()
+	eventChan := c.server.app.Messages.Subscribe(c.ctx)
+	for event := range eventChan {
+		if !c.streamsSession(event.Payload.SessionID) {
+			continue
+		}
+		for _, msg := range stream.diff(event) {
+			c.send(msg)
+		}
+	}
+}
@@ -20,6 +20,11 @@ type Session struct {
 	Cost             float64
 	CreatedAt        int64
 	UpdatedAt        int64
+
+	// Tokens used over the whole session, its sub-agents included, while
+	// PromptTokens and CompletionTokens are the size of the last request
+	TotalPromptTokens     int64
+	TotalCompletionTokens int64
 }
 
 type Service interface {
@@ -29,6 +34,7 @@ type Service interface {
 	CreateTaskSession(ctx context.Context, toolCallID, parentSessionID, title string) (Session, error)
 	Get(ctx context.Context, id string) (Session, error)
 	List(ctx context.Context) ([]Session, error)
+	ListChildren(ctx context.Context, parentSessionID string) ([]Session, error)
 	Save(ctx context.Context, session Session) (Session, error)
 	Delete(ctx context.Context, id string) error
 }
@@ -79,11 +85,22 @@ func (s *service) CreateTitleSession(ctx context.Context, parentSessionID string
 	return session, nil
 }
 
+// Delete removes the session along with the sessions of its sub-agents, the
+// database removes their messages and files.
 func (s *service) Delete(ctx context.Context, id string) error {
 	session, err := s.Get(ctx, id)
 	if err != nil {
 		return err
 	}
+	children, err := s.ListChildren(ctx, session.ID)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err := s.Delete(ctx, child.ID); err != nil {
+			return err
+		}
+	}
 	err = s.q.DeleteSession(ctx, session.ID)
 	if err != nil {
 		return err
@@ -110,7 +127,9 @@ func (s *service) Save(ctx context.Context, session Session) (Session, error) {
 			String: session.SummaryMessageID,
 			Valid:  session.SummaryMessageID != "",
 		},
-		Cost: session.Cost,
+		Cost:                  session.Cost,
+		TotalPromptTokens:     session.TotalPromptTokens,
+		TotalCompletionTokens: session.TotalCompletionTokens,
 	})
 	if err != nil {
 		return Session{}, err
@@ -132,6 +151,20 @@ func (s *service) List(ctx context.Context) ([]Session, error) {
 	return sessions, nil
 }
 
+// ListChildren returns the sessions of the sub-agents the session ran, oldest
+// first.
+func (s *service) ListChildren(ctx context.Context, parentSessionID string) ([]Session, error) {
+	dbSessions, err := s.q.ListChildSessions(ctx, sql.NullString{String: parentSessionID, Valid: true})
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]Session, len(dbSessions))
+	for i, dbSession := range dbSessions {
+		sessions[i] = s.fromDBItem(dbSession)
+	}
+	return sessions, nil
+}
+
 func (s service) fromDBItem(item db.Session) Session {
 	return Session{
 		ID:               item.ID,
@@ -144,6 +177,9 @@ func (s service) fromDBItem(item db.Session) Session {
 		Cost:             item.Cost,
 		CreatedAt:        item.CreatedAt,
 		UpdatedAt:        item.UpdatedAt,
+
+		TotalPromptTokens:     item.TotalPromptTokens,
+		TotalCompletionTokens: item.TotalCompletionTokens,
 	}
 }
 
@@ -0,0 +1,158 @@
+package transcript
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/opencode-ai/opencode/internal/history"
+	"github.com/opencode-ai/opencode/internal/llm/models"
+	"github.com/opencode-ai/opencode/internal/message"
+	"github.com/opencode-ai/opencode/internal/session"
+)
+
+// ReadJSON reads an export written by WriteJSON and decodes the parts of its
+// messages, exports of another version are refused.
+func ReadJSON(r io.Reader) (Export, error) {
+	var export Export
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return Export{}, fmt.Errorf("failed to read the export: %w", err)
+	}
+	if export.Version != Version {
+		return Export{}, fmt.Errorf("unsupported export version %d, this version of opencode reads version %d", export.Version, Version)
+	}
+	if err := decodeSession(&export.Session); err != nil {
+		return Export{}, err
+	}
+	return export, nil
+}
+
+func decodeSession(sess *Session) error {
+	for i := range sess.Messages {
+		msg := &sess.Messages[i]
+		switch message.MessageRole(msg.Role) {
+		case message.User, message.Assistant, message.Tool, message.Summary:
+		default:
+			return fmt.Errorf("message %s has an unknown role: %s", msg.ID, msg.Role)
+		}
+		parts, err := message.UnmarshalParts(msg.Parts)
+		if err != nil {
+			return fmt.Errorf("failed to decode the parts of message %s: %w", msg.ID, err)
+		}
+		msg.parts = parts
+	}
+	for i := range sess.SubSessions {
+		if err := decodeSession(&sess.SubSessions[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Import recreates an exported session with its messages, file versions and
+// sub-agent sessions. Everything gets a new ID, so a session can be imported
+// next to the one it was exported from. Nothing is left behind when the
+// import fails.
+func Import(ctx context.Context, svc Services, export Export) (session.Session, error) {
+	sess, err := svc.Sessions.Create(ctx, export.Session.Title)
+	if err != nil {
+		return session.Session{}, fmt.Errorf("failed to create the session: %w", err)
+	}
+	imported, err := importSession(ctx, svc, export.Session, sess)
+	if err != nil {
+		// The database deletes the messages and files with the sessions. The
+		// import may have failed because ctx is done, rollback regardless
+		if deleteErr := svc.Sessions.Delete(context.Background(), sess.ID); deleteErr != nil {
+			return session.Session{}, fmt.Errorf("%w, and failed to delete the partial import %s: %v", err, sess.ID, deleteErr)
+		}
+		return session.Session{}, err
+	}
+	return imported, nil
+}
+
+func importSession(ctx context.Context, svc Services, exported Session, sess session.Session) (session.Session, error) {
+	// The sessions of sub-agents are named by the tool calls that ran them,
+	// give them their new IDs before the messages are copied
+	subSessionIDs := make(map[string]string, len(exported.SubSessions))
+	var replacements []string
+	for _, sub := range exported.SubSessions {
+		subSessionIDs[sub.ID] = uuid.New().String()
+		replacements = append(replacements, sub.ID, subSessionIDs[sub.ID])
+	}
+	relink := strings.NewReplacer(replacements...)
+
+	messageIDs := make(map[string]string, len(exported.Messages))
+	for _, msg := range exported.Messages {
+		imported, err := svc.Messages.Import(ctx, sess.ID, message.Message{
+			Role:      message.MessageRole(msg.Role),
+			Parts:     relinkParts(msg.parts, relink),
+			Model:     models.ModelID(msg.Model),
+			CreatedAt: msg.CreatedAt,
+			UpdatedAt: msg.UpdatedAt,
+		})
+		if err != nil {
+			return session.Session{}, fmt.Errorf("failed to import message %s: %w", msg.ID, err)
+		}
+		messageIDs[msg.ID] = imported.ID
+	}
+
+	for _, f := range exported.Files {
+		_, err := svc.History.Import(ctx, sess.ID, history.File{
+			Path:      f.Path,
+			Content:   f.Content,
+			Version:   f.Version,
+			CreatedAt: f.CreatedAt,
+			UpdatedAt: f.UpdatedAt,
+		})
+		if err != nil {
+			return session.Session{}, fmt.Errorf("failed to import version %s of %s: %w", f.Version, f.Path, err)
+		}
+	}
+
+	sess.PromptTokens = exported.PromptTokens
+	sess.CompletionTokens = exported.CompletionTokens
+	sess.TotalPromptTokens = exported.TotalPromptTokens
+	sess.TotalCompletionTokens = exported.TotalCompletionTokens
+	sess.Cost = exported.Cost
+	sess.SummaryMessageID = messageIDs[exported.SummaryMessageID]
+	sess, err := svc.Sessions.Save(ctx, sess)
+	if err != nil {
+		return session.Session{}, fmt.Errorf("failed to save the session imported from %s: %w", exported.ID, err)
+	}
+
+	for _, sub := range exported.SubSessions {
+		child, err := svc.Sessions.CreateTaskSession(ctx, subSessionIDs[sub.ID], sess.ID, sub.Title)
+		if err != nil {
+			return session.Session{}, fmt.Errorf("failed to create the sub-agent session %s: %w", sub.ID, err)
+		}
+		if _, err := importSession(ctx, svc, sub, child); err != nil {
+			return session.Session{}, err
+		}
+	}
+	return sess, nil
+}
+
+// relinkParts points tool calls and results at the new IDs of the sub-agent
+// sessions: an agent tool call has the ID of the session it started, and its
+// input and result name the session to send follow-up tasks to.
+func relinkParts(parts []message.ContentPart, relink *strings.Replacer) []message.ContentPart {
+	relinked := make([]message.ContentPart, len(parts))
+	for i, part := range parts {
+		switch p := part.(type) {
+		case message.ToolCall:
+			p.ID = relink.Replace(p.ID)
+			p.Input = relink.Replace(p.Input)
+			part = p
+		case message.ToolResult:
+			p.ToolCallID = relink.Replace(p.ToolCallID)
+			p.Content = relink.Replace(p.Content)
+			p.Metadata = relink.Replace(p.Metadata)
+			part = p
+		}
+		relinked[i] = part
+	}
+	return relinked
+}
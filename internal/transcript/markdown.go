@@ -0,0 +1,124 @@
+package transcript
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/opencode-ai/opencode/internal/message"
+)
+
+// WriteMarkdown writes the session as a Markdown transcript, its sub-agent
+// sessions follow it.
+func WriteMarkdown(w io.Writer, export Export) error {
+	var b strings.Builder
+	writeMarkdownSession(&b, export.Session, 1)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeMarkdownSession(b *strings.Builder, sess Session, level int) {
+	heading := func(level int) string {
+		return strings.Repeat("#", min(level, 6)) + " "
+	}
+
+	title := sess.Title
+	if level > 1 {
+		title = "Sub-agent session: " + title
+	}
+	fmt.Fprintf(b, "%s%s\n\n", heading(level), title)
+	fmt.Fprintf(b, "- Session: `%s`\n", sess.ID)
+	fmt.Fprintf(b, "- Created: %s\n", FormatTime(sess.CreatedAt))
+	fmt.Fprintf(b, "- Updated: %s\n", FormatTime(sess.UpdatedAt))
+	fmt.Fprintf(b, "- Messages: %d\n", len(sess.Messages))
+	fmt.Fprintf(b, "- Tokens: %d prompt, %d completion\n", sess.TotalPromptTokens, sess.TotalCompletionTokens)
+	fmt.Fprintf(b, "- Cost: $%.4f\n", sess.Cost)
+
+	toolNames := make(map[string]string)
+	for _, msg := range sess.Messages {
+		b.WriteString("\n")
+		switch {
+		case msg.ID == sess.SummaryMessageID:
+			fmt.Fprintf(b, "%sSummary\n", heading(level+1))
+		case msg.Model != "":
+			fmt.Fprintf(b, "%s%s (%s)\n", heading(level+1), roleTitle(msg.Role), msg.Model)
+		default:
+			fmt.Fprintf(b, "%s%s\n", heading(level+1), roleTitle(msg.Role))
+		}
+		for _, part := range msg.parts {
+			switch p := part.(type) {
+			case message.ReasoningContent:
+				if p.Thinking != "" {
+					fmt.Fprintf(b, "\n<details>\n<summary>Thinking</summary>\n\n%s\n\n</details>\n", strings.TrimSpace(p.Thinking))
+				}
+			case message.TextContent:
+				if text := strings.TrimSpace(p.Text); text != "" {
+					fmt.Fprintf(b, "\n%s\n", text)
+				}
+			case message.ImageURLContent:
+				fmt.Fprintf(b, "\n![image](%s)\n", p.URL)
+			case message.BinaryContent:
+				fmt.Fprintf(b, "\nAttachment: `%s` (%s)\n", p.Path, p.MIMEType)
+			case message.ToolCall:
+				toolNames[p.ID] = p.Name
+				fmt.Fprintf(b, "\n**Tool call** `%s` (`%s`)\n\n%s", p.Name, p.ID, codeBlock("json", indentJSON(p.Input)))
+			case message.ToolResult:
+				name := p.Name
+				if name == "" {
+					name = toolNames[p.ToolCallID]
+				}
+				label := "Result"
+				if p.IsError {
+					label = "Error"
+				}
+				fmt.Fprintf(b, "\n**%s** of `%s` (`%s`)\n\n%s", label, name, p.ToolCallID, codeBlock("", p.Content))
+			}
+		}
+	}
+
+	for _, sub := range sess.SubSessions {
+		b.WriteString("\n")
+		writeMarkdownSession(b, sub, level+1)
+	}
+}
+
+func roleTitle(role string) string {
+	switch message.MessageRole(role) {
+	case message.User:
+		return "User"
+	case message.Assistant:
+		return "Assistant"
+	case message.Tool:
+		return "Tool"
+	case message.Summary:
+		return "Summary"
+	}
+	return role
+}
+
+// codeBlock fences content with more backticks than it contains in a row.
+func codeBlock(lang, content string) string {
+	longest, run := 0, 0
+	for _, r := range content {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	fence := strings.Repeat("`", max(3, longest+1))
+	return fmt.Sprintf("%s%s\n%s\n%s\n", fence, lang, strings.TrimRight(content, "\n"), fence)
+}
+
+// indentJSON pretty prints a tool input, inputs that aren't valid JSON are
+// kept as they are.
+func indentJSON(input string) string {
+	var out bytes.Buffer
+	if err := json.Indent(&out, []byte(input), "", "  "); err != nil {
+		return input
+	}
+	return out.String()
+}
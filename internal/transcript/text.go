@@ -0,0 +1,89 @@
+package transcript
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/opencode-ai/opencode/internal/message"
+)
+
+// maxResultLines is how much of a tool result WriteText shows.
+const maxResultLines = 10
+
+// WriteText writes the session as a plain text transcript for the terminal.
+// Tool results are cut after a few lines and sub-agent sessions are listed
+// by ID, Markdown exports have them in full.
+func WriteText(w io.Writer, export Export) error {
+	var b strings.Builder
+	sess := export.Session
+	fmt.Fprintf(&b, "%s\n", sess.Title)
+	fmt.Fprintf(&b, "%s · created %s · updated %s · %d messages · %d/%d tokens · $%.4f\n",
+		sess.ID, FormatTime(sess.CreatedAt), FormatTime(sess.UpdatedAt), len(sess.Messages),
+		sess.TotalPromptTokens, sess.TotalCompletionTokens, sess.Cost)
+
+	toolNames := make(map[string]string)
+	for _, msg := range sess.Messages {
+		header := msg.Role
+		if msg.ID == sess.SummaryMessageID {
+			header = "summary"
+		}
+		if msg.Model != "" {
+			header += " (" + msg.Model + ")"
+		}
+		fmt.Fprintf(&b, "\n%s\n", header)
+		for _, part := range msg.parts {
+			switch p := part.(type) {
+			case message.TextContent:
+				if text := strings.TrimSpace(p.Text); text != "" {
+					b.WriteString(indent(text, "  ") + "\n")
+				}
+			case message.ImageURLContent:
+				fmt.Fprintf(&b, "  [image %s]\n", p.URL)
+			case message.BinaryContent:
+				fmt.Fprintf(&b, "  [attachment %s (%s)]\n", p.Path, p.MIMEType)
+			case message.ToolCall:
+				toolNames[p.ID] = p.Name
+				fmt.Fprintf(&b, "  → %s %s\n", p.Name, strings.TrimSpace(p.Input))
+			case message.ToolResult:
+				name := p.Name
+				if name == "" {
+					name = toolNames[p.ToolCallID]
+				}
+				if p.IsError {
+					name += " (error)"
+				}
+				fmt.Fprintf(&b, "  ← %s\n%s\n", name, indent(firstLines(p.Content, maxResultLines), "    "))
+			}
+		}
+	}
+
+	if len(sess.SubSessions) > 0 {
+		b.WriteString("\nsub-agent sessions\n")
+		for _, sub := range sess.SubSessions {
+			fmt.Fprintf(&b, "  %s  %s\n", sub.ID, sub.Title)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func indent(s, prefix string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// firstLines shortens s to its first n lines.
+func firstLines(s string, n int) string {
+	s = strings.TrimRight(s, "\n")
+	lines := strings.Split(s, "\n")
+	if len(lines) <= n {
+		return s
+	}
+	return strings.Join(lines[:n], "\n") + fmt.Sprintf("\n... %d more lines", len(lines)-n)
+}
@@ -0,0 +1,184 @@
+// Package transcript exports sessions, with their messages, file history and
+// sub-agent sessions, for archiving and reading outside of the app, and
+// imports them back from JSON. Sessions are deleted with their transcript.
+package transcript
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/opencode-ai/opencode/internal/history"
+	"github.com/opencode-ai/opencode/internal/message"
+	"github.com/opencode-ai/opencode/internal/session"
+)
+
+// Version of the JSON export format, raised on incompatible changes, the
+// encoding of message parts included.
+const Version = 1
+
+// Services are the services transcripts are read from, imported into and
+// deleted from.
+type Services struct {
+	Sessions session.Service
+	Messages message.Service
+	History  history.Service
+}
+
+// Export is the JSON export of a session.
+type Export struct {
+	Version int     `json:"version"`
+	Session Session `json:"session"`
+}
+
+// Session is an exported session with its sub-agent sessions.
+type Session struct {
+	ID                    string  `json:"id"`
+	Title                 string  `json:"title"`
+	SummaryMessageID      string  `json:"summary_message_id,omitempty"`
+	PromptTokens          int64   `json:"prompt_tokens"`
+	CompletionTokens      int64   `json:"completion_tokens"`
+	TotalPromptTokens     int64   `json:"total_prompt_tokens"`
+	TotalCompletionTokens int64   `json:"total_completion_tokens"`
+	Cost                  float64 `json:"cost"`
+	CreatedAt             int64   `json:"created_at"`
+	UpdatedAt             int64   `json:"updated_at"`
+
+	Messages []Message `json:"messages"`
+	// Every version of the files the session changed
+	Files       []File    `json:"files"`
+	SubSessions []Session `json:"sub_sessions,omitempty"`
+}
+
+// Message is an exported message, its parts are encoded as they are stored:
+// a list of {"type", "data"} objects where type is one of text, reasoning,
+// image_url, binary, tool_call, tool_result and finish.
+type Message struct {
+	ID        string          `json:"id"`
+	Role      string          `json:"role"`
+	Model     string          `json:"model,omitempty"`
+	Parts     json.RawMessage `json:"parts"`
+	CreatedAt int64           `json:"created_at"`
+	UpdatedAt int64           `json:"updated_at"`
+
+	// The decoded parts, for rendering
+	parts []message.ContentPart
+}
+
+// File is an exported file version.
+type File struct {
+	ID        string `json:"id"`
+	Path      string `json:"path"`
+	Content   string `json:"content"`
+	Version   string `json:"version"`
+	CreatedAt int64  `json:"created_at"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+// Load reads the session with its messages, files and sub-agent sessions.
+func Load(ctx context.Context, svc Services, sessionID string) (Export, error) {
+	sess, err := svc.Sessions.Get(ctx, sessionID)
+	if err != nil {
+		return Export{}, fmt.Errorf("session not found: %s", sessionID)
+	}
+	exported, err := loadSession(ctx, svc, sess)
+	if err != nil {
+		return Export{}, err
+	}
+	return Export{Version: Version, Session: exported}, nil
+}
+
+func loadSession(ctx context.Context, svc Services, sess session.Session) (Session, error) {
+	exported := Session{
+		ID:                    sess.ID,
+		Title:                 sess.Title,
+		SummaryMessageID:      sess.SummaryMessageID,
+		PromptTokens:          sess.PromptTokens,
+		CompletionTokens:      sess.CompletionTokens,
+		TotalPromptTokens:     sess.TotalPromptTokens,
+		TotalCompletionTokens: sess.TotalCompletionTokens,
+		Cost:                  sess.Cost,
+		CreatedAt:             sess.CreatedAt,
+		UpdatedAt:             sess.UpdatedAt,
+		Messages:              []Message{},
+		Files:                 []File{},
+	}
+
+	msgs, err := svc.Messages.List(ctx, sess.ID)
+	if err != nil {
+		return Session{}, fmt.Errorf("failed to list messages of session %s: %w", sess.ID, err)
+	}
+	for _, msg := range msgs {
+		parts, err := message.MarshalParts(msg.Parts)
+		if err != nil {
+			return Session{}, fmt.Errorf("failed to encode message %s: %w", msg.ID, err)
+		}
+		exported.Messages = append(exported.Messages, Message{
+			ID:        msg.ID,
+			Role:      string(msg.Role),
+			Model:     string(msg.Model),
+			Parts:     parts,
+			CreatedAt: msg.CreatedAt,
+			UpdatedAt: msg.UpdatedAt,
+			parts:     msg.Parts,
+		})
+	}
+
+	files, err := svc.History.ListBySession(ctx, sess.ID)
+	if err != nil {
+		return Session{}, fmt.Errorf("failed to list files of session %s: %w", sess.ID, err)
+	}
+	for _, f := range files {
+		exported.Files = append(exported.Files, File{
+			ID:        f.ID,
+			Path:      f.Path,
+			Content:   f.Content,
+			Version:   f.Version,
+			CreatedAt: f.CreatedAt,
+			UpdatedAt: f.UpdatedAt,
+		})
+	}
+
+	children, err := svc.Sessions.ListChildren(ctx, sess.ID)
+	if err != nil {
+		return Session{}, fmt.Errorf("failed to list sub-agent sessions of %s: %w", sess.ID, err)
+	}
+	for _, child := range children {
+		sub, err := loadSession(ctx, svc, child)
+		if err != nil {
+			return Session{}, err
+		}
+		exported.SubSessions = append(exported.SubSessions, sub)
+	}
+	return exported, nil
+}
+
+// WriteJSON writes the export as indented JSON.
+func WriteJSON(w io.Writer, export Export) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(export)
+}
+
+// Delete deletes the session with its messages, files and sub-agent sessions.
+func Delete(ctx context.Context, svc Services, sessionID string) error {
+	// The database cascades on delete, going through the services publishes
+	// the deletions to subscribers as well
+	if err := svc.Messages.DeleteSessionMessages(ctx, sessionID); err != nil {
+		return fmt.Errorf("failed to delete the messages of %s: %w", sessionID, err)
+	}
+	if err := svc.History.DeleteSessionFiles(ctx, sessionID); err != nil {
+		return fmt.Errorf("failed to delete the files of %s: %w", sessionID, err)
+	}
+	if err := svc.Sessions.Delete(ctx, sessionID); err != nil {
+		return fmt.Errorf("failed to delete session %s: %w", sessionID, err)
+	}
+	return nil
+}
+
+// FormatTime formats a Unix timestamp of the database in local time.
+func FormatTime(unix int64) string {
+	return time.Unix(unix, 0).Local().Format("2006-01-02 15:04")
+}
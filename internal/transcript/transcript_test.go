@@ -0,0 +1,226 @@
+package transcript
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/opencode-ai/opencode/internal/config"
+	"github.com/opencode-ai/opencode/internal/db"
+	"github.com/opencode-ai/opencode/internal/history"
+	"github.com/opencode-ai/opencode/internal/message"
+	"github.com/opencode-ai/opencode/internal/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newServices(t *testing.T) Services {
+	t.Helper()
+	workDir := t.TempDir()
+	_, err := config.Load(workDir, false)
+	require.NoError(t, err)
+	// The config is loaded once per process, point it at this test's dirs
+	config.Get().WorkingDir = workDir
+	config.Get().Data.Directory = t.TempDir()
+	conn, err := db.Connect()
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	q := db.New(conn)
+	return Services{
+		Sessions: session.NewService(q),
+		Messages: message.NewService(q),
+		History:  history.NewService(q, conn),
+	}
+}
+
+func TestLoad(t *testing.T) {
+	svc := newServices(t)
+	ctx := context.Background()
+
+	sess, err := svc.Sessions.Create(ctx, "Intro scene")
+	require.NoError(t, err)
+	_, err = svc.Messages.Create(ctx, sess.ID, message.CreateMessageParams{
+		Role:  message.User,
+		Parts: []message.ContentPart{message.TextContent{Text: "Fade in the title"}},
+	})
+	require.NoError(t, err)
+	_, err = svc.Messages.Create(ctx, sess.ID, message.CreateMessageParams{
+		Role: message.Assistant,
+		Parts: []message.ContentPart{
+			message.TextContent{Text: "Done"},
+			message.ToolCall{ID: "call-1", Name: "edit", Input: `{"file_path":"intro.tsx"}`},
+		},
+	})
+	require.NoError(t, err)
+	_, err = svc.Messages.Create(ctx, sess.ID, message.CreateMessageParams{
+		Role:  message.Tool,
+		Parts: []message.ContentPart{message.ToolResult{ToolCallID: "call-1", Content: "```\nedited\n```"}},
+	})
+	require.NoError(t, err)
+	_, err = svc.History.Create(ctx, sess.ID, "/project/intro.tsx", "old")
+	require.NoError(t, err)
+	_, err = svc.Sessions.CreateTaskSession(ctx, "call-2", sess.ID, "Search")
+	require.NoError(t, err)
+
+	export, err := Load(ctx, svc, sess.ID)
+	require.NoError(t, err)
+	assert.Equal(t, Version, export.Version)
+	assert.Len(t, export.Session.Messages, 3)
+	assert.Len(t, export.Session.Files, 1)
+	require.Len(t, export.Session.SubSessions, 1)
+	assert.Equal(t, "call-2", export.Session.SubSessions[0].ID)
+
+	var jsonOut bytes.Buffer
+	require.NoError(t, WriteJSON(&jsonOut, export))
+	var decoded Export
+	require.NoError(t, json.Unmarshal(jsonOut.Bytes(), &decoded))
+	assert.JSONEq(t, string(export.Session.Messages[1].Parts), string(decoded.Session.Messages[1].Parts))
+
+	var markdown bytes.Buffer
+	require.NoError(t, WriteMarkdown(&markdown, export))
+	assert.Contains(t, markdown.String(), "# Intro scene\n")
+	assert.Contains(t, markdown.String(), "**Tool call** `edit` (`call-1`)\n\n```json\n{\n  \"file_path\": \"intro.tsx\"\n}\n```\n")
+	assert.Contains(t, markdown.String(), "**Result** of `edit` (`call-1`)\n\n````\n```\nedited\n```\n````\n", "results are named after their call and fenced around backticks")
+	assert.Contains(t, markdown.String(), "## Sub-agent session: Search\n")
+
+	_, err = Load(ctx, svc, "missing")
+	assert.EqualError(t, err, "session not found: missing")
+}
+
+func TestImport(t *testing.T) {
+	svc := newServices(t)
+	ctx := context.Background()
+
+	sess, err := svc.Sessions.Create(ctx, "Intro scene")
+	require.NoError(t, err)
+	_, err = svc.Messages.Create(ctx, sess.ID, message.CreateMessageParams{
+		Role: message.User,
+		Parts: []message.ContentPart{
+			message.TextContent{Text: "Match this frame"},
+			message.BinaryContent{Path: "frame.png", MIMEType: "image/png", Data: []byte{0x89, 'P', 'N', 'G'}},
+			message.ImageURLContent{URL: "https://example.com/frame.png"},
+		},
+	})
+	require.NoError(t, err)
+	summary, err := svc.Messages.Create(ctx, sess.ID, message.CreateMessageParams{
+		Role:  message.Assistant,
+		Model: "claude-3.7-sonnet",
+		Parts: []message.ContentPart{
+			message.ReasoningContent{Thinking: "Search the scenes first"},
+			message.ToolCall{ID: "call-2", Name: "agent", Input: `{"prompt":"find the title"}`, Finished: true},
+			message.Finish{Reason: message.FinishReasonToolUse, Time: 1700000000},
+		},
+	})
+	require.NoError(t, err)
+	_, err = svc.Messages.Create(ctx, sess.ID, message.CreateMessageParams{
+		Role: message.Tool,
+		Parts: []message.ContentPart{message.ToolResult{
+			ToolCallID: "call-2",
+			Name:       "agent",
+			Content:    "In intro.tsx\n\nsession_id: call-2",
+			Metadata:   `{"session_id":"call-2"}`,
+		}},
+	})
+	require.NoError(t, err)
+	_, err = svc.History.Create(ctx, sess.ID, "/project/intro.tsx", "old")
+	require.NoError(t, err)
+	_, err = svc.History.CreateVersion(ctx, sess.ID, "/project/intro.tsx", "new")
+	require.NoError(t, err)
+	sess.SummaryMessageID = summary.ID
+	sess.TotalPromptTokens = 1200
+	sess.Cost = 0.25
+	_, err = svc.Sessions.Save(ctx, sess)
+	require.NoError(t, err)
+	sub, err := svc.Sessions.CreateTaskSession(ctx, "call-2", sess.ID, "Search")
+	require.NoError(t, err)
+	_, err = svc.Messages.Create(ctx, sub.ID, message.CreateMessageParams{
+		Role:  message.User,
+		Parts: []message.ContentPart{message.TextContent{Text: "find the title"}},
+	})
+	require.NoError(t, err)
+
+	exported, err := Load(ctx, svc, sess.ID)
+	require.NoError(t, err)
+	var jsonOut bytes.Buffer
+	require.NoError(t, WriteJSON(&jsonOut, exported))
+	read, err := ReadJSON(bytes.NewReader(jsonOut.Bytes()))
+	require.NoError(t, err)
+
+	imported, err := Import(ctx, svc, read)
+	require.NoError(t, err)
+	assert.NotEqual(t, sess.ID, imported.ID)
+
+	reloaded, err := Load(ctx, svc, imported.ID)
+	require.NoError(t, err)
+	got := reloaded.Session
+	assert.Equal(t, "Intro scene", got.Title)
+	assert.Equal(t, int64(1200), got.TotalPromptTokens)
+	assert.Equal(t, 0.25, got.Cost)
+	require.Len(t, got.Messages, 3)
+	assert.Equal(t, got.Messages[1].ID, got.SummaryMessageID)
+	for i, msg := range got.Messages {
+		want := exported.Session.Messages[i]
+		assert.NotEqual(t, want.ID, msg.ID)
+		assert.Equal(t, want.Model, msg.Model)
+		assert.Equal(t, want.CreatedAt, msg.CreatedAt)
+	}
+	assert.Len(t, got.Messages[0].parts, 4)
+	assert.Equal(t, exported.Session.Messages[0].parts, got.Messages[0].parts, "attachments and images are kept")
+	assert.Equal(t, exported.Session.Messages[1].parts[0], got.Messages[1].parts[0])
+	assert.Equal(t, exported.Session.Messages[1].parts[2], got.Messages[1].parts[2], "the finish part is kept")
+
+	require.Len(t, got.SubSessions, 1)
+	newSubID := got.SubSessions[0].ID
+	assert.NotEqual(t, "call-2", newSubID)
+	assert.Equal(t, "Search", got.SubSessions[0].Title)
+	assert.Len(t, got.SubSessions[0].Messages, 1)
+	call := got.Messages[1].parts[1].(message.ToolCall)
+	assert.Equal(t, newSubID, call.ID, "the agent call is linked to the new sub-agent session")
+	result := got.Messages[2].parts[0].(message.ToolResult)
+	assert.Equal(t, newSubID, result.ToolCallID)
+	assert.Equal(t, "In intro.tsx\n\nsession_id: "+newSubID, result.Content)
+	assert.Equal(t, `{"session_id":"`+newSubID+`"}`, result.Metadata)
+
+	require.Len(t, got.Files, 2)
+	for i, f := range got.Files {
+		want := exported.Session.Files[i]
+		assert.NotEqual(t, want.ID, f.ID)
+		assert.Equal(t, want.Path, f.Path)
+		assert.Equal(t, want.Content, f.Content)
+		assert.Equal(t, want.Version, f.Version)
+	}
+
+	_, err = ReadJSON(strings.NewReader(`{"version":2,"session":{}}`))
+	assert.EqualError(t, err, "unsupported export version 2, this version of opencode reads version 1")
+	_, err = ReadJSON(strings.NewReader(`{"version":1,"session":{"messages":[{"id":"m1","role":"user","parts":[{"type":"video","data":{}}]}]}}`))
+	assert.EqualError(t, err, "failed to decode the parts of message m1: unknown part type: video")
+}
+
+// cancellingMessages fails the import like an interrupted command would.
+type cancellingMessages struct {
+	message.Service
+	cancel context.CancelFunc
+}
+
+func (m cancellingMessages) Import(ctx context.Context, sessionID string, msg message.Message) (message.Message, error) {
+	m.cancel()
+	return message.Message{}, ctx.Err()
+}
+
+func TestImportRollback(t *testing.T) {
+	svc := newServices(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	svc.Messages = cancellingMessages{Service: svc.Messages, cancel: cancel}
+
+	_, err := Import(ctx, svc, Export{Version: Version, Session: Session{
+		Title:    "Intro scene",
+		Messages: []Message{{ID: "m1", Role: string(message.User)}},
+	}})
+	assert.ErrorIs(t, err, context.Canceled)
+	sessions, err := svc.Sessions.List(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, sessions, "the partial import is deleted")
+}
@@ -25,6 +25,19 @@ type SessionClearedMsg struct{}
 
 type EditorFocusMsg bool
 
+// PlanModeMsg reports that plan mode was switched on or off.
+type PlanModeMsg bool
+
+// EditPlanMsg loads a plan into the editor to be approved.
+type EditPlanMsg struct {
+	Plan string
+}
+
+// ApprovePlanMsg executes the plan, as edited by the user.
+type ApprovePlanMsg struct {
+	Plan string
+}
+
 func header(width int) string {
 	return lipgloss.JoinVertical(
 		lipgloss.Top,
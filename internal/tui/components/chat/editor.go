@@ -31,6 +31,8 @@ type editorCmp struct {
 	textarea    textarea.Model
 	attachments []message.Attachment
 	deleteMode  bool
+	// approvingPlan is set while the editor holds a plan to approve
+	approvingPlan bool
 }
 
 type EditorKeyMaps struct {
@@ -89,6 +91,15 @@ func (m *editorCmp) openEditor() tea.Cmd {
 	if err != nil {
 		return util.ReportError(err)
 	}
+	approvingPlan := m.approvingPlan
+	if approvingPlan {
+		if _, err := tmpfile.WriteString(m.textarea.Value()); err != nil {
+			tmpfile.Close()
+			return util.ReportError(err)
+		}
+		m.approvingPlan = false
+		m.textarea.Reset()
+	}
 	tmpfile.Close()
 	c := exec.Command(editor, tmpfile.Name()) //nolint:gosec
 	c.Stdin = os.Stdin
@@ -106,6 +117,9 @@ func (m *editorCmp) openEditor() tea.Cmd {
 			return util.ReportWarn("Message is empty")
 		}
 		os.Remove(tmpfile.Name())
+		if approvingPlan {
+			return ApprovePlanMsg{Plan: string(content)}
+		}
 		attachments := m.attachments
 		m.attachments = nil
 		return SendMsg{
@@ -120,12 +134,19 @@ func (m *editorCmp) Init() tea.Cmd {
 }
 
 func (m *editorCmp) send() tea.Cmd {
-	if m.app.CoderAgent.IsSessionBusy(m.session.ID) {
+	if m.app.IsSessionBusy(m.session.ID) {
 		return util.ReportWarn("Agent is working, please wait...")
 	}
 
 	value := m.textarea.Value()
 	m.textarea.Reset()
+	if m.approvingPlan {
+		m.approvingPlan = false
+		if strings.TrimSpace(value) == "" {
+			return util.ReportWarn("Plan is empty")
+		}
+		return util.CmdHandler(ApprovePlanMsg{Plan: value})
+	}
 	attachments := m.attachments
 
 	m.attachments = nil
@@ -140,6 +161,14 @@ func (m *editorCmp) send() tea.Cmd {
 	)
 }
 
+// discardPlan clears the editor if it holds a plan to approve.
+func (m *editorCmp) discardPlan() {
+	if m.approvingPlan {
+		m.approvingPlan = false
+		m.textarea.Reset()
+	}
+}
+
 func (m *editorCmp) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmd tea.Cmd
 	switch msg := msg.(type) {
@@ -154,8 +183,15 @@ func (m *editorCmp) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case SessionSelectedMsg:
 		if msg.ID != m.session.ID {
 			m.session = msg
+			m.discardPlan()
 		}
 		return m, nil
+	case SessionClearedMsg:
+		m.discardPlan()
+	case EditPlanMsg:
+		m.approvingPlan = true
+		m.textarea.SetValue(msg.Plan)
+		return m, util.ReportInfo("Edit the plan, enter executes it and esc discards it")
 	case dialog.AttachmentAddedMsg:
 		if len(m.attachments) >= maxAttachments {
 			logging.ErrorPersist(fmt.Sprintf("cannot add more than %d images", maxAttachments))
@@ -189,13 +225,14 @@ func (m *editorCmp) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, nil
 		}
 		if key.Matches(msg, editorMaps.OpenEditor) {
-			if m.app.CoderAgent.IsSessionBusy(m.session.ID) {
+			if m.app.IsSessionBusy(m.session.ID) {
 				return m, util.ReportWarn("Agent is working, please wait...")
 			}
 			return m, m.openEditor()
 		}
 		if key.Matches(msg, DeleteKeyMaps.Escape) {
 			m.deleteMode = false
+			m.discardPlan()
 			return m, nil
 		}
 		// Hanlde Enter key
@@ -163,6 +163,12 @@ func renderAssistantMessage(
 				Foreground(t.TextMuted()).
 				Render(fmt.Sprintf(" %s (%s)", models.SupportedModels[msg.Model].Name, "permission denied")),
 			)
+		case message.FinishReasonLimitReached:
+			info = append(info, baseStyle.
+				Width(width-1).
+				Foreground(t.TextMuted()).
+				Render(fmt.Sprintf(" %s (%s)", models.SupportedModels[msg.Model].Name, "limit reached")),
+			)
 		}
 	}
 	if content != "" || (finished && finishData.Reason == message.FinishReasonEndTurn) {
@@ -339,7 +345,7 @@ func renderToolParams(paramWidth int, toolCall message.ToolCall) string {
 		var params agent.AgentParams
 		json.Unmarshal([]byte(toolCall.Input), &params)
 		prompt := strings.ReplaceAll(params.Prompt, "\n", " ")
-		return renderParams(paramWidth, prompt)
+		return renderParams(paramWidth, prompt, "subagent", params.SubAgent)
 	case tools.BashToolName:
 		var params tools.BashParams
 		json.Unmarshal([]byte(toolCall.Input), &params)
@@ -611,7 +617,7 @@ func renderToolMessage(
 	}
 
 	if toolCall.Name == agent.AgentToolName {
-		taskMessages, _ := messagesService.List(context.Background(), toolCall.ID)
+		taskMessages, _ := messagesService.List(context.Background(), agent.SubAgentSessionID(toolCall))
 		toolCalls := []message.ToolCall{}
 		for _, v := range taskMessages {
 			toolCalls = append(toolCalls, v.ToolCalls()...)
@@ -14,6 +14,7 @@ import (
 	"github.com/opencode-ai/opencode/internal/pubsub"
 	"github.com/opencode-ai/opencode/internal/session"
 	"github.com/opencode-ai/opencode/internal/tui/components/chat"
+	"github.com/opencode-ai/opencode/internal/tui/components/dialog"
 	"github.com/opencode-ai/opencode/internal/tui/styles"
 	"github.com/opencode-ai/opencode/internal/tui/theme"
 	"github.com/opencode-ai/opencode/internal/tui/util"
@@ -29,6 +30,8 @@ type statusCmp struct {
 	messageTTL time.Duration
 	lspClients map[string]*lsp.Client
 	session    session.Session
+	agent      config.AgentName
+	planMode   bool
 }
 
 // clearMessageCmd is a command that clears status messages after a timeout
@@ -51,6 +54,10 @@ func (m statusCmp) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.session = msg
 	case chat.SessionClearedMsg:
 		m.session = session.Session{}
+	case dialog.AgentSelectedMsg:
+		m.agent = msg.Name
+	case chat.PlanModeMsg:
+		m.planMode = bool(msg)
 	case pubsub.Event[session.Session]:
 		if msg.Type == pubsub.UpdatedEvent {
 			if m.session.ID == msg.Payload.ID {
@@ -118,7 +125,7 @@ func formatTokensAndCost(tokens, contextWindow int64, cost float64) string {
 
 func (m statusCmp) View() string {
 	t := theme.CurrentTheme()
-	modelID := config.Get().Agents[config.AgentCoder].Model
+	modelID := config.Get().Agents[m.agent].Model
 	model := models.SupportedModels[modelID]
 
 	// Initialize the help widget
@@ -271,16 +278,23 @@ func (m statusCmp) model() string {
 
 	cfg := config.Get()
 
-	coder, ok := cfg.Agents[config.AgentCoder]
+	agent, ok := cfg.Agents[m.agent]
 	if !ok {
 		return "Unknown"
 	}
-	model := models.SupportedModels[coder.Model]
+	model := models.SupportedModels[agent.Model]
 
+	name := model.Name
+	if m.agent != config.AgentCoder {
+		name = fmt.Sprintf("%s (%s)", m.agent, model.Name)
+	}
+	if m.planMode {
+		name = "PLAN " + name
+	}
 	return styles.Padded().
 		Background(t.Secondary()).
 		Foreground(t.Background()).
-		Render(model.Name)
+		Render(name)
 }
 
 func NewStatusCmp(lspClients map[string]*lsp.Client) StatusCmp {
@@ -289,5 +303,6 @@ func NewStatusCmp(lspClients map[string]*lsp.Client) StatusCmp {
 	return &statusCmp{
 		messageTTL: 10 * time.Second,
 		lspClients: lspClients,
+		agent:      config.AgentCoder,
 	}
 }
@@ -0,0 +1,200 @@
+package dialog
+
+import (
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/opencode-ai/opencode/internal/config"
+	"github.com/opencode-ai/opencode/internal/tui/layout"
+	"github.com/opencode-ai/opencode/internal/tui/styles"
+	"github.com/opencode-ai/opencode/internal/tui/theme"
+	"github.com/opencode-ai/opencode/internal/tui/util"
+)
+
+// AgentSelectedMsg is sent when an agent is selected
+type AgentSelectedMsg struct {
+	Name config.AgentName
+}
+
+// CloseAgentDialogMsg is sent when the agent dialog is closed
+type CloseAgentDialogMsg struct{}
+
+// AgentDialog interface for the agent selection dialog
+type AgentDialog interface {
+	tea.Model
+	layout.Bindings
+	SetCurrentAgent(name config.AgentName)
+}
+
+type agentDialogCmp struct {
+	agents       []config.AgentName
+	selectedIdx  int
+	width        int
+	height       int
+	currentAgent config.AgentName
+}
+
+type agentKeyMap struct {
+	Up     key.Binding
+	Down   key.Binding
+	Enter  key.Binding
+	Escape key.Binding
+	J      key.Binding
+	K      key.Binding
+}
+
+var agentKeys = agentKeyMap{
+	Up: key.NewBinding(
+		key.WithKeys("up"),
+		key.WithHelp("↑", "previous agent"),
+	),
+	Down: key.NewBinding(
+		key.WithKeys("down"),
+		key.WithHelp("↓", "next agent"),
+	),
+	Enter: key.NewBinding(
+		key.WithKeys("enter"),
+		key.WithHelp("enter", "select agent"),
+	),
+	Escape: key.NewBinding(
+		key.WithKeys("esc"),
+		key.WithHelp("esc", "close"),
+	),
+	J: key.NewBinding(
+		key.WithKeys("j"),
+		key.WithHelp("j", "next agent"),
+	),
+	K: key.NewBinding(
+		key.WithKeys("k"),
+		key.WithHelp("k", "previous agent"),
+	),
+}
+
+func (a *agentDialogCmp) Init() tea.Cmd {
+	// The coder comes first, followed by the agents of the configuration
+	a.agents = append([]config.AgentName{config.AgentCoder}, config.CustomAgents()...)
+	a.selectedIdx = 0
+	for i, name := range a.agents {
+		if name == a.currentAgent {
+			a.selectedIdx = i
+			break
+		}
+	}
+	return nil
+}
+
+func (a *agentDialogCmp) SetCurrentAgent(name config.AgentName) {
+	a.currentAgent = name
+}
+
+func (a *agentDialogCmp) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch {
+		case key.Matches(msg, agentKeys.Up) || key.Matches(msg, agentKeys.K):
+			if a.selectedIdx > 0 {
+				a.selectedIdx--
+			}
+			return a, nil
+		case key.Matches(msg, agentKeys.Down) || key.Matches(msg, agentKeys.J):
+			if a.selectedIdx < len(a.agents)-1 {
+				a.selectedIdx++
+			}
+			return a, nil
+		case key.Matches(msg, agentKeys.Enter):
+			if len(a.agents) > 0 {
+				selected := a.agents[a.selectedIdx]
+				if selected == a.currentAgent {
+					return a, util.CmdHandler(CloseAgentDialogMsg{})
+				}
+				return a, util.CmdHandler(AgentSelectedMsg{Name: selected})
+			}
+		case key.Matches(msg, agentKeys.Escape):
+			return a, util.CmdHandler(CloseAgentDialogMsg{})
+		}
+	case tea.WindowSizeMsg:
+		a.width = msg.Width
+		a.height = msg.Height
+	}
+	return a, nil
+}
+
+// agentDescription describes the agent in the list.
+func agentDescription(name config.AgentName) string {
+	if name == config.AgentCoder {
+		return "Default coding agent"
+	}
+	return config.Get().Agents[name].Description
+}
+
+func (a *agentDialogCmp) View() string {
+	t := theme.CurrentTheme()
+	baseStyle := styles.BaseStyle()
+
+	// Calculate max width needed for agent names and descriptions
+	maxWidth := 40 // Minimum width
+	for _, name := range a.agents {
+		if w := len(name) + len(agentDescription(name)) + 7; w > maxWidth {
+			maxWidth = w
+		}
+	}
+
+	maxWidth = max(30, min(maxWidth, a.width-15)) // Limit width to avoid overflow
+
+	// Build the agent list
+	agentItems := make([]string, 0, len(a.agents))
+	for i, name := range a.agents {
+		itemStyle := baseStyle.Width(maxWidth)
+		descStyle := baseStyle.Foreground(t.TextMuted())
+
+		if i == a.selectedIdx {
+			itemStyle = itemStyle.
+				Background(t.Primary()).
+				Foreground(t.Background()).
+				Bold(true)
+			descStyle = descStyle.
+				Background(t.Primary()).
+				Foreground(t.Background())
+		}
+
+		item := string(name)
+		if description := agentDescription(name); description != "" {
+			item += descStyle.Render(" - " + description)
+		}
+		agentItems = append(agentItems, itemStyle.Padding(0, 1).Render(item))
+	}
+
+	title := baseStyle.
+		Foreground(t.Primary()).
+		Bold(true).
+		Width(maxWidth).
+		Padding(0, 1).
+		Render("Select Agent")
+
+	content := lipgloss.JoinVertical(
+		lipgloss.Left,
+		title,
+		baseStyle.Width(maxWidth).Render(""),
+		baseStyle.Width(maxWidth).Render(lipgloss.JoinVertical(lipgloss.Left, agentItems...)),
+		baseStyle.Width(maxWidth).Render(""),
+	)
+
+	return baseStyle.Padding(1, 2).
+		Border(lipgloss.RoundedBorder()).
+		BorderBackground(t.Background()).
+		BorderForeground(t.TextMuted()).
+		Width(lipgloss.Width(content) + 4).
+		Render(content)
+}
+
+func (a *agentDialogCmp) BindingKeys() []key.Binding {
+	return layout.KeyMapToSlice(agentKeys)
+}
+
+// NewAgentDialogCmp creates a new agent selection dialog
+func NewAgentDialogCmp() AgentDialog {
+	return &agentDialogCmp{
+		agents:       []config.AgentName{},
+		currentAgent: config.AgentCoder,
+	}
+}
@@ -2,7 +2,6 @@ package dialog
 
 import (
 	"fmt"
-	"net/http"
 	"os"
 	"path/filepath"
 	"sort"
@@ -25,9 +24,8 @@ import (
 )
 
 const (
-	maxAttachmentSize = int64(5 * 1024 * 1024) // 5MB
-	downArrow         = "down"
-	upArrow           = "up"
+	downArrow = "down"
+	upArrow   = "up"
 )
 
 type FilePrickerKeyMap struct {
@@ -234,26 +232,11 @@ func (f *filepickerCmp) addAttachmentToMessage() (tea.Model, tea.Cmd) {
 		return f, nil
 	}
 
-	isFileLarge, err := image.ValidateFileSize(selectedFilePath, maxAttachmentSize)
+	attachment, err := message.ReadAttachment(selectedFilePath)
 	if err != nil {
-		logging.ErrorPersist("unable to read the image")
+		logging.ErrorPersist(err.Error())
 		return f, nil
 	}
-	if isFileLarge {
-		logging.ErrorPersist("file too large, max 5MB")
-		return f, nil
-	}
-
-	content, err := os.ReadFile(selectedFilePath)
-	if err != nil {
-		logging.ErrorPersist("Unable read selected file")
-		return f, nil
-	}
-
-	mimeBufferSize := min(512, len(content))
-	mimeType := http.DetectContentType(content[:mimeBufferSize])
-	fileName := filepath.Base(selectedFilePath)
-	attachment := message.Attachment{FilePath: selectedFilePath, FileName: fileName, MimeType: mimeType, Content: content}
 	f.selectedFile = ""
 	return f, util.CmdHandler(AttachmentAddedMsg{attachment})
 }
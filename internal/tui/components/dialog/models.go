@@ -33,6 +33,7 @@ type CloseModelDialogMsg struct{}
 type ModelDialog interface {
 	tea.Model
 	layout.Bindings
+	SetAgent(name config.AgentName)
 }
 
 type modelDialogCmp struct {
@@ -46,6 +47,9 @@ type modelDialogCmp struct {
 	scrollOffset    int
 	hScrollOffset   int
 	hScrollPossible bool
+
+	// agent is the agent whose model is changed
+	agent config.AgentName
 }
 
 type modelKeyMap struct {
@@ -109,6 +113,12 @@ func (m *modelDialogCmp) Init() tea.Cmd {
 	return nil
 }
 
+// SetAgent selects the model of the agent in the list.
+func (m *modelDialogCmp) SetAgent(name config.AgentName) {
+	m.agent = name
+	m.setupModels()
+}
+
 func (m *modelDialogCmp) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
@@ -270,7 +280,7 @@ func (m *modelDialogCmp) BindingKeys() []key.Binding {
 
 func (m *modelDialogCmp) setupModels() {
 	cfg := config.Get()
-	modelInfo := GetSelectedModel(cfg)
+	modelInfo := models.SupportedModels[cfg.Agents[m.agent].Model]
 	m.availableProviders = getEnabledProviders(cfg)
 	m.hScrollPossible = len(m.availableProviders) > 1
 
@@ -324,7 +334,7 @@ func findProviderIndex(providers []models.ModelProvider, provider models.ModelPr
 
 func (m *modelDialogCmp) setupModelsForProvider(provider models.ModelProvider) {
 	cfg := config.Get()
-	agentCfg := cfg.Agents[config.AgentCoder]
+	agentCfg := cfg.Agents[m.agent]
 	selectedModelId := agentCfg.Model
 
 	m.provider = provider
@@ -369,5 +379,5 @@ func getModelsForProvider(provider models.ModelProvider) []models.Model {
 }
 
 func NewModelDialogCmp() ModelDialog {
-	return &modelDialogCmp{}
+	return &modelDialogCmp{agent: config.AgentCoder}
 }
@@ -9,6 +9,8 @@ import (
 	"github.com/charmbracelet/lipgloss"
 	"github.com/opencode-ai/opencode/internal/app"
 	"github.com/opencode-ai/opencode/internal/completions"
+	"github.com/opencode-ai/opencode/internal/config"
+	"github.com/opencode-ai/opencode/internal/llm/agent"
 	"github.com/opencode-ai/opencode/internal/message"
 	"github.com/opencode-ai/opencode/internal/session"
 	"github.com/opencode-ai/opencode/internal/tui/components/chat"
@@ -25,6 +27,8 @@ type chatPage struct {
 	messages             layout.Container
 	layout               layout.SplitPaneLayout
 	session              session.Session
+	agent                config.AgentName
+	planMode             bool
 	completionDialog     dialog.CompletionDialog
 	showCompletionDialog bool
 }
@@ -33,6 +37,8 @@ type ChatKeyMap struct {
 	ShowCompletionDialog key.Binding
 	NewSession           key.Binding
 	Cancel               key.Binding
+	TogglePlanMode       key.Binding
+	ApprovePlan          key.Binding
 }
 
 var keyMap = ChatKeyMap{
@@ -48,6 +54,14 @@ var keyMap = ChatKeyMap{
 		key.WithKeys("esc"),
 		key.WithHelp("esc", "cancel"),
 	),
+	TogglePlanMode: key.NewBinding(
+		key.WithKeys("ctrl+p"),
+		key.WithHelp("ctrl+p", "toggle plan mode"),
+	),
+	ApprovePlan: key.NewBinding(
+		key.WithKeys("ctrl+y"),
+		key.WithHelp("ctrl+y", "approve plan"),
+	),
 }
 
 func (p *chatPage) Init() tea.Cmd {
@@ -66,14 +80,18 @@ func (p *chatPage) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		cmds = append(cmds, cmd)
 	case dialog.CompletionDialogCloseMsg:
 		p.showCompletionDialog = false
+	case dialog.AgentSelectedMsg:
+		p.agent = msg.Name
 	case chat.SendMsg:
 		cmd := p.sendMessage(msg.Text, msg.Attachments)
 		if cmd != nil {
 			return p, cmd
 		}
+	case chat.ApprovePlanMsg:
+		return p, p.executePlan(msg.Plan)
 	case dialog.CommandRunCustomMsg:
 		// Check if the agent is busy before executing custom commands
-		if p.app.CoderAgent.IsBusy() {
+		if p.app.IsBusy() {
 			return p, util.ReportWarn("Agent is busy, please wait before executing a command...")
 		}
 		
@@ -111,11 +129,20 @@ func (p *chatPage) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				p.clearSidebar(),
 				util.CmdHandler(chat.SessionClearedMsg{}),
 			)
-		case key.Matches(msg, keyMap.Cancel):
+		case key.Matches(msg, keyMap.TogglePlanMode):
+			p.planMode = !p.planMode
 			if p.session.ID != "" {
+				p.app.SetPlanMode(p.session.ID, p.planMode)
+			}
+			return p, util.CmdHandler(chat.PlanModeMsg(p.planMode))
+		case key.Matches(msg, keyMap.ApprovePlan):
+			return p, p.loadPlan()
+		case key.Matches(msg, keyMap.Cancel):
+			// Once idle, esc reaches the editor
+			if p.session.ID != "" && p.app.IsSessionBusy(p.session.ID) {
 				// Cancel the current session's generation process
 				// This allows users to interrupt long-running operations
-				p.app.CoderAgent.Cancel(p.session.ID)
+				p.app.Cancel(p.session.ID)
 				return p, nil
 			}
 		}
@@ -168,13 +195,59 @@ func (p *chatPage) sendMessage(text string, attachments []message.Attachment) te
 		cmds = append(cmds, util.CmdHandler(chat.SessionSelectedMsg(session)))
 	}
 
-	_, err := p.app.CoderAgent.Run(context.Background(), p.session.ID, text, attachments...)
+	runAgent, err := p.app.Agent(p.agent)
+	if err != nil {
+		return util.ReportError(err)
+	}
+	if p.app.IsSessionBusy(p.session.ID) && !runAgent.IsSessionBusy(p.session.ID) {
+		return util.ReportWarn("Another agent is working on this session, please wait...")
+	}
+	if p.app.PlanMode(p.session.ID) != p.planMode {
+		p.app.SetPlanMode(p.session.ID, p.planMode)
+	}
+	_, err = runAgent.Run(context.Background(), p.session.ID, text, attachments...)
 	if err != nil {
 		return util.ReportError(err)
 	}
 	return tea.Batch(cmds...)
 }
 
+// loadPlan loads the latest plan of the session into the editor.
+func (p *chatPage) loadPlan() tea.Cmd {
+	if p.session.ID == "" {
+		return util.ReportWarn("No plan to approve")
+	}
+	if p.app.IsSessionBusy(p.session.ID) {
+		return util.ReportWarn("Agent is working, please wait...")
+	}
+	plan, err := agent.LatestPlan(context.Background(), p.app.Messages, p.session.ID)
+	if err != nil {
+		return util.ReportWarn("No plan to approve")
+	}
+	return util.CmdHandler(chat.EditPlanMsg{Plan: plan})
+}
+
+// executePlan leaves plan mode and executes the approved plan.
+func (p *chatPage) executePlan(plan string) tea.Cmd {
+	if p.session.ID == "" {
+		return util.ReportWarn("No plan to approve")
+	}
+	runAgent, err := p.app.Agent(p.agent)
+	if err != nil {
+		return util.ReportError(err)
+	}
+	if p.app.IsSessionBusy(p.session.ID) {
+		return util.ReportWarn("Agent is working, please wait...")
+	}
+	p.app.SetPlanMode(p.session.ID, false)
+	p.planMode = false
+	_, err = runAgent.ExecutePlan(context.Background(), p.session.ID, plan)
+	if err != nil {
+		return util.ReportError(err)
+	}
+	return util.CmdHandler(chat.PlanModeMsg(false))
+}
+
 func (p *chatPage) SetSize(width, height int) tea.Cmd {
 	return p.layout.SetSize(width, height)
 }
@@ -33,6 +33,7 @@ type keyMap struct {
 	Filepicker    key.Binding
 	Models        key.Binding
 	SwitchTheme   key.Binding
+	Agents        key.Binding
 }
 
 type startCompactSessionMsg struct{}
@@ -78,6 +79,11 @@ var keys = keyMap{
 		key.WithKeys("ctrl+t"),
 		key.WithHelp("ctrl+t", "switch theme"),
 	),
+
+	Agents: key.NewBinding(
+		key.WithKeys("ctrl+g"),
+		key.WithHelp("ctrl+g", "agent selection"),
+	),
 }
 
 var helpEsc = key.NewBinding(
@@ -133,6 +139,11 @@ type appModel struct {
 	showThemeDialog bool
 	themeDialog     dialog.ThemeDialog
 
+	showAgentDialog bool
+	agentDialog     dialog.AgentDialog
+	// agent runs the prompts of the chat page
+	agent config.AgentName
+
 	showMultiArgumentsDialog bool
 	multiArgumentsDialog     dialog.MultiArgumentsDialogCmp
 
@@ -316,12 +327,25 @@ func (a appModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		// Start the summarization process
 		return a, func() tea.Msg {
 			ctx := context.Background()
-			a.app.CoderAgent.Summarize(ctx, a.selectedSession.ID)
+			activeAgent, err := a.app.Agent(a.agent)
+			if err != nil {
+				return util.InfoMsg{Type: util.InfoTypeError, Msg: err.Error()}
+			}
+			activeAgent.Summarize(ctx, a.selectedSession.ID)
 			return nil
 		}
 
 	case pubsub.Event[agent.AgentEvent]:
 		payload := msg.Payload
+		switch payload.Type {
+		case agent.AgentEventTypeLimitReached:
+			return a, util.ReportWarn(payload.Error.Error())
+		case agent.AgentEventTypeFallback:
+			return a, util.ReportWarn(payload.Progress)
+		case agent.AgentEventTypeSubAgent:
+			// The chat renders the sub-agent's messages from their own events
+			return a, nil
+		}
 		if payload.Error != nil {
 			a.isCompacting = false
 			return a, util.ReportError(payload.Error)
@@ -332,13 +356,6 @@ func (a appModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if payload.Done && payload.Type == agent.AgentEventTypeSummarize {
 			a.isCompacting = false
 			return a, util.ReportInfo("Session summarization complete")
-		} else if payload.Done && payload.Type == agent.AgentEventTypeResponse && a.selectedSession.ID != "" {
-			model := a.app.CoderAgent.Model()
-			contextWindow := model.ContextWindow
-			tokens := a.selectedSession.CompletionTokens + a.selectedSession.PromptTokens
-			if (tokens >= int64(float64(contextWindow)*0.95)) && config.Get().AutoCompact {
-				return a, util.CmdHandler(startCompactSessionMsg{})
-			}
 		}
 		// Continue listening for events
 		return a, nil
@@ -352,6 +369,20 @@ func (a appModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		a.showThemeDialog = false
 		return a, tea.Batch(cmd, util.ReportInfo("Theme changed to: "+msg.ThemeName))
 
+	case dialog.CloseAgentDialogMsg:
+		a.showAgentDialog = false
+		return a, nil
+
+	case dialog.AgentSelectedMsg:
+		a.showAgentDialog = false
+		a.agent = msg.Name
+		a.agentDialog.SetCurrentAgent(msg.Name)
+		a.modelDialog.SetAgent(msg.Name)
+		s, _ := a.status.Update(msg)
+		a.status = s.(core.StatusCmp)
+		a.pages[page.ChatPage], cmd = a.pages[page.ChatPage].Update(msg)
+		return a, tea.Batch(cmd, util.ReportInfo(fmt.Sprintf("Agent changed to %s", msg.Name)))
+
 	case dialog.CloseModelDialogMsg:
 		a.showModelDialog = false
 		return a, nil
@@ -359,7 +390,11 @@ func (a appModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case dialog.ModelSelectedMsg:
 		a.showModelDialog = false
 
-		model, err := a.app.CoderAgent.Update(config.AgentCoder, msg.Model.ID)
+		activeAgent, err := a.app.Agent(a.agent)
+		if err != nil {
+			return a, util.ReportError(err)
+		}
+		model, err := activeAgent.Update(a.agent, msg.Model.ID)
 		if err != nil {
 			return a, util.ReportError(err)
 		}
@@ -510,6 +545,16 @@ func (a appModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return a, nil
 			}
 			return a, nil
+		case key.Matches(msg, keys.Agents):
+			if a.showAgentDialog {
+				a.showAgentDialog = false
+				return a, nil
+			}
+			if a.currentPage == page.ChatPage && !a.showQuit && !a.showPermissions && !a.showSessionDialog && !a.showCommandDialog {
+				a.showAgentDialog = true
+				return a, a.agentDialog.Init()
+			}
+			return a, nil
 		case key.Matches(msg, keys.SwitchTheme):
 			if !a.showQuit && !a.showPermissions && !a.showSessionDialog && !a.showCommandDialog {
 				// Show theme switcher dialog
@@ -558,7 +603,7 @@ func (a appModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			a.showHelp = !a.showHelp
 			return a, nil
 		case key.Matches(msg, helpEsc):
-			if a.app.CoderAgent.IsBusy() {
+			if a.app.IsBusy() {
 				if a.showQuit {
 					return a, nil
 				}
@@ -656,6 +701,16 @@ func (a appModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 	}
 
+	if a.showAgentDialog {
+		d, agentCmd := a.agentDialog.Update(msg)
+		a.agentDialog = d.(dialog.AgentDialog)
+		cmds = append(cmds, agentCmd)
+		// Only block key messages send all other messages down
+		if _, ok := msg.(tea.KeyMsg); ok {
+			return a, tea.Batch(cmds...)
+		}
+	}
+
 	s, _ := a.status.Update(msg)
 	a.status = s.(core.StatusCmp)
 	a.pages[a.currentPage], cmd = a.pages[a.currentPage].Update(msg)
@@ -678,7 +733,7 @@ func (a *appModel) findCommand(id string) (dialog.Command, bool) {
 }
 
 func (a *appModel) moveToPage(pageID page.PageID) tea.Cmd {
-	if a.app.CoderAgent.IsBusy() {
+	if a.app.IsBusy() {
 		// For now we don't move to any page if the agent is busy
 		return util.ReportWarn("Agent is busy, please wait...")
 	}
@@ -775,7 +830,7 @@ func (a appModel) View() string {
 		if a.currentPage == page.LogsPage {
 			bindings = append(bindings, logsKeyReturnKey)
 		}
-		if !a.app.CoderAgent.IsBusy() {
+		if !a.app.IsBusy() {
 			bindings = append(bindings, helpEsc)
 		}
 		a.help.SetBindings(bindings)
@@ -880,6 +935,21 @@ func (a appModel) View() string {
 		)
 	}
 
+	if a.showAgentDialog {
+		overlay := a.agentDialog.View()
+		row := lipgloss.Height(appView) / 2
+		row -= lipgloss.Height(overlay) / 2
+		col := lipgloss.Width(appView) / 2
+		col -= lipgloss.Width(overlay) / 2
+		appView = layout.PlaceOverlay(
+			col,
+			row,
+			overlay,
+			appView,
+			true,
+		)
+	}
+
 	if a.showMultiArgumentsDialog {
 		overlay := a.multiArgumentsDialog.View()
 		row := lipgloss.Height(appView) / 2
@@ -912,6 +982,8 @@ func New(app *app.App) tea.Model {
 		permissions:   dialog.NewPermissionDialogCmp(),
 		initDialog:    dialog.NewInitDialogCmp(),
 		themeDialog:   dialog.NewThemeDialogCmp(),
+		agentDialog:   dialog.NewAgentDialogCmp(),
+		agent:         config.AgentCoder,
 		app:           app,
 		commands:      []dialog.Command{},
 		pages: map[page.PageID]tea.Model{